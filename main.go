@@ -6,6 +6,10 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/marianogappa/ch/pkg/ch"
 	"github.com/marianogappa/ch/pkg/input"
@@ -13,7 +17,9 @@ import (
 	_ "github.com/marianogappa/ch/pkg/output/chartjs"
 	_ "github.com/marianogappa/ch/pkg/output/d3"
 	_ "github.com/marianogappa/ch/pkg/output/json"
+	_ "github.com/marianogappa/ch/pkg/output/stats"
 	"github.com/marianogappa/ch/pkg/parser"
+	"github.com/marianogappa/ch/pkg/transform"
 )
 
 func main() {
@@ -43,42 +49,152 @@ func Run(args []string, stdin io.Reader) error {
 	// Global flags
 	var (
 		separator     string
+		separatorRE   string
 		dateFormat    string
 		rawLineFormat string
+		columns       string
+		header        bool
+		inferLines    int
+		inferThresh   float64
+		inspect       bool
+		driftLines    int
+		bufferSize    int
+		transforms    string
 		interactive   bool
 		apiKey        string
+		join          string
+		joinOn        string
+		joinAsOf      string
+		joinTolerance time.Duration
+		joinKind      string
 	)
 
-	fs.StringVar(&separator, "separator", "\t", "Column separator")
+	fs.StringVar(&separator, "separator", "\t", "Column separator; may be many characters long. A single space splits on any whitespace, like awk")
+	fs.StringVar(&separatorRE, "separator-regex", "", "Column separator as a regular expression (overrides --separator)")
 	fs.StringVar(&dateFormat, "date-format", "", "Date format")
 	fs.StringVar(&rawLineFormat, "format", "", "Line format (e.g. 'sfd')")
+	fs.StringVar(&columns, "columns", "", "Columns to chart, in order, by 1-based index or header name (e.g. '3,1' or 'name,latency')")
+	fs.BoolVar(&header, "header", false, "First line contains column names")
+	fs.IntVar(&inferLines, "infer-lines", parser.DefaultInferLines, "Number of lines sampled to infer the line format")
+	fs.Float64Var(&inferThresh, "infer-threshold", parser.DefaultInferThreshold, "Fraction of a column's non-null sampled values that must parse as a number or date for it to be inferred as one")
+	fs.IntVar(&driftLines, "drift-lines", parser.DefaultDriftLines, "Consecutive lines not matching the line format after which it's inferred again (0 disables)")
+	fs.IntVar(&bufferSize, "buffer", parser.DefaultBufferSize, "Number of rows parsed ahead of the output; larger values speed up huge inputs at the cost of memory")
+	fs.BoolVar(&inspect, "inspect", false, "Print a report explaining the type inferred for each column, instead of rendering")
+	fs.StringVar(&transforms, "transform", "", fmt.Sprintf("Comma-separated transformers to apply in order, out of %v. Setting a transformer's flags also applies it", ch.Transformers()))
+	fs.StringVar(&join, "join", "", "Comma-separated files to join, followed by any more files as arguments (e.g. --join requests.tsv cpu.tsv); a single file is joined to the standard input")
+	fs.StringVar(&joinOn, "on", "", "Comma-separated key columns whose values must be equal for --join to match rows, as `name` or `left=right` if their names differ")
+	fs.StringVar(&joinAsOf, "as-of", "", "Datetime column (or `left=right` columns) that --join matches to the nearest time rather than exactly")
+	fs.DurationVar(&joinTolerance, "as-of-tolerance", 0, "Furthest an --as-of match may be (e.g. 30s); unlimited if 0")
+	fs.StringVar(&joinKind, "join-type", transform.JoinInner, "Kind of --join: inner (only rows with a match) or left (every row of the first input)")
 	fs.BoolVar(&interactive, "interactive", false, "Interactive mode (LLM)")
 	fs.StringVar(&apiKey, "api-key", "", "LLM API Key")
 
 	// Register output flags
 	outConfig := outDriver.RegisterFlags(fs)
 
+	// Register transformer flags, remembering which transformer owns each one
+	var (
+		transformerConfigs = make(map[string]any)
+		flagOwners         = make(map[string]string)
+	)
+	for _, name := range ch.Transformers() {
+		t, _ := ch.GetTransformer(name)
+		tfs := flag.NewFlagSet(name, flag.ContinueOnError)
+		transformerConfigs[name] = t.RegisterFlags(tfs)
+		tfs.VisitAll(func(f *flag.Flag) {
+			fs.Var(f.Value, f.Name, f.Usage)
+			flagOwners[f.Name] = name
+		})
+	}
+
 	// Parse
 	var dummyOutput string
 	fs.StringVar(&dummyOutput, "output", "chartjs", "Output driver")
 	fs.StringVar(&dummyOutput, "o", "chartjs", "Output driver")
 
-	if err := fs.Parse(args[1:]); err != nil {
-		return err
+	// Arguments are the files to join, which may be interspersed with flags
+	var files []string
+	for rest := args[1:]; ; {
+		if err := fs.Parse(rest); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		files = append(files, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+	if join != "" {
+		files = append(strings.Split(join, ","), files...)
+	} else if len(files) > 0 {
+		return fmt.Errorf("unexpected arguments %v; use --join to chart files", files)
+	}
+
+	var chain []ch.Transformer
+	for _, name := range transformerChain(args[1:], flagOwners, fs.Lookup) {
+		t, err := ch.GetTransformer(name)
+		if err != nil {
+			return fmt.Errorf("error: %v. Available transformers: %v", err, ch.Transformers())
+		}
+		chain = append(chain, t)
+	}
+
+	// 2. Setup Inputs
+	var (
+		inputs = []ch.Input{input.NewReaderInput(stdin)}
+		names  = []string{"stdin"}
+	)
+	if len(files) > 1 {
+		inputs, names = nil, nil
+	}
+	for _, f := range files {
+		inputs = append(inputs, input.NewFileInput(f))
+		names = append(names, strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)))
 	}
 
-	// 2. Setup Input
-	in := input.NewReaderInput(stdin)
+	// 3. Setup Parsers
+	separator = strings.ReplaceAll(separator, "\\t", "\t") // handle escaped tab from shell
+	var splitter parser.Splitter
+	if separatorRE != "" {
+		splitter, err = parser.NewRegexSplitter(separatorRE)
+	} else {
+		splitter, err = parser.NewSplitter(separator)
+	}
+	if err != nil {
+		return err
+	}
 
-	// 3. Setup Parser
-	sepRune := []rune(separator)[0] // simplistic
-	if separator == "\\t" {
-		sepRune = '\t'
-	} // handle escaped tab from shell
+	if inferLines <= 0 || inferThresh <= 0 || inferThresh > 1 {
+		return fmt.Errorf("--infer-lines must be positive and --infer-threshold must be in (0, 1]")
+	}
+	if bufferSize < 0 {
+		return fmt.Errorf("--buffer can't be negative")
+	}
 
-	p := parser.NewCSVParser(sepRune, dateFormat)
-	if rawLineFormat != "" {
-		p.LineFormat = rawLineFormat
+	// Every input gets its own parser, as they may have different formats
+	sepRune, _ := utf8.DecodeRuneInString(separator)
+	newParser := func() (*parser.CSVParser, error) {
+		p := parser.NewCSVParser(sepRune, dateFormat)
+		p.Splitter = splitter
+		if rawLineFormat != "" {
+			p.LineFormat = rawLineFormat
+		}
+		p.Header = header
+		p.InferLines = inferLines
+		p.InferThreshold = inferThresh
+		p.DriftLines = driftLines
+		p.BufferSize = bufferSize
+		if columns != "" {
+			var err error
+			if p.Columns, err = parser.NewColumnSelector(columns); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+	joinCfg := transform.JoinConfig{On: splitList(joinOn), AsOf: joinAsOf, Tolerance: joinTolerance, Kind: joinKind}
+	if join == "" && (joinCfg.On != nil || joinAsOf != "") {
+		return fmt.Errorf("--on and --as-of require --join")
 	}
 
 	// 4. Interactive Mode
@@ -97,19 +213,113 @@ func Run(args []string, stdin io.Reader) error {
 	}
 
 	// 5. Run
-	stream, err := in.Stream()
-	if err != nil {
-		return fmt.Errorf("error creating input stream: %v", err)
+	ch.StreamError() // clear errors of earlier runs
+	var rows <-chan ch.Row
+	for i, in := range inputs {
+		stream, err := in.Stream()
+		if err != nil {
+			return fmt.Errorf("error creating input stream: %v", err)
+		}
+		p, err := newParser()
+		if err != nil {
+			return err
+		}
+
+		if inspect {
+			inf, err := p.Inspect(stream)
+			if err != nil {
+				return fmt.Errorf("error inspecting input: %v", err)
+			}
+			if len(inputs) > 1 {
+				fmt.Printf("==> %v <==\n", names[i])
+			}
+			fmt.Print(inf)
+			continue
+		}
+
+		parsed, err := p.Parse(stream)
+		if err != nil {
+			return fmt.Errorf("error creating parser: %v", err)
+		}
+		if i == 0 {
+			rows = parsed
+			continue
+		}
+		joinCfg.Names = [2]string{strings.Join(names[:i], "+"), names[i]}
+		if rows, err = transform.Join(rows, parsed, joinCfg); err != nil {
+			return err
+		}
+	}
+	if inspect {
+		return nil
 	}
 
-	rows, err := p.Parse(stream)
-	if err != nil {
-		return fmt.Errorf("error creating parser: %v", err)
+	for _, t := range chain {
+		if rows, err = t.Transform(rows, transformerConfigs[t.Name()]); err != nil {
+			return fmt.Errorf("error applying transformer %v: %v", t.Name(), err)
+		}
 	}
 
 	if err := outDriver.Render(rows, outConfig); err != nil {
 		return fmt.Errorf("error rendering output: %v", err)
 	}
+	if err := ch.StreamError(); err != nil {
+		return fmt.Errorf("error %v", err)
+	}
 
 	return nil
 }
+
+// transformerChain returns the names of the transformers to apply, in the
+// order they appear on the command line: either listed in --transform or
+// implied by setting one of their flags, other than to false (e.g.
+// --distinct=false), which lookup returns. Each transformer is applied once.
+func transformerChain(args []string, flagOwners map[string]string, lookup func(name string) *flag.Flag) []string {
+	var chain []string
+	add := func(name string) {
+		for _, n := range chain {
+			if n == name {
+				return
+			}
+		}
+		chain = append(chain, name)
+	}
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name == "transform" {
+			if !hasValue && i+1 < len(args) {
+				value = args[i+1]
+			}
+			for _, t := range strings.Split(value, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					add(t)
+				}
+			}
+		} else if owner, ok := flagOwners[name]; ok && !isFalseBool(lookup(name)) {
+			add(owner)
+		}
+	}
+	return chain
+}
+
+// isFalseBool reports whether the flag is a boolean one set to false.
+func isFalseBool(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag() && f.Value.String() == "false"
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
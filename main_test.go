@@ -3,8 +3,11 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"io"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -70,3 +73,114 @@ func TestRun_JSON(t *testing.T) {
 		}
 	}
 }
+
+// runJSON runs ch with the json output on the given input, returning the
+// decoded rows.
+func runJSON(t *testing.T, input string, args ...string) []ch.Row {
+	t.Helper()
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	defer func() {
+		os.Stdout = oldStdout
+	}()
+
+	// Read concurrently so that large outputs don't fill up the pipe
+	var (
+		buf  bytes.Buffer
+		done = make(chan struct{})
+	)
+	go func() {
+		io.Copy(&buf, r)
+		close(done)
+	}()
+
+	err := Run(append([]string{"ch", "--output", "json"}, args...), strings.NewReader(input))
+	w.Close()
+	<-done
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var rows []ch.Row
+	decoder := json.NewDecoder(&buf)
+	for {
+		var row ch.Row
+		if err := decoder.Decode(&row); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Failed to decode JSON output: %v", err)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestRun_Transform(t *testing.T) {
+	rows := runJSON(t, "b\na\nb\n", "--transform", "frequency")
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Strings[0] != "b" || rows[0].Floats[0] != 2 {
+		t.Errorf("Unexpected first row %+v", rows[0])
+	}
+}
+
+func TestRun_UnknownTransform(t *testing.T) {
+	if err := Run([]string{"ch", "--output", "json", "--transform", "nope"}, strings.NewReader("")); err == nil {
+		t.Error("Expected error for unknown transformer")
+	}
+}
+
+func TestRun_TransformErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"--group-by", "hots"},
+		{"--sort", "value", "--distinct-by", "nope"},
+	} {
+		if err := Run(append([]string{"ch", "--output", "json"}, args...), strings.NewReader("a\t1\nb\t2\n")); err == nil {
+			t.Errorf("Expected an error for %v", args)
+		}
+	}
+}
+
+func TestTransformerChain(t *testing.T) {
+	owners := map[string]string{"top": "top", "sort": "sort", "where": "filter", "distinct": "distinct", "bin-log": "bin"}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, name := range []string{"top", "sort", "where"} {
+		fs.String(name, "", "")
+	}
+	fs.Bool("distinct", true, "")
+	fs.Bool("bin-log", false, "")
+	args := []string{"--output", "json", "--where", "x > 1", "--transform=frequency,top", "-sort", "value", "--top", "5", "--distinct=false", "--bin-log", "--", "--sort"}
+	fs.Parse([]string{"--distinct=false", "--bin-log"})
+	got := transformerChain(args, owners, fs.Lookup)
+	expected := []string{"filter", "frequency", "top", "sort", "bin"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("transformerChain() = %v, want %v", got, expected)
+	}
+}
+
+func TestRun_Join(t *testing.T) {
+	dir := t.TempDir()
+	requests, cpu := filepath.Join(dir, "requests.tsv"), filepath.Join(dir, "cpu.tsv")
+	if err := os.WriteFile(requests, []byte("host\trequests\na\t10\nb\t20\nc\t30\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cpu, []byte("host\tcpu\nb\t0.7\na\t0.2\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rows := runJSON(t, "", "--header", "--join", requests, cpu, "--on", "host")
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", rows)
+	}
+	if rows[0].Strings[0] != "a" || !reflect.DeepEqual(rows[0].Floats, []float64{10, 0.2}) {
+		t.Errorf("Unexpected first row %+v", rows[0])
+	}
+
+	// A single file is joined to the standard input
+	rows = runJSON(t, "host\tcores\nc\t8\n", "--header", "--join", cpu, "--join-type", "left", "--on", "host")
+	if len(rows) != 1 || !reflect.DeepEqual(rows[0].Floats, []float64{8, 0}) { // the null cpu decodes as 0
+		t.Errorf("Unexpected rows %+v", rows)
+	}
+}
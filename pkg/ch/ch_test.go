@@ -2,6 +2,7 @@ package ch
 
 import (
 	"flag"
+	"fmt"
 	"testing"
 )
 
@@ -14,6 +15,16 @@ func (m *mockOutput) RegisterFlags(fs *flag.FlagSet) any       { return nil }
 func (m *mockOutput) Render(rows <-chan Row, config any) error { return nil }
 func (m *mockOutput) Capabilities() Capabilities               { return Capabilities{} }
 
+type mockTransformer struct {
+	name string
+}
+
+func (m *mockTransformer) Name() string                       { return m.name }
+func (m *mockTransformer) RegisterFlags(fs *flag.FlagSet) any { return nil }
+func (m *mockTransformer) Transform(rows <-chan Row, config any) (<-chan Row, error) {
+	return rows, nil
+}
+
 func TestRegistry(t *testing.T) {
 	// Note: This test runs in the same process as other tests, so the registry might already be populated.
 	// We should test adding a new one.
@@ -54,3 +65,55 @@ func TestRegistry(t *testing.T) {
 	}()
 	RegisterOutput(m)
 }
+
+func TestTransformerRegistry(t *testing.T) {
+	name := "test_transformer"
+	m := &mockTransformer{name: name}
+
+	RegisterTransformer(m)
+
+	got, err := GetTransformer(name)
+	if err != nil {
+		t.Fatalf("GetTransformer failed: %v", err)
+	}
+	if got != m {
+		t.Errorf("Expected %v, got %v", m, got)
+	}
+	if _, err := GetTransformer("missing"); err == nil {
+		t.Error("Expected error for unknown transformer")
+	}
+
+	found := false
+	for _, n := range Transformers() {
+		if n == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("Transformer %q not found in list: %v", name, Transformers())
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Expected panic on duplicate registration")
+		}
+	}()
+	RegisterTransformer(m)
+}
+
+func TestStreamError(t *testing.T) {
+	StreamError()
+	if err := StreamError(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	first, second := fmt.Errorf("first"), fmt.Errorf("second")
+	ReportError(first)
+	ReportError(second)
+	if err := StreamError(); err != first {
+		t.Errorf("Expected the first error reported, got %v", err)
+	}
+	if err := StreamError(); err != nil {
+		t.Errorf("Expected errors cleared once returned, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package ch
+
+import "sync"
+
+// Parsers and Transformers produce rows from goroutines, which can't return
+// the errors that end their streams early (e.g. a column missing after the
+// input's schema changed). They report them here instead, so that the run
+// fails once the Output has rendered what it got.
+var (
+	streamErrMu sync.Mutex
+	streamErr   error
+)
+
+// ReportError records an error that ended a stream of rows early. Only the
+// first one is kept, as later ones tend to be its consequences.
+func ReportError(err error) {
+	streamErrMu.Lock()
+	defer streamErrMu.Unlock()
+	if streamErr == nil {
+		streamErr = err
+	}
+}
+
+// StreamError returns the error reported since it was last called, if any,
+// and clears it.
+func StreamError() error {
+	streamErrMu.Lock()
+	defer streamErrMu.Unlock()
+	err := streamErr
+	streamErr = nil
+	return err
+}
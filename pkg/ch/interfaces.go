@@ -19,6 +19,74 @@ type Row struct {
 	Floats    []float64
 	Strings   []string
 	DateTimes []string
+	// Schema describes the columns of the Row. Rows parsed with the same line
+	// format share the same pointer, so a different pointer signals a schema
+	// change. It may be nil if the columns are unknown.
+	Schema *Schema `json:"-"`
+}
+
+// Schema describes the columns of a stream of Rows.
+type Schema struct {
+	Floats     []string // Names of the columns in Row.Floats
+	Strings    []string // Names of the columns in Row.Strings
+	DateTimes  []string // Names of the columns in Row.DateTimes
+	DateFormat string   // Layout (as in time.Parse) of the values in Row.DateTimes
+	// Sorted is set if the rows were put in an explicit order (e.g. with
+	// --sort), which outputs keep rather than imposing their own.
+	Sorted bool
+	// FloatRoles are the roles of the columns in Row.Floats, by index, for
+	// those that aren't plain values (e.g. anomaly flags). It may be shorter
+	// than Floats, or nil.
+	FloatRoles []ColumnRole
+}
+
+// Role is what a float column holds.
+type Role int
+
+const (
+	// RoleValue columns hold plain values, which is what columns are unless
+	// told otherwise.
+	RoleValue Role = iota
+	// RoleAnomaly columns are 1 in rows where the value of their Of column is
+	// an outlier, and 0 elsewhere.
+	RoleAnomaly
+	// RoleForecast columns hold forecasts of their Of column, within the
+	// confidence band bounded by its RoleForecastLower and RoleForecastUpper
+	// columns.
+	RoleForecast
+	RoleForecastLower
+	RoleForecastUpper
+)
+
+// ColumnRole is the role of a column derived from another, so that outputs
+// can e.g. highlight the outliers of a column rather than chart its anomaly
+// flags as values.
+type ColumnRole struct {
+	Role Role
+	Of   string // Name of the column it's derived from
+}
+
+// FloatRole returns the role of the i-th float column.
+func (s *Schema) FloatRole(i int) ColumnRole {
+	if s == nil || i >= len(s.FloatRoles) {
+		return ColumnRole{}
+	}
+	return s.FloatRoles[i]
+}
+
+// SetFloatRole sets the role of the i-th float column.
+func (s *Schema) SetFloatRole(i int, r ColumnRole) {
+	for len(s.FloatRoles) <= i {
+		s.FloatRoles = append(s.FloatRoles, ColumnRole{})
+	}
+	s.FloatRoles[i] = r
+}
+
+func (s *Schema) String() string {
+	if s == nil {
+		return "unknown schema"
+	}
+	return fmt.Sprintf("floats %v, strings %v, datetimes %v", s.Floats, s.Strings, s.DateTimes)
 }
 
 // Parser interprets the raw input stream into structured Rows.
@@ -44,9 +112,25 @@ type Output interface {
 	Capabilities() Capabilities
 }
 
+// Transformer reshapes a stream of Rows between the Parser and the Output,
+// e.g. counting frequencies, so that data shaping works the same for every
+// Output and transformers can be chained.
+type Transformer interface {
+	Name() string
+	// RegisterFlags registers the flags for this transformer on the given FlagSet.
+	// It returns a pointer to the configuration struct that will be populated when flags are parsed.
+	RegisterFlags(fs *flag.FlagSet) any
+	// Transform returns the transformed stream of rows, using the given configuration.
+	// The config argument is the same pointer returned by RegisterFlags.
+	Transform(rows <-chan Row, config any) (<-chan Row, error)
+}
+
 var (
 	outputsMu sync.RWMutex
 	outputs   = make(map[string]Output)
+
+	transformersMu sync.RWMutex
+	transformers   = make(map[string]Transformer)
 )
 
 // RegisterOutput registers an output driver.
@@ -85,3 +169,40 @@ func Outputs() []string {
 	sort.Strings(list)
 	return list
 }
+
+// RegisterTransformer registers a transformer.
+func RegisterTransformer(t Transformer) {
+	transformersMu.Lock()
+	defer transformersMu.Unlock()
+	if t == nil {
+		panic("ch: RegisterTransformer transformer is nil")
+	}
+	name := t.Name()
+	if _, dup := transformers[name]; dup {
+		panic("ch: RegisterTransformer called twice for transformer " + name)
+	}
+	transformers[name] = t
+}
+
+// GetTransformer returns a transformer by name.
+func GetTransformer(name string) (Transformer, error) {
+	transformersMu.RLock()
+	defer transformersMu.RUnlock()
+	t, ok := transformers[name]
+	if !ok {
+		return nil, fmt.Errorf("ch: unknown transformer %q", name)
+	}
+	return t, nil
+}
+
+// Transformers returns a sorted list of the names of the registered transformers.
+func Transformers() []string {
+	transformersMu.RLock()
+	defer transformersMu.RUnlock()
+	var list []string
+	for name := range transformers {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
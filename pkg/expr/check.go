@@ -0,0 +1,117 @@
+package expr
+
+import "fmt"
+
+// Check returns the kind of the expression's values given the kinds of its
+// identifiers, or an error if it can't be evaluated for any values of those
+// kinds (e.g. comparing a string with a number), so that such expressions are
+// rejected before evaluating them row by row.
+func (e *Expr) Check(kinds map[string]Kind) (Kind, error) {
+	k, err := e.root.check(kinds)
+	if err != nil {
+		return k, fmt.Errorf("expression %q: %v", e.src, err)
+	}
+	return k, nil
+}
+
+func (n literal) check(map[string]Kind) (Kind, error) { return n.v.Kind, nil }
+
+func (n ident) check(kinds map[string]Kind) (Kind, error) {
+	k, ok := kinds[n.name]
+	if !ok {
+		return k, fmt.Errorf("column %q not found", n.name)
+	}
+	return k, nil
+}
+
+func (n unary) check(kinds map[string]Kind) (Kind, error) {
+	x, err := n.x.check(kinds)
+	if err != nil {
+		return x, err
+	}
+	switch {
+	case n.op == "!" && x == Bool:
+		return Bool, nil
+	case n.op == "-" && x == Number:
+		return Number, nil
+	}
+	return x, fmt.Errorf("invalid operation %v on a %v", n.op, x)
+}
+
+func (n binary) check(kinds map[string]Kind) (Kind, error) {
+	x, err := n.x.check(kinds)
+	if err != nil {
+		return x, err
+	}
+	y, err := n.y.check(kinds)
+	if err != nil {
+		return y, err
+	}
+	switch n.op {
+	case "&&", "||":
+		if x != Bool || y != Bool {
+			return Bool, fmt.Errorf("invalid operation %v on a %v and a %v", n.op, x, y)
+		}
+		return Bool, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		// Strings compared with times are parsed as timestamps
+		if x == Time && y == String || x == String && y == Time {
+			return Bool, nil
+		}
+		if x != y {
+			return Bool, fmt.Errorf("can't compare a %v with a %v", x, y)
+		}
+		if x == Bool && n.op != "==" && n.op != "!=" {
+			return Bool, fmt.Errorf("invalid operation %v on bools", n.op)
+		}
+		return Bool, nil
+	}
+	switch {
+	case n.op == "+" && x == String && y == String:
+		return String, nil
+	case n.op == "-" && x == Time && y == Time:
+		return Number, nil
+	case x == Number && y == Number:
+		return Number, nil
+	}
+	return Number, fmt.Errorf("invalid operation %v on a %v and a %v", n.op, x, y)
+}
+
+func (n match) check(kinds map[string]Kind) (Kind, error) {
+	x, err := n.x.check(kinds)
+	if err != nil {
+		return x, err
+	}
+	if x != String {
+		return Bool, fmt.Errorf("can't match a %v against a regular expression", x)
+	}
+	if p, err := n.pattern.check(kinds); err != nil || p != String {
+		if err == nil {
+			err = fmt.Errorf("regular expression must be a string, not a %v", p)
+		}
+		return Bool, err
+	}
+	return Bool, nil
+}
+
+func (n *call) check(kinds map[string]Kind) (Kind, error) {
+	args := make([]Kind, len(n.args))
+	for i, arg := range n.args {
+		k, err := arg.check(kinds)
+		if err != nil {
+			return k, err
+		}
+		if want := n.fn.params[i]; want != anyKind && k != want {
+			return n.fn.result, fmt.Errorf("%v: argument %v must be a %v, not a %v", n.name, i+1, want, k)
+		}
+		args[i] = k
+	}
+	if n.fn.result != anyKind {
+		return n.fn.result, nil
+	}
+	// if's values must be of the same kind, which is its result's
+	if args[1] != args[2] {
+		return args[1], fmt.Errorf("%v: values must be of the same kind, not a %v and a %v", n.name, args[1], args[2])
+	}
+	return args[1], nil
+}
@@ -0,0 +1,331 @@
+// Package expr implements the small expression language used to filter rows
+// and compute columns, e.g. `latency > 200 && host != "canary"`.
+//
+// Expressions combine identifiers (column names, back quoted if they contain
+// other characters), numbers, quoted strings, unquoted timestamps (e.g.
+// 2024-01-01 or 2024-01-01T10:00:00Z), true and false with the operators,
+// from lowest to highest precedence:
+//
+//	||
+//	&&
+//	== != < <= > >= =~ !~   (=~ and !~ match strings with a regular expression)
+//	+ -                     (+ also concatenates strings; time - time is in seconds)
+//	* / %
+//	! -                     (unary)
+//
+// and calls to functions, e.g. lower(host) or extract(path, "^/(\w+)"). See
+// the functions map for the available ones.
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Kind is the type of a Value.
+type Kind int
+
+const (
+	Number Kind = iota
+	String
+	Time
+	Bool
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Time:
+		return "time"
+	case Bool:
+		return "bool"
+	default:
+		return "?"
+	}
+}
+
+// Value is the result of evaluating an expression, or the value of an
+// identifier.
+type Value struct {
+	Kind Kind
+	Num  float64
+	Str  string
+	Time time.Time
+	Bool bool
+}
+
+func NumberValue(f float64) Value { return Value{Kind: Number, Num: f} }
+func StringValue(s string) Value  { return Value{Kind: String, Str: s} }
+func TimeValue(t time.Time) Value { return Value{Kind: Time, Time: t} }
+func BoolValue(b bool) Value      { return Value{Kind: Bool, Bool: b} }
+
+func (v Value) String() string {
+	switch v.Kind {
+	case Number:
+		return strconv.FormatFloat(v.Num, 'g', -1, 64)
+	case String:
+		return strconv.Quote(v.Str)
+	case Time:
+		return v.Time.Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatBool(v.Bool)
+	}
+}
+
+// Env resolves the identifiers of an expression, usually to the columns of a
+// row.
+type Env interface {
+	Lookup(name string) (Value, error)
+}
+
+// Expr is a parsed expression.
+type Expr struct {
+	src    string
+	root   node
+	idents []string
+}
+
+// Parse parses an expression.
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %v", src, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parse(0)
+	if err == nil && p.peek().kind != tokEOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("expression %q: %v", src, err)
+	}
+	return &Expr{src: src, root: root, idents: p.idents}, nil
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Identifiers returns the distinct identifiers the expression refers to, in
+// order of appearance.
+func (e *Expr) Identifiers() []string {
+	return e.idents
+}
+
+// Eval evaluates the expression, looking up identifiers in env.
+func (e *Expr) Eval(env Env) (Value, error) {
+	return e.root.eval(env)
+}
+
+type node interface {
+	eval(env Env) (Value, error)
+	check(kinds map[string]Kind) (Kind, error)
+}
+
+type literal struct{ v Value }
+
+func (n literal) eval(Env) (Value, error) { return n.v, nil }
+
+type ident struct{ name string }
+
+func (n ident) eval(env Env) (Value, error) { return env.Lookup(n.name) }
+
+type unary struct {
+	op string
+	x  node
+}
+
+func (n unary) eval(env Env) (Value, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return x, err
+	}
+	switch {
+	case n.op == "!" && x.Kind == Bool:
+		return BoolValue(!x.Bool), nil
+	case n.op == "-" && x.Kind == Number:
+		return NumberValue(-x.Num), nil
+	}
+	return Value{}, fmt.Errorf("invalid operation %v on %v %v", n.op, x.Kind, x)
+}
+
+type binary struct {
+	op   string
+	x, y node
+}
+
+func (n binary) eval(env Env) (Value, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return x, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		if x.Kind != Bool {
+			return Value{}, fmt.Errorf("invalid operation %v on %v %v", n.op, x.Kind, x)
+		}
+		if x.Bool == (n.op == "||") { // short-circuit
+			return x, nil
+		}
+	}
+	y, err := n.y.eval(env)
+	if err != nil {
+		return y, err
+	}
+	switch n.op {
+	case "&&", "||":
+		if y.Kind != Bool {
+			return Value{}, fmt.Errorf("invalid operation %v on %v %v", n.op, y.Kind, y)
+		}
+		return y, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		return compare(n.op, x, y)
+	default:
+		return arithmetic(n.op, x, y)
+	}
+}
+
+type match struct {
+	x, pattern node
+	re         *regexp.Regexp // compiled on parse if the pattern is a literal
+	negate     bool
+}
+
+func (n match) eval(env Env) (Value, error) {
+	x, err := n.x.eval(env)
+	if err != nil {
+		return x, err
+	}
+	if x.Kind != String {
+		return Value{}, fmt.Errorf("can't match %v %v against a regular expression", x.Kind, x)
+	}
+	re := n.re
+	if re == nil {
+		p, err := n.pattern.eval(env)
+		if err != nil {
+			return p, err
+		}
+		if p.Kind != String {
+			return Value{}, fmt.Errorf("regular expression must be a string, not %v %v", p.Kind, p)
+		}
+		if re, err = regexp.Compile(p.Str); err != nil {
+			return Value{}, err
+		}
+	}
+	return BoolValue(re.MatchString(x.Str) != n.negate), nil
+}
+
+// compare compares two values of the same kind, parsing strings compared with
+// times as timestamps. Like in Go, comparisons with NaN are false.
+func compare(op string, x, y Value) (Value, error) {
+	var err error
+	if x.Kind == Time && y.Kind == String {
+		y, err = stringTime(y)
+	}
+	if y.Kind == Time && x.Kind == String {
+		x, err = stringTime(x)
+	}
+	if err != nil {
+		return Value{}, err
+	}
+	if x.Kind != y.Kind {
+		return Value{}, fmt.Errorf("can't compare %v %v with %v %v", x.Kind, x, y.Kind, y)
+	}
+	var c int
+	switch x.Kind {
+	case Number:
+		if math.IsNaN(x.Num) || math.IsNaN(y.Num) {
+			return BoolValue(op == "!="), nil
+		}
+		c = cmpOrdered(x.Num, y.Num)
+	case String:
+		c = cmpOrdered(x.Str, y.Str)
+	case Time:
+		c = x.Time.Compare(y.Time)
+	case Bool:
+		if op != "==" && op != "!=" {
+			return Value{}, fmt.Errorf("invalid operation %v on bools", op)
+		}
+		if x.Bool != y.Bool {
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return BoolValue(c == 0), nil
+	case "!=":
+		return BoolValue(c != 0), nil
+	case "<":
+		return BoolValue(c < 0), nil
+	case "<=":
+		return BoolValue(c <= 0), nil
+	case ">":
+		return BoolValue(c > 0), nil
+	default:
+		return BoolValue(c >= 0), nil
+	}
+}
+
+func cmpOrdered[T float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func arithmetic(op string, x, y Value) (Value, error) {
+	if op == "+" && x.Kind == String && y.Kind == String {
+		return StringValue(x.Str + y.Str), nil
+	}
+	if op == "-" && x.Kind == Time && y.Kind == Time {
+		return NumberValue(x.Time.Sub(y.Time).Seconds()), nil
+	}
+	if x.Kind != Number || y.Kind != Number {
+		return Value{}, fmt.Errorf("invalid operation %v %v %v", x, op, y)
+	}
+	switch op {
+	case "+":
+		return NumberValue(x.Num + y.Num), nil
+	case "-":
+		return NumberValue(x.Num - y.Num), nil
+	case "*":
+		return NumberValue(x.Num * y.Num), nil
+	case "/":
+		return NumberValue(x.Num / y.Num), nil
+	default:
+		return NumberValue(math.Mod(x.Num, y.Num)), nil
+	}
+}
+
+// stringTime returns a string compared with a time as the timestamp it holds.
+func stringTime(v Value) (Value, error) {
+	t := ParseTime(v.Str)
+	if t.IsZero() {
+		return Value{}, fmt.Errorf("can't compare a time with %q, which isn't a timestamp", v.Str)
+	}
+	return TimeValue(t), nil
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ParseTime parses timestamps like 2024-01-01, 2024-01-01T10:00 or
+// 2024-01-01 10:00:00Z, returning the zero time if s isn't one.
+func ParseTime(s string) time.Time {
+	if len(s) > 10 && s[10] == ' ' {
+		s = s[:10] + "T" + s[11:]
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
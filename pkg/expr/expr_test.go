@@ -0,0 +1,147 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type mapEnv map[string]Value
+
+func (e mapEnv) Lookup(name string) (Value, error) {
+	v, ok := e[name]
+	if !ok {
+		return Value{}, fmt.Errorf("unknown column %q", name)
+	}
+	return v, nil
+}
+
+func TestEval(t *testing.T) {
+	env := mapEnv{
+		"latency": NumberValue(250),
+		"errors":  NumberValue(5),
+		"total":   NumberValue(200),
+		"missing": NumberValue(math.NaN()),
+		"host":    StringValue("web-01"),
+		"ts":      TimeValue(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)),
+		"$3":      StringValue("GET"),
+		"user id": StringValue("42"),
+	}
+
+	tests := []struct {
+		expr string
+		want Value
+	}{
+		{`latency > 200 && host != "canary"`, BoolValue(true)},
+		{`latency > 200 && host == "canary"`, BoolValue(false)},
+		{`latency < 100 || host =~ "^web-\d+$"`, BoolValue(true)},
+		{`host !~ 'canary|staging'`, BoolValue(true)},
+		{`!(latency >= 250)`, BoolValue(false)},
+		{`errors / total * 100`, NumberValue(2.5)},
+		{`-errors + 2 * 3 % 4`, NumberValue(-3)},
+		{`1.5e2 - .5`, NumberValue(149.5)},
+		{`ts >= 2024-01-01 && ts < 2024-03-01T10:30`, BoolValue(true)},
+		{`ts == 2024-03-01 10:00:00Z`, BoolValue(true)},
+		{`ts > "2024-06-01"`, BoolValue(false)},
+		{`$3 == "GET" && ` + "`user id`" + ` == "42"`, BoolValue(true)},
+		{`"a" + 'b' < "b"`, BoolValue(true)},
+		{`missing > 1 || missing <= 1`, BoolValue(false)},
+		{`missing != 1`, BoolValue(true)},
+		{`true == (latency > 1)`, BoolValue(true)},
+		{`latency > 1000 && nonexistent > 1`, BoolValue(false)}, // short-circuit
+		{`lower("Web-01") + upper(host)`, StringValue("web-01WEB-01")},
+		{`substring(host, 1, 3) + substring(host, 4) + substring(host, 10)`, StringValue("eb-01")},
+		{`extract("GET /api/users/42", "/(\w+)/")`, StringValue("api")},
+		{`extract("GET /api/users/42", "\d+") + extract("x", "y")`, StringValue("42")},
+		{`extract("a=1, b=2", "(\w)=(\d)", 2)`, StringValue("1")},
+		{`replace(host, "(\w+)-(\d+)", "$2/$1")`, StringValue("01/web")},
+		{`len(trim("  héllo "))`, NumberValue(5)},
+		{`number("12.5") + number(latency > 1) + round(2.345, 2)`, NumberValue(15.85)},
+		{`string(errors) + "%"`, StringValue("5%")},
+		{`if(latency > 200, "slow", "fast")`, StringValue("slow")},
+		{`abs(-2) + floor(1.5) + ceil(1.5) + sqrt(4)`, NumberValue(7)},
+		{`(ts - 2024-03-01T09:00:00Z) / 60`, NumberValue(60)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			got, err := e.Eval(env)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, src := range []string{``, `latency >`, `(latency > 1`, `latency > 1)`, `latency = 1`, `host =~ "("`, `nope(1)`, `lower()`, `lower(host,)`, `"unterminated`, `a b`} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Parse(%q) should have failed", src)
+		}
+	}
+}
+
+func TestEval_Errors(t *testing.T) {
+	env := mapEnv{"latency": NumberValue(1), "host": StringValue("a"), "ts": TimeValue(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))}
+	for _, src := range []string{`ts > host`, `"yesterday" < ts`, `latency > "1"`, `host + 1`, `latency =~ "1"`, `latency && true`, `!host`, `nonexistent > 1`, `lower(latency)`, `extract(host, "(")`, `if(host, 1, 2)`} {
+		e, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", src, err)
+		}
+		if _, err := e.Eval(env); err == nil {
+			t.Errorf("Eval(%q) should have failed", src)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	kinds := map[string]Kind{"latency": Number, "host": String, "ts": Time}
+	for _, tc := range []struct {
+		src  string
+		want Kind
+	}{
+		{`latency > 200 && host != "canary"`, Bool},
+		{`ts >= "2024-01-01" || false`, Bool},
+		{`host + "-" + lower(host)`, String},
+		{`(ts - ts) / 60 + len(host)`, Number},
+		{`if(latency > 1, host, "low")`, String},
+		{`number(host) * -latency`, Number},
+	} {
+		e, err := Parse(tc.src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.src, err)
+		}
+		if got, err := e.Check(kinds); err != nil || got != tc.want {
+			t.Errorf("Check(%q) = %v, %v; want %v", tc.src, got, err, tc.want)
+		}
+	}
+
+	// Unlike evaluating, checking doesn't short-circuit
+	for _, src := range []string{`latency > "1"`, `host + 1`, `latency =~ "1"`, `false && !host`, `nonexistent > 1`, `lower(latency)`, `if(true, host, 1)`, `ts < latency`} {
+		e, err := Parse(src)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", src, err)
+		}
+		if _, err := e.Check(kinds); err == nil {
+			t.Errorf("Check(%q) should have failed", src)
+		}
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	e, err := Parse(`a > 1 && (b == "x" || lower(c) < "3") && true`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.Identifiers(), []string{"a", "b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,241 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type function struct {
+	minArgs, maxArgs int
+	usage            string
+	params           []Kind // kinds of the arguments, or anyKind
+	result           Kind   // kind of the result, or anyKind for that of the second argument
+	call             func(n *call, args []Value) (Value, error)
+}
+
+// anyKind stands for values of any kind in function signatures.
+const anyKind Kind = -1
+
+// functions are the functions expressions can call.
+var functions = map[string]function{
+	"lower": {1, 1, "a string", []Kind{String}, String, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		return StringValue(strings.ToLower(s)), err
+	}},
+	"upper": {1, 1, "a string", []Kind{String}, String, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		return StringValue(strings.ToUpper(s)), err
+	}},
+	"trim": {1, 1, "a string", []Kind{String}, String, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		return StringValue(strings.TrimSpace(s)), err
+	}},
+	"len": {1, 1, "a string", []Kind{String}, Number, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		return NumberValue(float64(utf8.RuneCountInString(s))), err
+	}},
+	// substring(s, start[, length]) counts characters from 0, clamping to s
+	"substring": {2, 3, "a string, a start and optionally a length", []Kind{String, Number, Number}, String, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		if err != nil {
+			return Value{}, err
+		}
+		rs := []rune(s)
+		start, err := n.num(args, 1)
+		if err != nil {
+			return Value{}, err
+		}
+		end := float64(len(rs))
+		if len(args) > 2 {
+			length, err := n.num(args, 2)
+			if err != nil {
+				return Value{}, err
+			}
+			end = start + length
+		}
+		i, j := clamp(start, len(rs)), clamp(end, len(rs))
+		if j < i {
+			j = i
+		}
+		return StringValue(string(rs[i:j])), nil
+	}},
+	// extract(s, regex[, group]) returns the first match of the regex's group
+	// (by default its first one, if any), or "" if it doesn't match
+	"extract": {2, 3, "a string, a regular expression and optionally a group", []Kind{String, String, Number}, String, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		if err != nil {
+			return Value{}, err
+		}
+		re, err := n.regexp(args, 1)
+		if err != nil {
+			return Value{}, err
+		}
+		group := 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+		if len(args) > 2 {
+			g, err := n.num(args, 2)
+			if err != nil {
+				return Value{}, err
+			}
+			if group = int(g); group < 0 || group > re.NumSubexp() {
+				return Value{}, fmt.Errorf("extract: %v has no group %v", re, group)
+			}
+		}
+		m := re.FindStringSubmatchIndex(s)
+		if m == nil || m[2*group] < 0 {
+			return StringValue(""), nil
+		}
+		return StringValue(s[m[2*group]:m[2*group+1]]), nil
+	}},
+	// replace(s, regex, replacement) replaces all matches, expanding $1 etc.
+	"replace": {3, 3, "a string, a regular expression and a replacement", []Kind{String, String, String}, String, func(n *call, args []Value) (Value, error) {
+		s, err := n.str(args, 0)
+		if err != nil {
+			return Value{}, err
+		}
+		re, err := n.regexp(args, 1)
+		if err != nil {
+			return Value{}, err
+		}
+		repl, err := n.str(args, 2)
+		return StringValue(re.ReplaceAllString(s, repl)), err
+	}},
+	// number(x) converts strings (NaN if not numeric), bools and times (in
+	// seconds since the Unix epoch) to numbers
+	"number": {1, 1, "a value", []Kind{anyKind}, Number, func(n *call, args []Value) (Value, error) {
+		switch v := args[0]; v.Kind {
+		case String:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v.Str), 64)
+			if err != nil {
+				f = math.NaN()
+			}
+			return NumberValue(f), nil
+		case Time:
+			return NumberValue(float64(v.Time.UnixNano()) / 1e9), nil
+		case Bool:
+			if v.Bool {
+				return NumberValue(1), nil
+			}
+			return NumberValue(0), nil
+		default:
+			return v, nil
+		}
+	}},
+	"string": {1, 1, "a value", []Kind{anyKind}, String, func(n *call, args []Value) (Value, error) {
+		switch v := args[0]; v.Kind {
+		case String:
+			return v, nil
+		case Number:
+			return StringValue(strconv.FormatFloat(v.Num, 'f', -1, 64)), nil
+		default:
+			return StringValue(v.String()), nil
+		}
+	}},
+	"abs":   mathFunc(math.Abs),
+	"floor": mathFunc(math.Floor),
+	"ceil":  mathFunc(math.Ceil),
+	"sqrt":  mathFunc(math.Sqrt),
+	"log":   mathFunc(math.Log),
+	// round(x[, digits])
+	"round": {1, 2, "a number and optionally a number of decimal digits", []Kind{Number, Number}, Number, func(n *call, args []Value) (Value, error) {
+		x, err := n.num(args, 0)
+		if err != nil {
+			return Value{}, err
+		}
+		digits := 0.0
+		if len(args) > 1 {
+			if digits, err = n.num(args, 1); err != nil {
+				return Value{}, err
+			}
+		}
+		p := math.Pow(10, math.Trunc(digits))
+		return NumberValue(math.Round(x*p) / p), nil
+	}},
+	// if(condition, then, else)
+	"if": {3, 3, "a condition and two values", []Kind{Bool, anyKind, anyKind}, anyKind, func(n *call, args []Value) (Value, error) {
+		if args[0].Kind != Bool {
+			return Value{}, fmt.Errorf("if: condition must be a bool, not %v %v", args[0].Kind, args[0])
+		}
+		if args[0].Bool {
+			return args[1], nil
+		}
+		return args[2], nil
+	}},
+}
+
+func mathFunc(f func(float64) float64) function {
+	return function{1, 1, "a number", []Kind{Number}, Number, func(n *call, args []Value) (Value, error) {
+		x, err := n.num(args, 0)
+		return NumberValue(f(x)), err
+	}}
+}
+
+func clamp(f float64, n int) int {
+	switch {
+	case math.IsNaN(f) || f < 0:
+		return 0
+	case f > float64(n):
+		return n
+	}
+	return int(f)
+}
+
+// call is a call to a function.
+type call struct {
+	name    string
+	fn      function
+	args    []node
+	regexps map[string]*regexp.Regexp // compiled regular expression arguments
+}
+
+func (n *call) eval(env Env) (Value, error) {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return v, err
+		}
+		args[i] = v
+	}
+	return n.fn.call(n, args)
+}
+
+func (n *call) str(args []Value, i int) (string, error) {
+	if args[i].Kind != String {
+		return "", fmt.Errorf("%v: argument %v must be a string, not %v %v", n.name, i+1, args[i].Kind, args[i])
+	}
+	return args[i].Str, nil
+}
+
+func (n *call) num(args []Value, i int) (float64, error) {
+	if args[i].Kind != Number {
+		return 0, fmt.Errorf("%v: argument %v must be a number, not %v %v", n.name, i+1, args[i].Kind, args[i])
+	}
+	return args[i].Num, nil
+}
+
+// regexp compiles the i-th argument, caching it since it's usually a literal.
+func (n *call) regexp(args []Value, i int) (*regexp.Regexp, error) {
+	s, err := n.str(args, i)
+	if err != nil {
+		return nil, err
+	}
+	if re, ok := n.regexps[s]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", n.name, err)
+	}
+	if n.regexps == nil || len(n.regexps) > 100 {
+		n.regexps = make(map[string]*regexp.Regexp)
+	}
+	n.regexps[s] = re
+	return re, nil
+}
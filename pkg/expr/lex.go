@@ -0,0 +1,128 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokTime
+	tokIdent
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string // the source text, or the unquoted value of strings and quoted identifiers
+	pos  int
+}
+
+var (
+	timeLiteral   = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(?:[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:\d{2})?)?`)
+	numberLiteral = regexp.MustCompile(`^(?:\d+\.?\d*|\.\d+)(?:[eE][+-]?\d+)?`)
+	operators     = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "+", "-", "*", "/", "%"}
+)
+
+// lex splits an expression into tokens.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		rest := src[i:]
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+		case r == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+		case r == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+		case r == '"' || r == '\'' || r == '`':
+			s, n, err := unquote(rest)
+			if err != nil {
+				return nil, fmt.Errorf("at %v: %v", i, err)
+			}
+			kind := tokString
+			if r == '`' {
+				kind = tokIdent
+			}
+			tokens = append(tokens, token{kind, s, i})
+			i += n
+			continue
+		case timeLiteral.MatchString(rest):
+			s := timeLiteral.FindString(rest)
+			tokens = append(tokens, token{tokTime, s, i})
+			i += len(s)
+			continue
+		case r == '.' || unicode.IsDigit(r):
+			s := numberLiteral.FindString(rest)
+			if s == "" {
+				return nil, fmt.Errorf("at %v: unexpected %q", i, r)
+			}
+			tokens = append(tokens, token{tokNumber, s, i})
+			i += len(s)
+			continue
+		case isIdentStart(r):
+			n := strings.IndexFunc(rest, func(r rune) bool { return !isIdentStart(r) && !unicode.IsDigit(r) })
+			if n < 0 {
+				n = len(rest)
+			}
+			tokens = append(tokens, token{tokIdent, rest[:n], i})
+			i += n
+			continue
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(rest, o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("at %v: unexpected %q", i, r)
+			}
+			tokens = append(tokens, token{tokOp, op, i})
+			i += len(op)
+			continue
+		}
+		i += size
+	}
+	return append(tokens, token{tokEOF, "", len(src)}), nil
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+// unquote returns the value of the quoted string s starts with, and its length
+// in s. Backslashes only escape the quote itself, so that regexes like
+// "^web-\d+$" needn't double them.
+func unquote(s string) (string, int, error) {
+	q := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == q:
+			return b.String(), i + 1, nil
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == q:
+			b.WriteByte(q)
+			i++
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %v", s)
+}
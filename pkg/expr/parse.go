@@ -0,0 +1,167 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// precedence of binary operators; higher binds tighter.
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3, "=~": 3, "!~": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5, "%": 5,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	idents []string
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("at %v: unexpected %q", t.pos, t.text)
+}
+
+// parse parses binary operations of operators binding tighter than minPrec.
+func (p *parser) parse(minPrec int) (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec <= minPrec {
+			return x, nil
+		}
+		p.next()
+		y, err := p.parse(prec)
+		if err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "=~", "!~":
+			m := match{x: x, pattern: y, negate: t.text == "!~"}
+			if l, ok := y.(literal); ok && l.v.Kind == String {
+				if m.re, err = regexp.Compile(l.v.Str); err != nil {
+					return nil, err
+				}
+			}
+			x = m
+		default:
+			x = binary{op: t.text, x: x, y: y}
+		}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if t := p.peek(); t.kind == tokOp && (t.text == "!" || t.text == "-") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op: t.text, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("at %v: invalid number %v", t.pos, t.text)
+		}
+		return literal{NumberValue(f)}, nil
+	case tokString:
+		return literal{StringValue(t.text)}, nil
+	case tokTime:
+		ts := ParseTime(t.text)
+		if ts.IsZero() {
+			return nil, fmt.Errorf("at %v: invalid timestamp %v", t.pos, t.text)
+		}
+		return literal{TimeValue(ts)}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return literal{BoolValue(t.text == "true")}, nil
+		}
+		if p.peek().kind == tokLParen {
+			return p.call(t)
+		}
+		p.addIdent(t.text)
+		return ident{t.text}, nil
+	case tokLParen:
+		x, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokRParen {
+			return nil, p.unexpected()
+		}
+		p.next()
+		return x, nil
+	}
+	if t.kind != tokEOF {
+		p.pos--
+	}
+	return nil, p.unexpected()
+}
+
+// call parses the arguments of a call to the named function.
+func (p *parser) call(name token) (node, error) {
+	fn, ok := functions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("at %v: unknown function %v", name.pos, name.text)
+	}
+	p.next()
+	n := &call{name: name.text, fn: fn}
+	for p.peek().kind != tokRParen {
+		if len(n.args) > 0 {
+			if p.peek().kind != tokComma {
+				return nil, p.unexpected()
+			}
+			p.next()
+		}
+		arg, err := p.parse(0)
+		if err != nil {
+			return nil, err
+		}
+		n.args = append(n.args, arg)
+	}
+	p.next()
+	if len(n.args) < fn.minArgs || len(n.args) > fn.maxArgs {
+		return nil, fmt.Errorf("at %v: %v takes %v", name.pos, name.text, fn.usage)
+	}
+	return n, nil
+}
+
+func (p *parser) addIdent(name string) {
+	for _, n := range p.idents {
+		if n == name {
+			return
+		}
+	}
+	p.idents = append(p.idents, name)
+}
@@ -19,7 +19,7 @@ func (f *FileInput) Stream() (<-chan []byte, error) {
 		return nil, err
 	}
 
-	out := make(chan []byte)
+	out := make(chan []byte, bufferSize)
 	go func() {
 		defer close(out)
 		defer file.Close()
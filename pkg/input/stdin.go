@@ -6,6 +6,9 @@ import (
 	"os"
 )
 
+// bufferSize is the number of lines an input may read ahead of the parser.
+const bufferSize = 1024
+
 type StdinInput struct {
 	reader io.Reader
 }
@@ -19,7 +22,7 @@ func NewReaderInput(r io.Reader) *StdinInput {
 }
 
 func (s *StdinInput) Stream() (<-chan []byte, error) {
-	out := make(chan []byte)
+	out := make(chan []byte, bufferSize)
 	go func() {
 		defer close(out)
 		scanner := bufio.NewScanner(s.reader)
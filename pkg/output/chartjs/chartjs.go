@@ -5,10 +5,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"os"
 	"sort"
 	"strings"
+	"time"
 
 	chartDataset "github.com/marianogappa/ch/dataset"
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
 )
 
 // ChartJS allows building an HTML/Javascript Chart.js chart from a given dataset
@@ -19,12 +24,18 @@ type ChartJS struct {
 // Options is a container for ChartJS configurations; basically anything that is not
 // the datapoints themselves or the chart type. All are optional.
 type Options struct {
-	Title     string    // Chart title
-	ScaleType ScaleType // One of {Linear|Logarithmic}
-	XLabel    string    // X-Axis Label
-	YLabel    string    // Y-Axis Label
-	ZeroBased bool      // Should the chart's Y-Axis start at zero
-	ColorType ColorType // One of {DefaultColor|LegacyColor|Gradient}
+	Title      string          // Chart title
+	ScaleType  ScaleType       // One of {Linear|Logarithmic}
+	XLabel     string          // X-Axis Label
+	YLabel     string          // Y-Axis Label
+	ZeroBased  bool            // Should the chart's Y-Axis start at zero
+	ColorType  ColorType       // One of {DefaultColor|LegacyColor|Gradient}
+	Series     []string        // Names of the float columns, labelling their datasets
+	Roles      []ch.ColumnRole // Roles of the float columns, styling forecasts as such
+	Trendlines []stats.Fitter  // Regressions drawn over each dataset of scatter and scatterline charts
+	Anomalies  [][]bool        // Whether each row's float columns are outliers, to highlight them
+	Fitted     []trendline     // Trendlines fitted beforehand, e.g. over rows that were then downsampled
+	Sorted     bool            // Keep the order of the rows and series rather than sorting them
 }
 
 // New constructs a new ChartJS instance
@@ -35,21 +46,27 @@ func New(chartType ChartType, ds chartDataset.Dataset, opts Options) ChartJS {
 	}
 
 	var d = dataset{
-		ChartType: chartType.String(),
-		FSS:       ds.FSS,
-		SSS:       ds.SSS,
-		TSS:       ds.TSS,
-		Title:     opts.Title,
-		ScaleType: opts.ScaleType.String(),
-		XLabel:    opts.XLabel,
-		YLabel:    opts.YLabel,
-		ZeroBased: opts.ZeroBased,
-		ColorType: int(opts.ColorType),
+		ChartType:  chartType.String(),
+		FSS:        ds.FSS,
+		SSS:        ds.SSS,
+		TSS:        ds.TSS,
+		Title:      opts.Title,
+		ScaleType:  opts.ScaleType.String(),
+		XLabel:     opts.XLabel,
+		YLabel:     opts.YLabel,
+		ZeroBased:  opts.ZeroBased,
+		ColorType:  int(opts.ColorType),
+		Series:     opts.Series,
+		Roles:      opts.Roles,
+		Trendlines: opts.Trendlines,
+		Fitted:     opts.Fitted,
+		Anomalies:  opts.Anomalies,
+		Sorted:     opts.Sorted,
 	}
 
 	d.MinFSS, d.MaxFSS = calculateMinMaxFSS(ds.FSS)
 
-	if chartType == Line && d.canBeScatterLine() {
+	if chartType == Line && d.canBeScatterLine() && !d.Sorted {
 		sort.Sort(&d)
 	}
 
@@ -148,11 +165,29 @@ type cjsDataset struct {
 	Fill            bool
 	Label           string
 	BorderColor     string
+	Type            string // overrides the chart's type, e.g. to draw lines over a scatter
+	Dashed          bool
+	HidePoints      bool
+	FillTo          string // e.g. "-1" to fill the area down to the previous dataset
+	Anomalies       []int  // indices of the points that are outliers
+	PointColors     string // comma-separated colors of each point
+	PointRadii      string // comma-separated radii of each point
+}
+
+// AnomalyIndices returns the indices of the dataset's outliers as a
+// Javascript array's elements.
+func (d cjsDataset) AnomalyIndices() string {
+	is := make([]string, len(d.Anomalies))
+	for i, a := range d.Anomalies {
+		is[i] = fmt.Sprint(a)
+	}
+	return strings.Join(is, ",")
 }
 
 type cjsDataPoint struct {
 	X, Y, R string
 	UsesR   bool
+	x, y    float64 // X and Y as numbers, times being in Unix seconds
 }
 
 func (c ChartJS) prepareTemplateData() cjsData {
@@ -164,6 +199,12 @@ func (c ChartJS) prepareTemplateData() cjsData {
 	d.YLabel = c.data.YLabel
 	d.ZeroBased = c.data.ZeroBased
 	d.TooltipCallback = c.tooltipCallback()
+	fitted := c.data.Fitted
+	if fitted == nil {
+		fitted = c.fitTrendlines(d)
+	}
+	d.Datasets = append(d.Datasets, trendlineDatasets(d, fitted)...)
+	highlightAnomalies(&d)
 
 	return d
 }
@@ -198,6 +239,7 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 					Fill:            true,
 					SimpleData:      c.marshalSimpleData(0),
 					BackgroundColor: colorFirstN(c.data.ColorType, len(c.data.FSS)),
+					Anomalies:       c.data.anomalies(0),
 				}},
 			}
 		}
@@ -205,9 +247,10 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 		for i := range c.data.FSS[0] {
 			ds = append(ds, cjsDataset{
 				Fill:            true,
-				Label:           fmt.Sprintf("category %v", i),
+				Label:           c.data.seriesLabel(i, i),
 				SimpleData:      c.marshalSimpleData(i),
 				BackgroundColor: colorRepeat(c.data.ColorType, i, len(c.data.FSS)),
+				Anomalies:       c.data.anomalies(i),
 			})
 		}
 		return cjsData{
@@ -221,10 +264,11 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 		for i := range c.data.FSS[0] {
 			ds = append(ds, cjsDataset{
 				Fill:            false,
-				Label:           fmt.Sprintf("category %v", i),
+				Label:           c.data.seriesLabel(i, i),
 				SimpleData:      c.marshalSimpleData(i),
 				BorderColor:     colorIndex(c.data.ColorType, i),
 				BackgroundColor: colorIndex(c.data.ColorType, i),
+				Anomalies:       c.data.anomalies(i),
 			})
 		}
 		return cjsData{
@@ -237,30 +281,39 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 		dss := []cjsDataset{}
 	outerLoop:
 		for n := range c.data.FSS[0] {
-			ds := []cjsDataPoint{}
+			var (
+				ds        = []cjsDataPoint{}
+				col       = scatterLineColumn(n, c.data.hasTimes())
+				anomalies []int
+			)
 			for i := range c.data.FSS {
 				d := cjsDataPoint{}
 				if c.data.hasTimes() {
 					usesTimeScale = true
-					d.X = "'" + c.data.TSS[i][0].Format("2006-01-02T15:04:05.999999999") + "'"
-					d.Y = fmt.Sprintf("%g", c.data.FSS[i][n])
+					d.X, d.x = marshalTime(c.data.TSS[i][0])
+					d.Y, d.y = fmt.Sprintf("%g", c.data.FSS[i][n]), c.data.FSS[i][n]
 				} else {
 					if n == len(c.data.FSS[0])-1 {
 						break outerLoop
 					}
-					d.X = fmt.Sprintf("%g", c.data.FSS[i][0])
-					d.Y = fmt.Sprintf("%g", c.data.FSS[i][n+1])
+					d.X, d.x = fmt.Sprintf("%g", c.data.FSS[i][0]), c.data.FSS[i][0]
+					d.Y, d.y = fmt.Sprintf("%g", c.data.FSS[i][n+1]), c.data.FSS[i][n+1]
+				}
+				if c.data.isAnomaly(i, col) {
+					anomalies = append(anomalies, len(ds))
 				}
 				ds = append(ds, d)
 			}
 			dss = append(dss, cjsDataset{
 				Fill:            false,
-				Label:           fmt.Sprintf("category %v", n),
+				Label:           c.data.seriesLabel(n, col),
 				ComplexData:     ds,
 				BorderColor:     colorIndex(c.data.ColorType, n),
 				BackgroundColor: colorIndex(c.data.ColorType, n),
+				Anomalies:       anomalies,
 			})
 		}
+		c.styleForecasts(dss)
 		return cjsData{
 			ChartType:       "line",
 			ActualChartType: "scatterline",
@@ -268,44 +321,47 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 			UsesTimeScale:   usesTimeScale,
 		}
 	case "denormalised-scatterline":
-		mdss := map[string]cjsDataset{}
+		var (
+			mdss  = map[string]cjsDataset{}
+			order []string // of the series' first appearance
+		)
 		for i := range c.data.FSS {
 			d := cjsDataPoint{}
 			if c.data.hasTimes() {
 				usesTimeScale = true
-				d.X = "'" + c.data.TSS[i][0].Format("2006-01-02T15:04:05.999999999") + "'"
-				d.Y = fmt.Sprintf("%g", c.data.FSS[i][0])
+				d.X, d.x = marshalTime(c.data.TSS[i][0])
+				d.Y, d.y = fmt.Sprintf("%g", c.data.FSS[i][0]), c.data.FSS[i][0]
 			} else {
-				d.X = fmt.Sprintf("%g", c.data.FSS[i][0])
-				d.Y = fmt.Sprintf("%g", c.data.FSS[i][1])
+				d.X, d.x = fmt.Sprintf("%g", c.data.FSS[i][0]), c.data.FSS[i][0]
+				d.Y, d.y = fmt.Sprintf("%g", c.data.FSS[i][1]), c.data.FSS[i][1]
 			}
 			ds := c.data.SSS[i][0]
 			if _, ok := mdss[ds]; !ok {
+				order = append(order, ds)
 				mdss[ds] = cjsDataset{
 					Fill:            false,
 					Label:           ds,
-					ComplexData:     []cjsDataPoint{d},
 					BorderColor:     colorIndex(c.data.ColorType, len(mdss)),
 					BackgroundColor: colorIndex(c.data.ColorType, len(mdss)),
 				}
-			} else {
-				m := mdss[ds]
-				m.ComplexData = append(m.ComplexData, d)
-				mdss[ds] = m
 			}
+			m := mdss[ds]
+			if c.data.isAnomaly(i, scatterYColumn(c.data.hasTimes())) {
+				m.Anomalies = append(m.Anomalies, len(m.ComplexData))
+			}
+			m.ComplexData = append(m.ComplexData, d)
+			mdss[ds] = m
 		}
 
-		var (
-			dss = make([]cjsDataset, len(mdss))
-			i   = 0
-		)
-		for _, v := range mdss {
-			dss[i] = v
-			i++
+		dss := make([]cjsDataset, len(order))
+		for i, ds := range order {
+			dss[i] = mdss[ds]
+		}
+		if !c.data.Sorted {
+			sort.Slice(dss, func(i, j int) bool { // https://github.com/marianogappa/ch/issues/33
+				return dss[i].Label < dss[j].Label
+			})
 		}
-		sort.Slice(dss, func(i, j int) bool { // https://github.com/marianogappa/ch/issues/33
-			return dss[i].Label < dss[j].Label
-		})
 		return cjsData{
 			ChartType:       "line",
 			ActualChartType: "scatterline",
@@ -350,18 +406,18 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 			d := cjsDataPoint{UsesR: true}
 			if c.data.hasTimes() {
 				usesTimeScale = true
-				d.X = "'" + c.data.TSS[i][0].Format("2006-01-02T15:04:05.999999999") + "'"
-				d.Y = fmt.Sprintf("%g", c.data.FSS[i][0])
+				d.X, d.x = marshalTime(c.data.TSS[i][0])
+				d.Y, d.y = fmt.Sprintf("%g", c.data.FSS[i][0]), c.data.FSS[i][0]
 				if len(c.data.FSS[i]) >= 2 {
 					d.R = fmt.Sprintf("%v", scatterRadius(c.data.FSS[i][1], c.data.MinFSS[1], c.data.MaxFSS[1]))
 				} else {
 					d.R = fmt.Sprintf("%v", 4)
 				}
 			} else {
-				d.X = fmt.Sprintf("%g", c.data.FSS[i][0])
+				d.X, d.x = fmt.Sprintf("%g", c.data.FSS[i][0]), c.data.FSS[i][0]
 				d.Y = "0"
 				if len(c.data.FSS[i]) >= 2 {
-					d.Y = fmt.Sprintf("%g", c.data.FSS[i][1])
+					d.Y, d.y = fmt.Sprintf("%g", c.data.FSS[i][1]), c.data.FSS[i][1]
 				}
 				if len(c.data.FSS[i]) >= 3 {
 					d.R = fmt.Sprintf("%v", scatterRadius(c.data.FSS[i][2], c.data.MinFSS[2], c.data.MaxFSS[2]))
@@ -373,6 +429,9 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 			if c.data.hasStrings() {
 				j = css[c.data.SSS[i][0]]
 			}
+			if c.data.isAnomaly(i, scatterYColumn(c.data.hasTimes())) {
+				dss[j].Anomalies = append(dss[j].Anomalies, len(dss[j].ComplexData))
+			}
 			cd := dss[j].ComplexData
 			cd = append(cd, d)
 			dss[j].ComplexData = cd
@@ -389,6 +448,193 @@ func (c ChartJS) prepareLabelsAndDatasets() cjsData {
 	}
 }
 
+// scatterLineColumn returns the float column plotted by the n-th dataset of a
+// scatterline chart, which is the first one's function if there are no times.
+func scatterLineColumn(n int, hasTimes bool) int {
+	if hasTimes {
+		return n
+	}
+	return n + 1
+}
+
+// scatterYColumn returns the float column that is the y of scatter charts
+// and denormalised scatterlines.
+func scatterYColumn(hasTimes bool) int {
+	if hasTimes {
+		return 0
+	}
+	return 1
+}
+
+// anomalyColor highlights outliers.
+const anomalyColor = `"#ff0000"`
+
+// highlightAnomalies colors the datasets' outliers, which are also listed in
+// their tooltips.
+func highlightAnomalies(d *cjsData) {
+	var highlighted bool
+	for i := range d.Datasets {
+		ds := &d.Datasets[i]
+		if len(ds.Anomalies) == 0 {
+			continue
+		}
+		highlighted = true
+		n := max(len(ds.SimpleData), len(ds.ComplexData))
+		colors, radii := make([]string, n), make([]string, n)
+		if d.ChartType == "bar" {
+			copy(colors, strings.Split(strings.TrimSuffix(ds.BackgroundColor, ","), ","))
+		}
+		for j := range colors {
+			if colors[j] == "" {
+				colors[j] = ds.BorderColor
+			}
+			radii[j] = "3"
+		}
+		for _, j := range ds.Anomalies {
+			colors[j], radii[j] = anomalyColor, "6"
+		}
+		switch d.ChartType {
+		case "bar":
+			ds.BackgroundColor = strings.Join(colors, ",")
+		case "bubble":
+			ds.BackgroundColor = "[" + strings.Join(colors, ",") + "]"
+		default:
+			ds.PointColors, ds.PointRadii = strings.Join(colors, ","), strings.Join(radii, ",")
+		}
+	}
+	if highlighted {
+		d.TooltipCallback = `
+                    var label = (function() {` + d.TooltipCallback + `})();
+                    var anomalies = data.datasets[tti.datasetIndex].anomalies;
+                    return anomalies && anomalies.indexOf(tti.index) >= 0 ? label + ' (anomaly)' : label;
+    `
+	}
+}
+
+// styleForecasts draws the datasets of a scatterline chart's forecast
+// columns as a dashed continuation of the forecasted column's, within a
+// shaded confidence band, all in its color.
+func (c ChartJS) styleForecasts(dss []cjsDataset) {
+	hasTimes := c.data.hasTimes()
+	column := func(n int) (string, ch.ColumnRole) {
+		col := scatterLineColumn(n, hasTimes)
+		var role ch.ColumnRole
+		if col < len(c.data.Roles) {
+			role = c.data.Roles[col]
+		}
+		if col < len(c.data.Series) {
+			return c.data.Series[col], role
+		}
+		return "", role
+	}
+	for n := range dss {
+		_, role := column(n)
+		if role.Role != ch.RoleForecast && role.Role != ch.RoleForecastLower && role.Role != ch.RoleForecastUpper {
+			continue
+		}
+		color := dss[n].BorderColor
+		for m := range dss {
+			if name, _ := column(m); name == role.Of {
+				color = dss[m].BorderColor
+			}
+		}
+		dss[n].BorderColor, dss[n].BackgroundColor = color, color
+		switch role.Role {
+		case ch.RoleForecast:
+			dss[n].Dashed = true
+		case ch.RoleForecastLower:
+			dss[n].BorderColor, dss[n].HidePoints = colorAlpha(color, "66"), true
+		case ch.RoleForecastUpper:
+			dss[n].BorderColor, dss[n].HidePoints = colorAlpha(color, "66"), true
+			dss[n].BackgroundColor, dss[n].FillTo = colorAlpha(color, "33"), "-1"
+		}
+	}
+}
+
+// marshalTime returns a time as a Javascript string and as Unix seconds.
+func marshalTime(t time.Time) (string, float64) {
+	return "'" + t.Format("2006-01-02T15:04:05.999999999") + "'", float64(t.UnixNano()) / 1e9
+}
+
+// trendlinePoints is the number of points drawing each trendline.
+const trendlinePoints = 100
+
+// trendline is a regression fitted over the points of a dataset.
+type trendline struct {
+	series string // the fitted dataset's label
+	label  string
+	points []cjsDataPoint
+}
+
+// fitTrendlines fits each trendline over each dataset of a scatter or
+// scatterline chart, labelled with the fit's equation and R². It returns nil
+// only if there are no trendlines to fit.
+func (c ChartJS) fitTrendlines(d cjsData) []trendline {
+	if len(c.data.Trendlines) == 0 {
+		return nil
+	}
+	if d.ActualChartType != "scatter" && d.ActualChartType != "scatterline" {
+		fmt.Fprintf(os.Stderr, "Warning: trendlines only apply to scatter and scatterline charts\n")
+		return []trendline{}
+	}
+	tls := []trendline{}
+	for _, ds := range d.Datasets {
+		if len(ds.ComplexData) == 0 {
+			continue
+		}
+		xs, ys := make([]float64, len(ds.ComplexData)), make([]float64, len(ds.ComplexData))
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for i, p := range ds.ComplexData {
+			xs[i], ys[i] = p.x, p.y
+			lo, hi = math.Min(lo, p.x), math.Max(hi, p.x)
+		}
+		for _, fitter := range c.data.Trendlines {
+			fit, err := fitter(xs, ys)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: can't draw a trendline over %q: %v\n", ds.Label, err)
+				continue
+			}
+			tl := trendline{series: ds.Label, label: fmt.Sprintf("%v: %v, R² = %.3f", fit.Name, fit.Equation, fit.R2)}
+			if d.UsesTimeScale {
+				tl.label += " (x in Unix seconds)"
+			}
+			for i := 0; i < trendlinePoints; i++ {
+				x := lo + (hi-lo)*float64(i)/(trendlinePoints-1)
+				y := fit.At(x)
+				if math.IsNaN(y) || math.IsInf(y, 0) {
+					continue
+				}
+				p := cjsDataPoint{X: fmt.Sprintf("%g", x), Y: fmt.Sprintf("%g", y)}
+				if d.UsesTimeScale {
+					p.X, _ = marshalTime(time.Unix(0, int64(x*1e9)))
+				}
+				tl.points = append(tl.points, p)
+			}
+			tls = append(tls, tl)
+		}
+	}
+	return tls
+}
+
+// trendlineDatasets returns a dataset drawing each trendline in the color of
+// the dataset it was fitted over.
+func trendlineDatasets(d cjsData, tls []trendline) []cjsDataset {
+	var tds []cjsDataset
+	for _, tl := range tls {
+		td := cjsDataset{Label: tl.label, Type: "line", Dashed: true, HidePoints: true, ComplexData: tl.points}
+		for _, ds := range d.Datasets {
+			if ds.Label == tl.series {
+				td.BorderColor = ds.BorderColor
+			}
+		}
+		if len(d.Datasets) > 1 {
+			td.Label = tl.series + " " + td.Label
+		}
+		tds = append(tds, td)
+	}
+	return tds
+}
+
 func (c ChartJS) marshalLabels() string {
 	if !c.data.hasStrings() && c.data.hasTimes() {
 		ls := make([]string, len(c.data.TSS))
@@ -504,6 +750,7 @@ func preprocessLabel(s string) string {
 	}
 	s = strings.Replace(s, `${`, `\${`, -1)
 	s = strings.Replace(s, "`", "\\`", -1)
+	s = strings.Replace(s, "<", `\x3C`, -1) // so that e.g. </script> doesn't end the script
 	return "`" + s + "`"
 }
 
@@ -107,6 +107,10 @@ func TestPreprocessLabel(t *testing.T) {
 			s:        "he${llo",
 			expected: "`he\\${llo`",
 		},
+		{
+			s:        "</script>",
+			expected: "`\\x3C/script>`",
+		},
 	}
 
 	for _, ts := range tests {
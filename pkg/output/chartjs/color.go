@@ -65,3 +65,9 @@ func colorFirstN(i, n int) string {
 func colorRepeat(i, j, n int) string {
 	return strings.Repeat(colorIndex(i, j)+",", n)
 }
+
+// colorAlpha makes a palette color translucent with the given hex alpha, e.g.
+// "33" for 20% opacity.
+func colorAlpha(color, alpha string) string {
+	return strings.TrimSuffix(color, `"`) + alpha + `"`
+}
@@ -1,6 +1,14 @@
 package chartjs
 
-import "time"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+)
 
 type dataset struct {
 	ChartType string
@@ -15,6 +23,13 @@ type dataset struct {
 	YLabel    string
 	ZeroBased bool
 	ColorType int
+	Series    []string
+	Roles     []ch.ColumnRole
+
+	Trendlines []stats.Fitter
+	Fitted     []trendline // Trendlines fitted beforehand, e.g. over rows that were then downsampled
+	Anomalies  [][]bool
+	Sorted     bool
 }
 
 func (d dataset) Len() int {
@@ -41,6 +56,41 @@ func (d dataset) Swap(i, j int) {
 	if d.SSS != nil {
 		d.SSS[i], d.SSS[j] = d.SSS[j], d.SSS[i]
 	}
+	if d.Anomalies != nil {
+		d.Anomalies[i], d.Anomalies[j] = d.Anomalies[j], d.Anomalies[i]
+	}
+}
+
+// isAnomaly returns whether the given row's float column is an outlier.
+func (d dataset) isAnomaly(row, col int) bool {
+	return row < len(d.Anomalies) && col < len(d.Anomalies[row]) && d.Anomalies[row][col]
+}
+
+// anomalies returns the rows whose given float column is an outlier.
+func (d dataset) anomalies(col int) []int {
+	var rows []int
+	for i := range d.Anomalies {
+		if d.isAnomaly(i, col) {
+			rows = append(rows, i)
+		}
+	}
+	return rows
+}
+
+// seriesLabel labels the n-th dataset, which plots the given float column,
+// with the column's name if it's known.
+func (d dataset) seriesLabel(n, col int) string {
+	if col < len(d.Series) && d.Series[col] != "" && !isPlaceholder(d.Series[col]) {
+		return d.Series[col]
+	}
+	return fmt.Sprintf("category %v", n)
+}
+
+// isPlaceholder returns whether a column name is a `$N` placeholder of an
+// input without a header.
+func isPlaceholder(name string) bool {
+	_, err := strconv.Atoi(strings.TrimPrefix(name, "$"))
+	return err == nil && strings.HasPrefix(name, "$")
 }
 
 func (d dataset) hasFloats() bool  { return len(d.FSS) > 0 }
@@ -4,11 +4,13 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"sort"
+	"strings"
 	"time"
 
 	chdataset "github.com/marianogappa/ch/dataset"
 	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+	"github.com/marianogappa/ch/pkg/transform"
 	"github.com/skratchdot/open-golang/open"
 )
 
@@ -34,6 +36,9 @@ type ChartJSConfig struct {
 	ChartType string
 	ScaleType string
 	ColorType string
+	Trendline string
+
+	DownsampleThreshold int
 }
 
 func (o *ChartJSOutput) RegisterFlags(fs *flag.FlagSet) any {
@@ -45,6 +50,8 @@ func (o *ChartJSOutput) RegisterFlags(fs *flag.FlagSet) any {
 	fs.StringVar(&c.ChartType, "chart-type", "line", "Chart type: line, bar, pie, scatter.") // Renamed from implicit arg
 	fs.StringVar(&c.ScaleType, "scale", "linear", "Scale type: linear, logarithmic.")
 	fs.StringVar(&c.ColorType, "color", "default", "Color type: default, legacy, gradient.")
+	fs.StringVar(&c.Trendline, "trendline", "", "Comma-separated regressions drawn over scatter and scatterline charts: linear, poly[:degree], exp, loess[:span].")
+	fs.IntVar(&c.DownsampleThreshold, "downsample-threshold", 10000, "Line and scatter charts of more rows are downsampled to this many, keeping their peaks (0 disables).")
 	return c
 }
 
@@ -60,81 +67,85 @@ func (o *ChartJSOutput) Render(rows <-chan ch.Row, config any) error {
 	if !ok {
 		return fmt.Errorf("invalid config type for ChartJSOutput")
 	}
-
-	// Buffer all rows to build a Dataset
-	// This is a bridge between streaming architecture and legacy Dataset struct
-	ds := &chdataset.Dataset{
-		FSS: make([][]float64, 0),
-		SSS: make([][]string, 0),
-		TSS: make([][]time.Time, 0),
+	trendlines, err := parseTrendlines(cfg.Trendline)
+	if err != nil {
+		return err
 	}
 
-	for row := range rows {
-		ds.FSS = append(ds.FSS, row.Floats)
-		ds.SSS = append(ds.SSS, row.Strings)
+	// If we have strings but no floats, we probably want to count frequencies
+	first, ok := <-rows
+	rows = unread(first, ok, rows)
+	counted := ok && len(first.Floats) == 0 && len(first.Strings) > 0
+	if counted {
+		rows = transform.CountFrequencies(rows)
+	}
 
-		ts := make([]time.Time, 0)
-		for _, dStr := range row.DateTimes {
-			// Try to parse with a few common formats if possible, or just use a default
-			// For now, we rely on the fact that if it was parsed as DateTime, it should be parseable.
-			// But we don't have the format here.
-			// TODO: Pass format or parsed time in Row.
-			t, _ := time.Parse("2006-01-02", dStr) // minimal assumption
-			ts = append(ts, t)
-		}
-		ds.TSS = append(ds.TSS, ts)
+	// Default to bar chart for frequency counts and histogram bins if not specified
+	if (counted || ok && transform.IsBinned(first.Schema)) && cfg.ChartType == "line" { // "line" is the default in RegisterFlags
+		cfg.ChartType = "bar"
 	}
 
-	// If we have strings but no floats, we probably want to count frequencies
-	if len(ds.FSS) > 0 && len(ds.FSS[0]) == 0 && len(ds.SSS) > 0 && len(ds.SSS[0]) > 0 {
-		counts := make(map[string]float64)
-		for _, ss := range ds.SSS {
-			if len(ss) > 0 {
-				counts[ss[0]]++
+	var (
+		schema   *ch.Schema
+		buffered []ch.Row
+	)
+	for row := range rows {
+		if row.Schema != schema {
+			// Rows of different shapes can't be charted together, so start over
+			if schema != nil {
+				fmt.Fprintf(os.Stderr, "Warning: input schema changed to %v; charting only rows from then on\n", row.Schema)
+				buffered = buffered[:0]
 			}
+			schema = row.Schema
 		}
+		buffered = append(buffered, row)
+	}
 
-		// Rebuild dataset with counts
-		ds.FSS = make([][]float64, 0, len(counts))
-		ds.SSS = make([][]string, 0, len(counts))
+	// Anomaly flags highlight the points of the columns they flag rather than
+	// being charted themselves
+	charted, flags := anomalyFlags(schema)
 
-		// Sort by count descending for better visualization
-		type kv struct {
-			Key   string
-			Value float64
-		}
-		var ss []kv
-		for k, v := range counts {
-			ss = append(ss, kv{k, v})
-		}
-		sort.Slice(ss, func(i, j int) bool {
-			return ss[i].Value > ss[j].Value
-		})
+	cOpts := Options{
+		Title:      cfg.Title,
+		ScaleType:  NewScaleType(cfg.ScaleType),
+		XLabel:     cfg.XLabel,
+		YLabel:     cfg.YLabel,
+		ZeroBased:  cfg.ZeroBased,
+		ColorType:  NewColorType(cfg.ColorType),
+		Series:     seriesNames(schema, charted),
+		Roles:      seriesRoles(schema, charted),
+		Trendlines: trendlines,
+		Sorted:     schema != nil && schema.Sorted,
+	}
 
-		for _, kv := range ss {
-			ds.FSS = append(ds.FSS, []float64{kv.Value})
-			ds.SSS = append(ds.SSS, []string{kv.Key})
+	// Huge line and scatter charts freeze browsers, so keep only their shape,
+	// but fit trendlines over all of the rows
+	var fitted []trendline
+	if n := cfg.DownsampleThreshold; n > 0 && len(buffered) > n && (cfg.ChartType == "line" || cfg.ChartType == "scatter") {
+		if len(trendlines) > 0 {
+			ds, anomalies := toDataset(buffered, charted, flags, false)
+			opts := cOpts
+			opts.Anomalies = anomalies
+			full := New(NewChartType(cfg.ChartType), ds, opts)
+			fitted = full.fitTrendlines(full.prepareLabelsAndDatasets())
 		}
-
-		// Default to bar chart for frequency counts if not specified
-		if cfg.ChartType == "line" { // "line" is the default in RegisterFlags
-			cfg.ChartType = "bar"
+		if downsampled := transform.Downsample(buffered, n, transform.DownsampleLTTB); len(downsampled) < len(buffered) {
+			fmt.Fprintf(os.Stderr, "Downsampled %v rows to %v; see --downsample-threshold\n", len(buffered), len(downsampled))
+			buffered = downsampled
 		}
 	}
 
-	cOpts := Options{
-		Title:     cfg.Title,
-		ScaleType: NewScaleType(cfg.ScaleType),
-		XLabel:    cfg.XLabel,
-		YLabel:    cfg.YLabel,
-		ZeroBased: cfg.ZeroBased,
-		ColorType: NewColorType(cfg.ColorType),
-	}
+	// Build the Dataset from the rows, releasing them as they're added so that
+	// they aren't held twice
+	// This is a bridge between streaming architecture and legacy Dataset struct
+	ds, anomalies := toDataset(buffered, charted, flags, true)
+	cOpts.Anomalies = anomalies
+	cOpts.Fitted = fitted
 
 	// Now use the legacy chartjs package
 	c := New(
 		NewChartType(cfg.ChartType),
-		*ds,
+		ds,
 		cOpts,
 	)
 
@@ -165,4 +176,166 @@ func (o *ChartJSOutput) Render(rows <-chan ch.Row, config any) error {
 	return openBrowser(htmlPath)
 }
 
+// toDataset returns the rows as a Dataset of their charted float columns,
+// and which of those are flagged as anomalies. If release is set, the rows
+// are zeroed as they're added, so that they can be garbage collected.
+func toDataset(rows []ch.Row, charted []int, flags map[int]int, release bool) (chdataset.Dataset, [][]bool) {
+	ds := chdataset.Dataset{
+		FSS: make([][]float64, 0, len(rows)),
+		SSS: make([][]string, 0, len(rows)),
+		TSS: make([][]time.Time, 0, len(rows)),
+	}
+	var anomalies [][]bool
+	for n, row := range rows {
+		if release {
+			rows[n] = ch.Row{}
+		}
+		if flags != nil {
+			fs, as := make([]float64, len(charted)), make([]bool, len(charted))
+			for i, j := range charted {
+				if j < len(row.Floats) {
+					fs[i] = row.Floats[j]
+				}
+				if f, ok := flags[i]; ok && f < len(row.Floats) {
+					as[i] = row.Floats[f] == 1
+				}
+			}
+			row.Floats = fs
+			anomalies = append(anomalies, as)
+		}
+		if transform.IsBinned(row.Schema) {
+			label, count := transform.BinLabel(row)
+			row.Floats, row.Strings = []float64{count}, []string{label}
+		}
+		ds.FSS = append(ds.FSS, row.Floats)
+		ds.SSS = append(ds.SSS, row.Strings)
+
+		dateFormat := "2006-01-02" // minimal assumption when the schema is unknown
+		if row.Schema != nil && row.Schema.DateFormat != "" {
+			dateFormat = row.Schema.DateFormat
+		}
+		ts := make([]time.Time, 0)
+		for _, dStr := range row.DateTimes {
+			t, _ := time.Parse(dateFormat, dStr)
+			ts = append(ts, t)
+		}
+		ds.TSS = append(ds.TSS, ts)
+	}
+
+	// Like dataset.New, leave out columns of types no row has
+	if !hasFields(len(ds.FSS), func(i int) int { return len(ds.FSS[i]) }) {
+		ds.FSS = nil
+	}
+	if !hasFields(len(ds.SSS), func(i int) int { return len(ds.SSS[i]) }) {
+		ds.SSS = nil
+	}
+	if !hasFields(len(ds.TSS), func(i int) int { return len(ds.TSS[i]) }) {
+		ds.TSS = nil
+	}
+	return ds, anomalies
+}
+
+// parseTrendlines parses comma-separated regressions like "linear,loess:0.5".
+func parseTrendlines(spec string) ([]stats.Fitter, error) {
+	var fitters []stats.Fitter
+	for _, s := range strings.Split(spec, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		f, err := stats.ParseFitter(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --trendline: %w", err)
+		}
+		fitters = append(fitters, f)
+	}
+	return fitters, nil
+}
+
+// unread returns a channel that yields the given row, if ok, followed by the
+// rest of the rows.
+func unread(row ch.Row, ok bool, rows <-chan ch.Row) <-chan ch.Row {
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+		if ok {
+			out <- row
+		}
+		for row := range rows {
+			out <- row
+		}
+	}()
+	return out
+}
+
+// anomalyFlags returns the indices of the schema's float columns that are
+// charted, and for each one that is flagged by an anomaly column, the index
+// of the flag column. Both are nil if there are no flags.
+func anomalyFlags(s *ch.Schema) ([]int, map[int]int) {
+	if s == nil {
+		return nil, nil
+	}
+	var (
+		charted []int
+		flagOf  = make(map[string]int)
+	)
+	for j := range s.Floats {
+		if r := s.FloatRole(j); r.Role == ch.RoleAnomaly {
+			flagOf[r.Of] = j
+		} else {
+			charted = append(charted, j)
+		}
+	}
+	if len(flagOf) == 0 {
+		return nil, nil
+	}
+	flags := make(map[int]int)
+	for i, j := range charted {
+		if f, ok := flagOf[s.Floats[j]]; ok {
+			flags[i] = f
+		}
+	}
+	return charted, flags
+}
+
+// seriesRoles returns the roles of the schema's charted float columns (all
+// of them if charted is nil), if it's known.
+func seriesRoles(s *ch.Schema, charted []int) []ch.ColumnRole {
+	if s == nil {
+		return nil
+	}
+	if charted == nil {
+		return s.FloatRoles
+	}
+	roles := make([]ch.ColumnRole, len(charted))
+	for i, j := range charted {
+		roles[i] = s.FloatRole(j)
+	}
+	return roles
+}
+
+// seriesNames returns the names of the schema's charted float columns (all
+// of them if charted is nil), if it's known.
+func seriesNames(s *ch.Schema, charted []int) []string {
+	if s == nil {
+		return nil
+	}
+	if charted == nil {
+		return s.Floats
+	}
+	names := make([]string, len(charted))
+	for i, j := range charted {
+		names[i] = s.Floats[j]
+	}
+	return names
+}
+
+func hasFields(rows int, fieldsLen func(i int) int) bool {
+	for i := 0; i < rows; i++ {
+		if fieldsLen(i) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 var openBrowser = open.Run
@@ -2,11 +2,17 @@ package chartjs
 
 import (
 	"flag"
+	"fmt"
+	"math"
 	"os"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/parser"
+	"github.com/marianogappa/ch/pkg/stats"
+	"github.com/marianogappa/ch/pkg/transform"
 )
 
 func TestChartJSOutput(t *testing.T) {
@@ -95,3 +101,479 @@ func TestChartJSOutput_Frequency(t *testing.T) {
 		t.Error("Expected count 2 in output")
 	}
 }
+
+func TestChartJSOutput_SchemaChange(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// A column is added midway, so only rows from then on can be charted
+	before := &ch.Schema{Floats: []string{"$2"}, Strings: []string{"$1"}}
+	after := &ch.Schema{Floats: []string{"$2", "$3"}, Strings: []string{"$1"}}
+	rows := make(chan ch.Row, 3)
+	rows <- ch.Row{Floats: []float64{1}, Strings: []string{"stale-series"}, Schema: before}
+	rows <- ch.Row{Floats: []float64{2, 3}, Strings: []string{"after1"}, Schema: after}
+	rows <- ch.Row{Floats: []float64{4, 5}, Strings: []string{"after2"}, Schema: after}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	if strings.Contains(html, "stale-series") {
+		t.Error("Expected rows before the schema change to be dropped")
+	}
+	if !strings.Contains(html, "after1") || !strings.Contains(html, "after2") {
+		t.Error("Expected rows after the schema change in output")
+	}
+}
+
+func TestChartJSOutput_SeriesNames(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// Named float columns, e.g. pivoted series, label their datasets
+	schema := &ch.Schema{Floats: []string{"web-latency", "db-latency", "$4"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	rows := make(chan ch.Row, 2)
+	rows <- ch.Row{Floats: []float64{1, 2, 3}, DateTimes: []string{"2024-01-01"}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{4, 5, 6}, DateTimes: []string{"2024-01-02"}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	for _, label := range []string{"web-latency", "db-latency", "category 2"} {
+		if !strings.Contains(html, label) {
+			t.Errorf("Expected dataset label %q in output", label)
+		}
+	}
+}
+
+func TestChartJSOutput_EscapedLabels(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--x", "it's", "--title", "</script>"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// Headers and pivoted values end up in Javascript strings
+	schema := &ch.Schema{Floats: []string{"o'brien", "</script><script>alert(1)"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	rows := make(chan ch.Row, 1)
+	rows <- ch.Row{Floats: []float64{1, 2}, DateTimes: []string{"2024-01-01"}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	for _, want := range []string{`label: 'o\'brien'`, `labelString: 'it\'s'`, `label: '\u003C/script\u003E\u003Cscript\u003Ealert(1)'`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %q in output", want)
+		}
+	}
+	if strings.Contains(html, "</script><script>alert(1)") {
+		t.Error("Expected the labels not to end the script")
+	}
+}
+
+func TestChartJSOutput_Bins(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	schema := &ch.Schema{Floats: []string{transform.BinStart, transform.BinEnd, transform.BinCount}}
+	rows := make(chan ch.Row, 2)
+	rows <- ch.Row{Floats: []float64{0, 10, 3}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{10, 20, 5}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	if !strings.Contains(html, "type: 'bar'") {
+		t.Error("Expected a bar chart")
+	}
+	if !strings.Contains(html, "[0, 10)") || !strings.Contains(html, "[10, 20)") {
+		t.Error("Expected bars labelled by range in output")
+	}
+}
+
+func TestChartJSOutput_Downsample(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--downsample-threshold", "10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	schema := &ch.Schema{Floats: []string{"size", "runtime"}}
+	rows := make(chan ch.Row, 100)
+	for i := 0; i < 100; i++ {
+		y := 1.0
+		if i == 50 {
+			y = 999
+		}
+		rows <- ch.Row{Floats: []float64{float64(i), y}, Schema: schema}
+	}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	if n := strings.Count(html, "x: "); n < 3 || n > 10 {
+		t.Errorf("Expected at most 10 points, got %v", n)
+	}
+	if !strings.Contains(html, "y: 999") {
+		t.Error("Expected the peak to be kept")
+	}
+}
+
+func TestChartJSOutput_Trendline(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--chart-type", "scatter", "--trendline", "linear,loess"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	schema := &ch.Schema{Floats: []string{"size", "runtime"}}
+	rows := make(chan ch.Row, 10)
+	for i := 0; i < 10; i++ {
+		rows <- ch.Row{Floats: []float64{float64(i), 2*float64(i) + 1}, Schema: schema}
+	}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	// Labels are Javascript escaped, e.g. = as \u003D
+	for _, want := range []string{`label: 'linear: y \u003D 2x + 1, R² \u003D 1.000'`, `label: 'loess: LOESS, span 0.3, R² \u003D 1.000'`, "borderDash: [6, 4]", "type: 'line'"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the chart to contain %q", want)
+		}
+	}
+}
+
+func TestChartJSOutput_TrendlineDownsampled(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--chart-type", "scatter", "--trendline", "linear", "--downsample-threshold", "10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// The kept peak would weigh far more in a fit over the downsampled rows
+	schema := &ch.Schema{Floats: []string{"size", "runtime"}}
+	rows := make(chan ch.Row, 100)
+	xs, ys := make([]float64, 100), make([]float64, 100)
+	for i := range xs {
+		xs[i], ys[i] = float64(i), 1
+		if i == 50 {
+			ys[i] = 999
+		}
+		rows <- ch.Row{Floats: []float64{xs[i], ys[i]}, Schema: schema}
+	}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	fit, err := stats.FitLinear(xs, ys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "label: '" + template.JSEscapeString(fmt.Sprintf("%v: %v, R² = %.3f", fit.Name, fit.Equation, fit.R2)) + "'"
+	if !strings.Contains(html, want) {
+		t.Errorf("Expected the chart to contain %q, fitted over all rows", want)
+	}
+	if !strings.Contains(html, "x: 99") {
+		t.Error("Expected the trendline to span all rows")
+	}
+}
+
+func TestChartJSOutput_TrendlineInvalid(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--trendline", "cubic"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := make(chan ch.Row)
+	close(rows)
+	if err := o.Render(rows, cfg); err == nil {
+		t.Error("Expected an error for an unknown trendline")
+	}
+}
+
+func TestChartJSOutput_Forecast(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	schema := &ch.Schema{
+		Floats:     []string{"requests", "forecast(requests)", "forecast_lower(requests)", "forecast_upper(requests)"},
+		DateTimes:  []string{"day"},
+		DateFormat: "2006-01-02",
+		FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleForecast, Of: "requests"}, {Role: ch.RoleForecastLower, Of: "requests"}, {Role: ch.RoleForecastUpper, Of: "requests"}},
+	}
+	nan := math.NaN()
+	rows := make(chan ch.Row, 3)
+	rows <- ch.Row{Floats: []float64{100, nan, nan, nan}, DateTimes: []string{"2024-01-01"}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{110, 110, 110, 110}, DateTimes: []string{"2024-01-02"}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{nan, 120, 115, 125}, DateTimes: []string{"2024-01-03"}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	for _, want := range []string{
+		"label: 'forecast(requests)'",
+		"borderDash: [6, 4]",
+		"fill: '-1'",
+		`backgroundColor: "#ffbb0033"`,
+		"y: NaN",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the chart to contain %q", want)
+		}
+	}
+}
+
+func TestChartJSOutput_Anomalies(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	schema := &ch.Schema{Floats: []string{"errors", "anomaly(errors)"}, DateTimes: []string{"day"}, DateFormat: "2006-01-02", FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}}}
+	rows := make(chan ch.Row, 3)
+	rows <- ch.Row{Floats: []float64{3, 0}, DateTimes: []string{"2024-01-01"}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{90, 1}, DateTimes: []string{"2024-01-02"}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{4, 0}, DateTimes: []string{"2024-01-03"}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	for _, want := range []string{
+		"label: 'errors'",
+		"anomalies: [1]",
+		`pointBackgroundColor: ["#ffbb00","#ff0000","#ffbb00"]`,
+		"' (anomaly)'",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected the chart to contain %q", want)
+		}
+	}
+	if strings.Contains(html, "anomaly(errors)") {
+		t.Error("Expected the anomaly flags not to be charted")
+	}
+}
+
+func TestChartJSOutput_Sorted(t *testing.T) {
+	o := NewChartJSOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	// Mock openBrowser
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// Series are in order of their labels, unless the rows were sorted
+	render := func(sorted bool) string {
+		schema := &ch.Schema{Floats: []string{"y"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02", Sorted: sorted}
+		rows := make(chan ch.Row, 4)
+		rows <- ch.Row{Floats: []float64{111}, Strings: []string{"zeta"}, DateTimes: []string{"2024-01-01"}, Schema: schema}
+		rows <- ch.Row{Floats: []float64{222}, Strings: []string{"alpha"}, DateTimes: []string{"2024-01-02"}, Schema: schema}
+		rows <- ch.Row{Floats: []float64{333}, Strings: []string{"alpha"}, DateTimes: []string{"2024-01-01"}, Schema: schema}
+		rows <- ch.Row{Floats: []float64{444}, Strings: []string{"zeta"}, DateTimes: []string{"2024-01-02"}, Schema: schema}
+		close(rows)
+		if err := o.Render(rows, cfg); err != nil {
+			t.Fatalf("Render failed: %v", err)
+		}
+		content, err := os.ReadFile(opened)
+		if err != nil {
+			t.Fatalf("Failed to read generated file: %v", err)
+		}
+		html := string(content)
+		return html[strings.Index(html, "datasets: ["):]
+	}
+
+	if html := render(false); strings.Index(html, "'alpha'") > strings.Index(html, "'zeta'") || strings.Index(html, "333") > strings.Index(html, "222") {
+		t.Error("Expected the alpha series first, with its points in order of time")
+	}
+	html := render(true)
+	if strings.Index(html, "'zeta'") > strings.Index(html, "'alpha'") {
+		t.Error("Expected the zeta series first, as sorted")
+	}
+	if strings.Index(html, "222") > strings.Index(html, "333") {
+		t.Error("Expected alpha's points in their sorted order")
+	}
+}
+
+// BenchmarkChartJSOutput parses and charts millions of lines, like the
+// exports ch is meant to chart, which are downsampled to draw them.
+func BenchmarkChartJSOutput(b *testing.B) {
+	lines := make([][]byte, 2000000)
+	for i := range lines {
+		lines[i] = []byte(fmt.Sprintf("2021-01-01 %02d:%02d:%02d\t%d", i/3600%24, i/60%60, i%60, i%1000))
+	}
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = os.Remove
+
+	o := NewChartJSOutput()
+	cfg := o.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		in := make(chan []byte, 1024)
+		go func() {
+			for _, l := range lines {
+				in <- l
+			}
+			close(in)
+		}()
+		rows, _ := parser.NewCSVParser('\t', "2006-01-02 15:04:05").Parse(in)
+		if err := o.Render(rows, cfg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -57,10 +57,19 @@ var chart = new Chart(ctx, {{.}});
         datasets: [
         {{range $i,$v := .Datasets}}{{if $i}},{{end -}}
         {
-            fill: {{ .Fill }},
-            {{if len .Label}}label: '{{ .Label }}',{{end}}
+            fill: {{if .FillTo}}'{{ .FillTo }}'{{else}}{{ .Fill }}{{end}},
+            {{if len .Label}}label: '{{ js .Label }}',{{end}}
             {{if len .BackgroundColor}}backgroundColor: {{if $manyColor}}[{{end}}{{ .BackgroundColor }}{{if $manyColor}}]{{end}},{{end}}
             {{if len .BorderColor}}borderColor: {{ .BorderColor }},{{end}}
+            {{if .Type}}type: '{{ .Type }}',
+            showLine: true,{{end}}
+            {{if .Dashed}}borderDash: [6, 4],{{end}}
+            {{if .HidePoints}}pointRadius: 0,
+            pointHitRadius: 0,{{end}}
+            {{if .Anomalies}}anomalies: [{{ .AnomalyIndices }}],{{end}}
+            {{if len .PointColors}}pointBackgroundColor: [{{ .PointColors }}],
+            pointBorderColor: [{{ .PointColors }}],
+            pointRadius: [{{ .PointRadii }}],{{end}}
             data: [
             {{if len .SimpleData}}{{range $i,$v := .SimpleData}}{{if $i}},{{end -}}{{.}}{{end}}{{end}}
             {{if len .ComplexData}}{{range $i,$v := .ComplexData}}{{if $i}},{{end -}}
@@ -80,7 +89,7 @@ var chart = new Chart(ctx, {{.}});
     options: {
         title: {
             display: {{ if len .Title }}true{{else}}false{{end}},
-            text: '{{ .Title }}'
+            text: '{{ js .Title }}'
         },
         tooltips: {
             callbacks: {
@@ -105,7 +114,7 @@ var chart = new Chart(ctx, {{.}});
                 },
                 scaleLabel: {
                     display: {{if eq .YLabel ""}}false{{else}}true{{end}},
-                    labelString: '{{ .YLabel }}'
+                    labelString: '{{ js .YLabel }}'
                 }
             }],
             xAxes: [{
@@ -118,7 +127,7 @@ var chart = new Chart(ctx, {{.}});
                 {{end}}
                 scaleLabel: {
                     display: {{if eq .XLabel ""}}false{{else}}true{{end}},
-                    labelString: '{{ .XLabel }}'
+                    labelString: '{{ js .XLabel }}'
                 }
             }]
         },
@@ -24,6 +24,19 @@ type Config struct {
 	YLabel    string      `json:"yLabel"`
 	Color     string      `json:"color"`
 	Other     interface{} `json:"other,omitempty"`
+
+	Trendlines []Trendline `json:"trendlines,omitempty"`
+}
+
+// Trendline is a regression curve drawn over a scatter plot.
+type Trendline struct {
+	Label  string  `json:"label"`
+	Points []Point `json:"points"`
+}
+
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
 }
 
 type Chart struct {
@@ -3,9 +3,13 @@ package d3
 import (
 	"flag"
 	"fmt"
+	"math"
 	"os"
+	"strings"
 
 	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+	"github.com/marianogappa/ch/pkg/transform"
 	"github.com/skratchdot/open-golang/open"
 )
 
@@ -29,6 +33,7 @@ type D3Config struct {
 	XLabel    string
 	YLabel    string
 	Color     string
+	Trendline string
 }
 
 func (o *D3Output) RegisterFlags(fs *flag.FlagSet) any {
@@ -38,6 +43,7 @@ func (o *D3Output) RegisterFlags(fs *flag.FlagSet) any {
 	fs.StringVar(&c.XLabel, "x-label", "", "Label for X axis")
 	fs.StringVar(&c.YLabel, "y-label", "", "Label for Y axis")
 	fs.StringVar(&c.Color, "color", "", "Color of the chart elements (e.g. 'red', '#ff0000')")
+	fs.StringVar(&c.Trendline, "trendline", "", "Comma-separated regressions drawn over scatter charts: linear, poly[:degree], exp, loess[:span]")
 	return c
 }
 
@@ -53,38 +59,77 @@ func (o *D3Output) Render(rows <-chan ch.Row, config any) error {
 	if !ok {
 		return fmt.Errorf("invalid config type for D3Output")
 	}
+	var fitters []stats.Fitter
+	for _, spec := range strings.Split(cfg.Trendline, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		f, err := stats.ParseFitter(spec)
+		if err != nil {
+			return fmt.Errorf("invalid --trendline: %w", err)
+		}
+		fitters = append(fitters, f)
+	}
 
-	var data []interface{}
+	var (
+		data   []interface{}
+		xs, ys []float64
+		schema *ch.Schema
+	)
 	for row := range rows {
+		if row.Schema != schema {
+			if schema != nil {
+				fmt.Fprintf(os.Stderr, "Warning: input schema changed to %v\n", row.Schema)
+			}
+			schema = row.Schema
+		}
+		// Rows that are already histogram bins chart as bars labelled by range
+		if transform.IsBinned(row.Schema) && cfg.ChartType != "scatter" {
+			label, count := transform.BinLabel(row)
+			data = append(data, map[string]interface{}{
+				"label": label,
+				"value": count,
+			})
+			if cfg.ChartType == "histogram" {
+				cfg.ChartType = "bar"
+			}
+			continue
+		}
 		// Basic mapping based on chart type
 		// This is a simplified implementation. A real one would be more robust.
+		vs := valueColumns(row)
 		switch cfg.ChartType {
 		case "bar", "pie":
-			if len(row.Strings) > 0 && len(row.Floats) > 0 {
+			if len(row.Strings) > 0 && len(vs) > 0 {
 				data = append(data, map[string]interface{}{
-					"label": row.Strings[0],
-					"value": row.Floats[0],
+					"label":   row.Strings[0],
+					"value":   nullable(row.Floats[vs[0]]),
+					"anomaly": isAnomaly(row, vs[0]),
 				})
 			}
 		case "scatter":
-			if len(row.Floats) >= 2 {
+			// Points missing a coordinate (e.g. NaN from pivoted series) can't be drawn
+			if len(vs) >= 2 && finite(row.Floats[vs[0]]) && finite(row.Floats[vs[1]]) {
+				x, y := row.Floats[vs[0]], row.Floats[vs[1]]
 				data = append(data, map[string]interface{}{
-					"x": row.Floats[0],
-					"y": row.Floats[1],
+					"x":       x,
+					"y":       y,
+					"anomaly": isAnomaly(row, vs[1]),
 				})
+				xs, ys = append(xs, x), append(ys, y)
 			}
 		case "histogram":
-			if len(row.Floats) > 0 {
+			if len(vs) > 0 && finite(row.Floats[vs[0]]) {
 				data = append(data, map[string]interface{}{
-					"value": row.Floats[0],
+					"value": row.Floats[vs[0]],
 				})
 			}
 		default:
 			// Default to bar-like structure if possible
-			if len(row.Strings) > 0 && len(row.Floats) > 0 {
+			if len(row.Strings) > 0 && len(vs) > 0 {
 				data = append(data, map[string]interface{}{
 					"label": row.Strings[0],
-					"value": row.Floats[0],
+					"value": nullable(row.Floats[vs[0]]),
 				})
 			}
 		}
@@ -97,6 +142,11 @@ func (o *D3Output) Render(rows <-chan ch.Row, config any) error {
 		YLabel:    cfg.YLabel,
 		Color:     cfg.Color,
 	}
+	if len(fitters) > 0 && cfg.ChartType != "scatter" {
+		fmt.Fprintf(os.Stderr, "Warning: trendlines only apply to scatter charts\n")
+	} else if len(fitters) > 0 {
+		chartConfig.Trendlines = trendlines(xs, ys, fitters)
+	}
 
 	c := NewChart(chartConfig, data)
 
@@ -119,4 +169,72 @@ func (o *D3Output) Render(rows <-chan ch.Row, config any) error {
 	return openBrowser(htmlPath)
 }
 
+// valueColumns returns the indices of the row's float columns that hold plain
+// values, leaving out e.g. anomaly flags and forecasts, which aren't charted.
+func valueColumns(row ch.Row) []int {
+	var vs []int
+	for i := range row.Floats {
+		if row.Schema.FloatRole(i).Role == ch.RoleValue {
+			vs = append(vs, i)
+		}
+	}
+	return vs
+}
+
+// isAnomaly returns whether a row's float column is flagged as an outlier by
+// an anomaly column.
+func isAnomaly(row ch.Row, col int) bool {
+	if row.Schema == nil || col >= len(row.Schema.Floats) {
+		return false
+	}
+	for j, f := range row.Floats {
+		if r := row.Schema.FloatRole(j); r.Role == ch.RoleAnomaly && r.Of == row.Schema.Floats[col] {
+			return f == 1
+		}
+	}
+	return false
+}
+
+// trendlinePoints is the number of points drawing each trendline.
+const trendlinePoints = 100
+
+// trendlines fits each regression to the points, labelling the curves with
+// their equation and R².
+func trendlines(xs, ys []float64, fitters []stats.Fitter) []Trendline {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, x := range xs {
+		lo, hi = math.Min(lo, x), math.Max(hi, x)
+	}
+	var tls []Trendline
+	for _, fitter := range fitters {
+		fit, err := fitter(xs, ys)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: can't draw a trendline: %v\n", err)
+			continue
+		}
+		tl := Trendline{Label: fmt.Sprintf("%v: %v, R² = %.3f", fit.Name, fit.Equation, fit.R2)}
+		for i := 0; i < trendlinePoints; i++ {
+			x := lo + (hi-lo)*float64(i)/(trendlinePoints-1)
+			if y := fit.At(x); !math.IsNaN(y) && !math.IsInf(y, 0) {
+				tl.Points = append(tl.Points, Point{X: x, Y: y})
+			}
+		}
+		tls = append(tls, tl)
+	}
+	return tls
+}
+
 var openBrowser = open.Run
+
+func finite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+// nullable returns x, or nil if it's NaN or infinite (e.g. a value missing
+// from a pivoted series), which JSON can't represent.
+func nullable(x float64) any {
+	if !finite(x) {
+		return nil
+	}
+	return x
+}
@@ -2,9 +2,13 @@ package d3
 
 import (
 	"flag"
+	"math"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/transform"
 )
 
 func TestD3Output(t *testing.T) {
@@ -30,3 +34,136 @@ func TestD3Output(t *testing.T) {
 		t.Errorf("Render failed: %v", err)
 	}
 }
+
+func TestD3Output_Bins(t *testing.T) {
+	o := NewD3Output()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--chart-type", "histogram"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// Rows that are already bins are charted as bars rather than binned again
+	schema := &ch.Schema{Floats: []string{transform.BinStart, transform.BinEnd, transform.BinCount}}
+	rows := make(chan ch.Row, 2)
+	rows <- ch.Row{Floats: []float64{0, 10, 3}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{10, 20, 5}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	if html := string(content); !strings.Contains(html, "[10, 20)") || strings.Contains(html, "d3.histogram()") {
+		t.Error("Expected bins charted as bars labelled by range")
+	}
+}
+
+func TestD3Output_Trendline(t *testing.T) {
+	o := NewD3Output()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+	if err := fs.Parse([]string{"--chart-type", "scatter", "--trendline", "poly:2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	rows := make(chan ch.Row, 5)
+	for i := 0; i < 5; i++ {
+		x := float64(i)
+		rows <- ch.Row{Floats: []float64{x, x*x + 1}}
+	}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	if !strings.Contains(string(content), `"label":"poly:2: y = x² + 1, R² = 1.000"`) {
+		t.Error("Expected the trendline's equation and R² in the chart config")
+	}
+}
+
+func TestD3Output_Anomalies(t *testing.T) {
+	o := NewD3Output()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	schema := &ch.Schema{Floats: []string{"errors", "anomaly(errors)"}, Strings: []string{"day"}, FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}}}
+	rows := make(chan ch.Row, 2)
+	rows <- ch.Row{Floats: []float64{3, 0}, Strings: []string{"mon"}, Schema: schema}
+	rows <- ch.Row{Floats: []float64{90, 1}, Strings: []string{"tue"}, Schema: schema}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	html := string(content)
+	if !strings.Contains(html, `{"anomaly":false,"label":"mon","value":3}`) || !strings.Contains(html, `{"anomaly":true,"label":"tue","value":90}`) {
+		t.Error("Expected the bars to be flagged as anomalies")
+	}
+}
+
+func TestD3Output_NaN(t *testing.T) {
+	o := NewD3Output()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	opened := ""
+	oldOpenBrowser := openBrowser
+	defer func() { openBrowser = oldOpenBrowser }()
+	openBrowser = func(url string) error {
+		opened = url
+		return nil
+	}
+
+	// e.g. a pivoted series missing a value
+	rows := make(chan ch.Row, 2)
+	rows <- ch.Row{Floats: []float64{1}, Strings: []string{"a"}}
+	rows <- ch.Row{Floats: []float64{math.NaN()}, Strings: []string{"b"}}
+	close(rows)
+
+	if err := o.Render(rows, cfg); err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	content, err := os.ReadFile(opened)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+	if !strings.Contains(string(content), `"label":"b","value":null`) {
+		t.Error("Expected NaN charted as null")
+	}
+}
@@ -75,6 +75,9 @@ var templateStrings = map[string]string{
             tooltip.transition().duration(500).style("opacity", 0);
         };
 
+        // Outliers flagged by the anomaly transformer
+        const anomalyColor = "crimson";
+
         {{.ChartScript}}
     </script>
 </body>
@@ -111,8 +114,8 @@ var templateStrings = map[string]string{
             .attr("width", x.bandwidth())
             .attr("y", d => y(d.value))
             .attr("height", d => height - y(d.value))
-            .attr("fill", config.color || "steelblue")
-            .on("mouseover", function(event, d) { showTooltip(event, d, d.label + ": " + d.value); })
+            .attr("fill", d => d.anomaly ? anomalyColor : (config.color || "steelblue"))
+            .on("mouseover", function(event, d) { showTooltip(event, d, d.label + ": " + d.value + (d.anomaly ? " (anomaly)" : "")); })
             .on("mouseout", hideTooltip);
             
         // Labels
@@ -192,13 +195,31 @@ var templateStrings = map[string]string{
             .data(data)
             .enter().append("circle")
             .attr("class", "dot")
-            .attr("r", 3.5)
+            .attr("r", d => d.anomaly ? 6 : 3.5)
             .attr("cx", d => x(d.x))
             .attr("cy", d => y(d.y))
-            .style("fill", config.color || "steelblue")
-            .on("mouseover", function(event, d) { showTooltip(event, d, "(" + d.x + ", " + d.y + ")"); })
+            .style("fill", d => d.anomaly ? anomalyColor : (config.color || "steelblue"))
+            .on("mouseover", function(event, d) { showTooltip(event, d, "(" + d.x + ", " + d.y + ")" + (d.anomaly ? " (anomaly)" : "")); })
             .on("mouseout", hideTooltip);
 
+        // Trendlines, with their equation and R² as a legend
+        (config.trendlines || []).forEach((t, i) => {
+            const color = d3.schemeCategory10[(i + 1) % 10];
+            svg.append("path")
+                .datum(t.points)
+                .attr("fill", "none")
+                .attr("stroke", color)
+                .attr("stroke-width", 2)
+                .attr("stroke-dasharray", "6,4")
+                .attr("d", d3.line().x(d => x(d.x)).y(d => y(d.y)));
+            svg.append("text")
+                .attr("x", 10)
+                .attr("y", 15 + i * 16)
+                .style("fill", color)
+                .style("font-size", "12px")
+                .text(t.label);
+        });
+
         // Labels
         if (config.xLabel) {
             svg.append("text")
@@ -1,8 +1,11 @@
 package json
 
 import (
+	"bufio"
 	stdjson "encoding/json"
 	"flag"
+	"fmt"
+	"math"
 	"os"
 
 	"github.com/marianogappa/ch/pkg/ch"
@@ -42,15 +45,75 @@ func (o *JSONOutput) Capabilities() ch.Capabilities {
 func (o *JSONOutput) Render(rows <-chan ch.Row, config any) error {
 	cfg, _ := config.(*JSONConfig)
 
-	enc := stdjson.NewEncoder(os.Stdout)
+	w := bufio.NewWriter(os.Stdout)
+
+	enc := stdjson.NewEncoder(w)
 	if cfg != nil && cfg.Pretty {
 		enc.SetIndent("", "  ")
 	}
 
+	var schema *ch.Schema
 	for row := range rows {
-		if err := enc.Encode(row); err != nil {
+		if row.Schema != schema {
+			if schema != nil {
+				fmt.Fprintf(os.Stderr, "Warning: input schema changed to %v\n", row.Schema)
+			}
+			schema = row.Schema
+		}
+		if err := enc.Encode(encodable(row)); err != nil {
 			return err
 		}
+		// Flush whenever we catch up with the input, so streams stay live
+		if len(rows) == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// nullableRow is how rows with NaN or infinite floats (e.g. missing values)
+// are encoded, as null, since JSON can't represent them. It also lists the
+// columns of rows flagged as outliers by the anomaly transformer.
+type nullableRow struct {
+	Floats    []*float64
+	Strings   []string
+	DateTimes []string
+	Anomalies []string `json:",omitempty"`
+}
+
+func encodable(row ch.Row) any {
+	anomalies := flaggedColumns(row)
+	if anomalies == nil && allFinite(row.Floats) {
+		return row
+	}
+	fs := make([]*float64, len(row.Floats))
+	for i, f := range row.Floats {
+		if !math.IsNaN(f) && !math.IsInf(f, 0) {
+			fs[i] = &row.Floats[i]
+		}
+	}
+	return nullableRow{Floats: fs, Strings: row.Strings, DateTimes: row.DateTimes, Anomalies: anomalies}
+}
+
+func allFinite(fs []float64) bool {
+	for _, f := range fs {
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// flaggedColumns returns the names of the row's columns that are flagged as
+// outliers by anomaly columns.
+func flaggedColumns(row ch.Row) []string {
+	var names []string
+	for i, f := range row.Floats {
+		if r := row.Schema.FloatRole(i); r.Role == ch.RoleAnomaly && f == 1 {
+			names = append(names, r.Of)
+		}
 	}
-	return nil
+	return names
 }
@@ -1,7 +1,9 @@
 package json
 
 import (
+	stdjson "encoding/json"
 	"flag"
+	"math"
 	"testing"
 
 	"github.com/marianogappa/ch/pkg/ch"
@@ -29,3 +31,32 @@ func TestJSONOutput(t *testing.T) {
 		t.Errorf("Render failed: %v", err)
 	}
 }
+
+func TestEncodable_NaN(t *testing.T) {
+	row := ch.Row{Floats: []float64{1.5, math.NaN(), math.Inf(1)}, Strings: []string{"a"}, DateTimes: []string{}}
+	bs, err := stdjson.Marshal(encodable(row))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Floats":[1.5,null,null],"Strings":["a"],"DateTimes":[]}`; string(bs) != want {
+		t.Errorf("got %s, want %s", bs, want)
+	}
+}
+
+func TestEncodable_Anomalies(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"errors", "anomaly(errors)"}, Strings: []string{}, DateTimes: []string{}, FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}}}
+	bs, err := stdjson.Marshal(encodable(ch.Row{Floats: []float64{90, 1}, Strings: []string{}, DateTimes: []string{}, Schema: schema}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Floats":[90,1],"Strings":[],"DateTimes":[],"Anomalies":["errors"]}`; string(bs) != want {
+		t.Errorf("got %s, want %s", bs, want)
+	}
+	bs, err = stdjson.Marshal(encodable(ch.Row{Floats: []float64{3, 0}, Strings: []string{}, DateTimes: []string{}, Schema: schema}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"Floats":[3,0],"Strings":[],"DateTimes":[]}`; string(bs) != want {
+		t.Errorf("got %s, want %s", bs, want)
+	}
+}
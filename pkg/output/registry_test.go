@@ -7,6 +7,7 @@ import (
 	_ "github.com/marianogappa/ch/pkg/output/chartjs"
 	_ "github.com/marianogappa/ch/pkg/output/d3"
 	_ "github.com/marianogappa/ch/pkg/output/json"
+	_ "github.com/marianogappa/ch/pkg/output/stats"
 )
 
 func TestRegistry(t *testing.T) {
@@ -15,14 +16,16 @@ func TestRegistry(t *testing.T) {
 		t.Fatal("No outputs registered")
 	}
 
-	found := false
-	for _, name := range outputs {
-		if name == "json" {
-			found = true
-			break
+	for _, want := range []string{"json", "stats"} {
+		found := false
+		for _, name := range outputs {
+			if name == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("%v output not found in registry", want)
 		}
-	}
-	if !found {
-		t.Error("json output not found in registry")
 	}
 }
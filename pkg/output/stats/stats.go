@@ -0,0 +1,431 @@
+// Package stats contains an output that prints summary statistics of every
+// column, to profile data before choosing how to chart it. It profiles inputs
+// of any length in bounded memory, estimating the statistics that would need
+// every value (marked with a ~) once there are too many.
+package stats
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	chstats "github.com/marianogappa/ch/pkg/stats"
+)
+
+func init() {
+	ch.RegisterOutput(NewStatsOutput())
+}
+
+type StatsOutput struct{}
+
+func NewStatsOutput() *StatsOutput {
+	return &StatsOutput{}
+}
+
+func (o *StatsOutput) Name() string {
+	return "stats"
+}
+
+type StatsConfig struct {
+	TopValues      int
+	SparklineWidth int
+}
+
+func (o *StatsOutput) RegisterFlags(fs *flag.FlagSet) any {
+	c := &StatsConfig{}
+	fs.IntVar(&c.TopValues, "stats-top", 5, "Number of most frequent values listed per string column.")
+	fs.IntVar(&c.SparklineWidth, "stats-width", 20, "Width of the sparklines of the float columns, in characters.")
+	return c
+}
+
+func (o *StatsOutput) Capabilities() ch.Capabilities {
+	return ch.Capabilities{
+		Streaming:   false,
+		Interactive: false,
+	}
+}
+
+func (o *StatsOutput) Render(rows <-chan ch.Row, config any) error {
+	cfg, ok := config.(*StatsConfig)
+	if !ok {
+		return fmt.Errorf("invalid config type for StatsOutput")
+	}
+	if cfg.TopValues < 0 || cfg.SparklineWidth <= 0 {
+		return fmt.Errorf("--stats-top can't be negative and --stats-width must be positive")
+	}
+
+	// Columns of different schemas can't be profiled together, so profile
+	// each in turn
+	var p *profile
+	for row := range rows {
+		if p == nil || row.Schema != p.schema {
+			if p != nil {
+				fmt.Print(p.report(), "\n")
+			}
+			p = newProfile(row.Schema, cfg)
+		}
+		p.add(row)
+	}
+	if p == nil {
+		p = newProfile(nil, cfg)
+	}
+	fmt.Print(p.report())
+	return nil
+}
+
+// profile accumulates the values of the columns of rows sharing a Schema.
+type profile struct {
+	schema  *ch.Schema
+	cfg     *StatsConfig
+	rows    int
+	nFloats int // number of float columns, be they values or flags
+	floats  []*floatColumn
+	flags   []*flagColumn
+	strs    []*stringColumn
+	dts     []*dateTimeColumn
+}
+
+const (
+	// quantileSample is the number of values per float column that quartiles
+	// are estimated from once there are more.
+	quantileSample = 10000
+	// maxStringCounts is the number of distinct values per string column whose
+	// counts are kept, past which the most frequent ones and the number of
+	// distinct ones are estimated.
+	maxStringCounts = 10000
+)
+
+type floatColumn struct {
+	name    string
+	index   int // in Row.Floats
+	nulls   int
+	moments chstats.Moments
+	sample  *chstats.Reservoir
+	series  *series
+}
+
+// flagColumn counts the outliers an anomaly column flags, which aren't
+// profiled as values.
+type flagColumn struct {
+	of      string
+	index   int // in Row.Floats
+	flagged int
+}
+
+type stringColumn struct {
+	name     string
+	nulls    int
+	counts   *chstats.HeavyHitters
+	seen     map[string]bool      // the distinct values, until there are too many
+	distinct *chstats.HyperLogLog // from then on
+}
+
+type dateTimeColumn struct {
+	name             string
+	count, nulls     int
+	earliest, latest time.Time
+}
+
+func newProfile(s *ch.Schema, cfg *StatsConfig) *profile {
+	p := &profile{schema: s, cfg: cfg}
+	if s == nil {
+		return p
+	}
+	for i, name := range s.Floats {
+		if r := s.FloatRole(i); r.Role == ch.RoleAnomaly {
+			p.flags = append(p.flags, &flagColumn{of: r.Of, index: i})
+		} else {
+			p.floats = append(p.floats, newFloatColumn(name, i, 0, cfg))
+		}
+	}
+	p.nFloats = len(s.Floats)
+	for _, name := range s.Strings {
+		p.strs = append(p.strs, newStringColumn(name, 0))
+	}
+	for _, name := range s.DateTimes {
+		p.dts = append(p.dts, &dateTimeColumn{name: name})
+	}
+	return p
+}
+
+func (p *profile) add(row ch.Row) {
+	p.rows++
+	// Rows without a schema are profiled by position, as `$N` columns
+	for ; p.nFloats < len(row.Floats); p.nFloats++ {
+		p.floats = append(p.floats, newFloatColumn(fmt.Sprintf("$%v", p.nFloats+1), p.nFloats, p.rows-1, p.cfg))
+	}
+	for len(p.strs) < len(row.Strings) {
+		p.strs = append(p.strs, newStringColumn(fmt.Sprintf("$%v", len(p.strs)+1), p.rows-1))
+	}
+	for len(p.dts) < len(row.DateTimes) {
+		p.dts = append(p.dts, &dateTimeColumn{name: fmt.Sprintf("$%v", len(p.dts)+1), nulls: p.rows - 1})
+	}
+
+	for _, c := range p.floats {
+		x := math.NaN()
+		if c.index < len(row.Floats) {
+			x = row.Floats[c.index]
+		}
+		c.add(x)
+	}
+	for _, c := range p.flags {
+		if c.index < len(row.Floats) && row.Floats[c.index] == 1 {
+			c.flagged++
+		}
+	}
+	for i, c := range p.strs {
+		if i >= len(row.Strings) || row.Strings[i] == "" {
+			c.nulls++
+			continue
+		}
+		c.add(row.Strings[i])
+	}
+	dateFormat := "2006-01-02" // minimal assumption when the schema is unknown
+	if p.schema != nil && p.schema.DateFormat != "" {
+		dateFormat = p.schema.DateFormat
+	}
+	for i, c := range p.dts {
+		if i >= len(row.DateTimes) {
+			c.nulls++
+			continue
+		}
+		t, err := time.Parse(dateFormat, row.DateTimes[i])
+		if err != nil {
+			c.nulls++
+			continue
+		}
+		if c.count == 0 || t.Before(c.earliest) {
+			c.earliest = t
+		}
+		if c.count == 0 || t.After(c.latest) {
+			c.latest = t
+		}
+		c.count++
+	}
+}
+
+// newFloatColumn returns a float column missing from the given number of
+// rows before it.
+func newFloatColumn(name string, index, missing int, cfg *StatsConfig) *floatColumn {
+	c := &floatColumn{name: name, index: index, sample: chstats.NewReservoir(quantileSample, 1), series: newSeries(cfg.SparklineWidth)}
+	for i := 0; i < missing; i++ {
+		c.add(math.NaN())
+	}
+	return c
+}
+
+func (c *floatColumn) add(x float64) {
+	c.series.add(x)
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		c.nulls++
+		return
+	}
+	c.moments.Add(x)
+	c.sample.Add(x)
+}
+
+// newStringColumn returns a string column missing from the given number of
+// rows before it.
+func newStringColumn(name string, missing int) *stringColumn {
+	return &stringColumn{name: name, nulls: missing, counts: chstats.NewHeavyHitters(maxStringCounts), seen: make(map[string]bool)}
+}
+
+func (c *stringColumn) add(s string) {
+	// Distinct values are counted exactly until they don't fit, and then
+	// estimated from all of them
+	if c.distinct != nil {
+		c.distinct.Add(s)
+	} else if c.seen[s] = true; len(c.seen) > maxStringCounts {
+		c.distinct = chstats.NewHyperLogLog()
+		for v := range c.seen {
+			c.distinct.Add(v)
+		}
+		c.seen = nil
+	}
+	c.counts.Add(s)
+}
+
+// report returns a table of the statistics of each type of column.
+func (p *profile) report() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v rows\n", p.rows)
+
+	if len(p.floats) > 0 {
+		fmt.Fprintln(&buf)
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "float\tcount\tnulls\tmin\tp25\tmedian\tp75\tmax\tmean\tstddev\tsparkline")
+		for _, c := range p.floats {
+			m := &c.moments
+			sorted := chstats.Sorted(c.sample.Values())
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v", c.name, m.Count(), c.nulls, formatFloat(m.Min()))
+			for _, q := range []float64{0.25, 0.5, 0.75} {
+				fmt.Fprintf(w, "\t%v", estimate(formatFloat(chstats.Quantile(sorted, q)), c.sample.Exact()))
+			}
+			fmt.Fprintf(w, "\t%v\t%v\t%v\t%v\n", formatFloat(m.Max()), formatFloat(m.Mean()), formatFloat(m.StdDev()), c.series.sparkline())
+		}
+		w.Flush()
+	}
+
+	if len(p.flags) > 0 {
+		fmt.Fprintln(&buf)
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "outliers\tcount\tshare")
+		for _, c := range p.flags {
+			fmt.Fprintf(w, "%v\t%v\t%v%%\n", c.of, c.flagged, formatFloat(100*float64(c.flagged)/float64(p.rows)))
+		}
+		w.Flush()
+	}
+
+	if len(p.strs) > 0 {
+		fmt.Fprintln(&buf)
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "string\tcount\tnulls\tdistinct\ttop values")
+		for _, c := range p.strs {
+			distinct := fmt.Sprint(len(c.seen))
+			if c.distinct != nil {
+				distinct = fmt.Sprint(math.Round(c.distinct.Count()))
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", c.name, p.rows-c.nulls, c.nulls, estimate(distinct, c.distinct == nil), topValues(c.counts, p.cfg.TopValues))
+		}
+		w.Flush()
+	}
+
+	if len(p.dts) > 0 {
+		fmt.Fprintln(&buf)
+		w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "datetime\tcount\tnulls\tearliest\tlatest\tspan")
+		for _, c := range p.dts {
+			if c.count == 0 {
+				fmt.Fprintf(w, "%v\t0\t%v\t-\t-\t-\n", c.name, c.nulls)
+				continue
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", c.name, c.count, c.nulls, c.earliest.Format(time.RFC3339), c.latest.Format(time.RFC3339), c.latest.Sub(c.earliest))
+		}
+		w.Flush()
+	}
+	return buf.String()
+}
+
+// formatFloat formats statistics with up to 6 significant digits, and NaN
+// (e.g. the mean of no values) as a dash.
+func formatFloat(x float64) string {
+	if math.IsNaN(x) {
+		return "-"
+	}
+	return strconv.FormatFloat(x, 'g', 6, 64)
+}
+
+// estimate marks a statistic as estimated unless it's exact.
+func estimate(s string, exact bool) string {
+	if exact || s == "-" {
+		return s
+	}
+	return "~" + s
+}
+
+// topValues lists the n most frequent values with their counts, breaking
+// ties by value so that reports are deterministic.
+func topValues(hh *chstats.HeavyHitters, n int) string {
+	counts := hh.Counts()
+	values := make([]string, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	var top []string
+	for _, v := range values[:min(n, len(values))] {
+		top = append(top, fmt.Sprintf("%q (%v)", v, estimate(fmt.Sprint(counts[v]), hh.Exact())))
+	}
+	if len(values) > n {
+		top = append(top, "…")
+	}
+	return strings.Join(top, ", ")
+}
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// series summarises float values in order for their sparkline, as the sums
+// of runs of an equal number of them. When there are twice as many runs as
+// the sparkline is wide, neighbouring runs are merged, so that it takes
+// constant memory however many values there are.
+type series struct {
+	runs  []run
+	per   int // values per run
+	width int
+}
+
+// run sums the finite values among a run of values.
+type run struct {
+	sum, finite float64
+	values      int
+}
+
+func newSeries(width int) *series {
+	return &series{per: 1, width: width}
+}
+
+func (s *series) add(x float64) {
+	if len(s.runs) == 0 || s.runs[len(s.runs)-1].values == s.per {
+		if len(s.runs) == 2*s.width {
+			for i := range s.width {
+				a, b := s.runs[2*i], s.runs[2*i+1]
+				s.runs[i] = run{sum: a.sum + b.sum, finite: a.finite + b.finite, values: a.values + b.values}
+			}
+			s.runs, s.per = s.runs[:s.width], 2*s.per
+		}
+		s.runs = append(s.runs, run{})
+	}
+	r := &s.runs[len(s.runs)-1]
+	r.values++
+	if !math.IsNaN(x) && !math.IsInf(x, 0) {
+		r.sum, r.finite = r.sum+x, r.finite+1
+	}
+}
+
+// sparkline draws the values in order as at most width bars, each the mean
+// of an equal share of them. Shares of only nulls are blank.
+func (s *series) sparkline() string {
+	if len(s.runs) == 0 {
+		return ""
+	}
+	width := min(s.width, len(s.runs))
+	means := make([]float64, width)
+	for b := range means {
+		var sum, n float64
+		for _, r := range s.runs[b*len(s.runs)/width : (b+1)*len(s.runs)/width] {
+			sum, n = sum+r.sum, n+r.finite
+		}
+		means[b] = sum / n
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, m := range means {
+		if !math.IsNaN(m) {
+			lo, hi = min(lo, m), max(hi, m)
+		}
+	}
+	var sb strings.Builder
+	for _, m := range means {
+		switch {
+		case math.IsNaN(m):
+			sb.WriteRune(' ')
+		case hi > lo:
+			sb.WriteRune(sparks[int((m-lo)/(hi-lo)*float64(len(sparks)-1)+0.5)])
+		default:
+			sb.WriteRune(sparks[0])
+		}
+	}
+	return sb.String()
+}
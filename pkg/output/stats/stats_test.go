@@ -0,0 +1,151 @@
+package stats
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestStatsOutput(t *testing.T) {
+	o := NewStatsOutput()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := o.RegisterFlags(fs)
+
+	c, ok := cfg.(*StatsConfig)
+	if !ok {
+		t.Fatal("Config is not StatsConfig")
+	}
+	if c.TopValues != 5 {
+		t.Errorf("Default TopValues should be 5, got %v", c.TopValues)
+	}
+
+	rows := make(chan ch.Row)
+	close(rows)
+	if err := o.Render(rows, cfg); err != nil {
+		t.Errorf("Render failed: %v", err)
+	}
+	if err := o.Render(rows, &StatsConfig{TopValues: 5}); err == nil {
+		t.Error("Expected an error for a zero sparkline width")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	p := newProfile(schema, &StatsConfig{TopValues: 2, SparklineWidth: 5})
+	for _, r := range []struct {
+		latency float64
+		host    string
+		ts      string
+	}{
+		{1, "a", "2024-01-03"}, {2, "b", "2024-01-01"}, {3, "a", ""}, {math.NaN(), "", "2024-01-02"}, {4, "c", "2024-01-05"},
+	} {
+		p.add(ch.Row{Floats: []float64{r.latency}, Strings: []string{r.host}, DateTimes: []string{r.ts}, Schema: schema})
+	}
+	report := p.report()
+
+	for _, want := range []string{
+		"5 rows",
+		"latency  4      1      1    1.75  2.5     3.25  4    2.5   1.11803  ▁▃▆ █",
+		`host    4      1      3         "a" (2), "b" (1), …`,
+		"ts        4      1      2024-01-01T00:00:00Z  2024-01-05T00:00:00Z  96h0m0s",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected %q in the report:\n%v", want, report)
+		}
+	}
+}
+
+func TestProfile_Anomalies(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"errors", "anomaly(errors)"}, FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}}}
+	p := newProfile(schema, &StatsConfig{TopValues: 2, SparklineWidth: 5})
+	for _, r := range [][]float64{{3, 0}, {90, 1}, {4, 0}, {2, 0}} {
+		p.add(ch.Row{Floats: r, Schema: schema})
+	}
+	report := p.report()
+	if strings.Contains(report, "anomaly(errors)") {
+		t.Errorf("Expected the flags not profiled as values:\n%v", report)
+	}
+	if want := "errors    1      25%"; !strings.Contains(report, want) {
+		t.Errorf("Expected %q in the report:\n%v", want, report)
+	}
+}
+
+func TestProfile_Estimates(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"user"}}
+	p := newProfile(schema, &StatsConfig{TopValues: 1, SparklineWidth: 5})
+	n := 3 * max(quantileSample, maxStringCounts)
+	for i := 0; i < n; i++ {
+		user := "root"
+		if i%2 == 1 {
+			user = fmt.Sprintf("user-%v", i)
+		}
+		p.add(ch.Row{Floats: []float64{float64(i)}, Strings: []string{user}, Schema: schema})
+	}
+
+	f, s := p.floats[0], p.strs[0]
+	if len(f.sample.Values()) > quantileSample || len(f.series.runs) > 10 || len(s.counts.Counts()) > maxStringCounts {
+		t.Errorf("Expected bounded memory, got %v sampled values, %v sparkline runs and %v string counts", len(f.sample.Values()), len(f.series.runs), len(s.counts.Counts()))
+	}
+	report := p.report()
+	for _, want := range []string{
+		fmt.Sprintf("latency  %v  0      0    ~", n),
+		fmt.Sprintf("%v  14999.5  8660.25  ▁▃▄▆█", n-1),
+		`"root" (~`,
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("Expected %q in the report:\n%v", want, report)
+		}
+	}
+	distinct := strings.Fields(report[strings.Index(report, "user"):])[3]
+	if d, err := strconv.ParseFloat(strings.TrimPrefix(distinct, "~"), 64); err != nil || distinct[0] != '~' || math.Abs(d-float64(n/2+1)) > 0.02*float64(n/2) {
+		t.Errorf("Expected about %v distinct values, got %v in the report:\n%v", n/2+1, distinct, report)
+	}
+}
+
+func TestProfile_Distinct(t *testing.T) {
+	schema := &ch.Schema{Strings: []string{"user"}}
+	p := newProfile(schema, &StatsConfig{TopValues: 1, SparklineWidth: 5})
+	for i := 0; i < maxStringCounts; i++ {
+		p.add(ch.Row{Strings: []string{fmt.Sprintf("user-%v", i)}, Schema: schema})
+	}
+	if got := strings.Fields(p.report()[strings.Index(p.report(), "user  "):])[3]; got != fmt.Sprint(maxStringCounts) {
+		t.Errorf("Expected exactly %v distinct values while they fit, got %v", maxStringCounts, got)
+	}
+
+	// Every value counts towards the estimate, including those no longer counted
+	for i := 0; i < maxStringCounts; i++ {
+		p.add(ch.Row{Strings: []string{"root"}, Schema: schema})
+		p.add(ch.Row{Strings: []string{fmt.Sprintf("user-%v", i)}, Schema: schema})
+	}
+	distinct := strings.Fields(p.report()[strings.Index(p.report(), "user  "):])[3]
+	if d, err := strconv.ParseFloat(strings.TrimPrefix(distinct, "~"), 64); err != nil || distinct[0] != '~' || math.Abs(d-maxStringCounts) > 0.02*maxStringCounts {
+		t.Errorf("Expected about %v distinct values, got %v", maxStringCounts+1, distinct)
+	}
+}
+
+func TestSeries_Sparkline(t *testing.T) {
+	sparkline := func(xs []float64, width int) string {
+		s := newSeries(width)
+		for _, x := range xs {
+			s.add(x)
+		}
+		return s.sparkline()
+	}
+	if got := sparkline([]float64{1, 1, 8, 8}, 2); got != "▁█" {
+		t.Errorf("sparkline() = %q, want the means of halves", got)
+	}
+	if got := sparkline([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, 2); got != "▁█" {
+		t.Errorf("sparkline() = %q, want the means of halves of merged runs", got)
+	}
+	if got := sparkline([]float64{3, 3}, 10); got != "▁▁" {
+		t.Errorf("sparkline() = %q, want a flat line", got)
+	}
+	if got := sparkline(nil, 10); got != "" {
+		t.Errorf("sparkline() = %q, want nothing", got)
+	}
+}
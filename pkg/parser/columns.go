@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ColumnSelector picks and reorders the fields of each line before type
+// inference, so that e.g. `--columns 3,1` charts the third field against the
+// first. Columns are referenced either by 1-based index or by name; names are
+// resolved against the header line of the input.
+type ColumnSelector struct {
+	refs    []string
+	indices []int
+}
+
+// NewColumnSelector creates a ColumnSelector from a comma-separated list of
+// 1-based column indices and/or column names, e.g. `3,1,5` or `name,latency`.
+func NewColumnSelector(spec string) (*ColumnSelector, error) {
+	c := &ColumnSelector{}
+	for _, ref := range strings.Split(spec, ",") {
+		ref = strings.TrimSpace(ref)
+		if ref == "" {
+			return nil, fmt.Errorf("columns: empty column reference in %q", spec)
+		}
+		c.refs = append(c.refs, ref)
+		if i, err := strconv.Atoi(ref); err == nil && i <= 0 {
+			return nil, fmt.Errorf("columns: column indices start at 1; got %v", i)
+		}
+	}
+	if !c.NeedsHeader() {
+		_ = c.Resolve(nil) // Can't error without names
+	}
+	return c, nil
+}
+
+// NeedsHeader returns true if any column is referenced by name, in which case
+// the first line of input must contain the column names.
+func (c *ColumnSelector) NeedsHeader() bool {
+	for _, ref := range c.refs {
+		if _, err := strconv.Atoi(ref); err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve maps every column reference to a 0-based field index, looking up
+// names in the given header.
+func (c *ColumnSelector) Resolve(header []string) error {
+	indices := make([]int, 0, len(c.refs))
+	for _, ref := range c.refs {
+		if i, err := strconv.Atoi(ref); err == nil {
+			indices = append(indices, i-1)
+			continue
+		}
+		i := indexOf(header, ref)
+		if i == -1 {
+			return fmt.Errorf("columns: column %q not found in header %v", ref, header)
+		}
+		indices = append(indices, i)
+	}
+	c.indices = indices
+	return nil
+}
+
+// Select returns the selected fields in the selected order. It errors if the
+// line doesn't have enough fields.
+func (c *ColumnSelector) Select(fields []string) ([]string, error) {
+	return c.AppendSelect(nil, fields)
+}
+
+// AppendSelect is like Select but appends the selected fields to dst, so that
+// callers can reuse dst across lines without allocating.
+func (c *ColumnSelector) AppendSelect(dst []string, fields []string) ([]string, error) {
+	for _, idx := range c.indices {
+		if idx >= len(fields) {
+			return nil, fmt.Errorf("Input line has %v fields; column %v not found", len(fields), idx+1)
+		}
+		dst = append(dst, fields[idx])
+	}
+	return dst, nil
+}
+
+func indexOf(ss []string, s string) int {
+	for i := range ss {
+		if strings.TrimSpace(ss[i]) == s {
+			return i
+		}
+	}
+	return -1
+}
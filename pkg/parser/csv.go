@@ -2,35 +2,71 @@ package parser
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/marianogappa/ch/pkg/ch"
 )
 
 type CSVParser struct {
 	Separator  rune
+	Splitter   Splitter
 	DateFormat string
 	// If empty, will try to infer
 	LineFormat string
+	// If true, the first line holds column names rather than data
+	Header bool
+	// If set, picks and reorders the fields of every line before inference
+	Columns *ColumnSelector
+	// Number of lines sampled to infer the line format
+	InferLines int
+	// Fraction of a column's non-null sampled values that must parse as a type
+	InferThreshold float64
+	// Number of rows the parser may emit ahead of the consumer, so that neither
+	// waits on the other for every row of large inputs
+	BufferSize int
+	// Number of consecutive lines not matching the inferred line format after
+	// which the format is inferred again from them (e.g. because a deploy added
+	// a column to a log). Zero disables re-inference. Ignored if LineFormat is set.
+	DriftLines int
 }
 
+const (
+	// DefaultDriftLines is the number of consecutive mismatching lines that
+	// trigger re-inference of the line format.
+	DefaultDriftLines = 10
+	// DefaultBufferSize is the number of rows the parser may emit ahead of
+	// the consumer.
+	DefaultBufferSize = 1024
+)
+
 func NewCSVParser(separator rune, dateFormat string) *CSVParser {
+	splitter, _ := NewSplitter(string(separator))
 	return &CSVParser{
-		Separator:  separator,
-		DateFormat: dateFormat,
+		Separator:      separator,
+		Splitter:       splitter,
+		DateFormat:     dateFormat,
+		InferLines:     DefaultInferLines,
+		InferThreshold: DefaultInferThreshold,
+		DriftLines:     DefaultDriftLines,
+		BufferSize:     DefaultBufferSize,
 	}
 }
 
 func (p *CSVParser) Parse(in <-chan []byte) (<-chan ch.Row, error) {
-	out := make(chan ch.Row)
+	out := make(chan ch.Row, p.BufferSize)
 
 	go func() {
 		defer close(out)
 
 		var (
-			buffer   []string
+			buffer   [][]string
+			drift    [][]string
 			lf       LineFormat
+			schema   *ch.Schema
 			err      error
 			inferred bool
+			fr       = p.newFieldReader()
+			slab     = &rowSlab{}
 		)
 
 		// If format is already known, use it.
@@ -44,32 +80,58 @@ func (p *CSVParser) Parse(in <-chan []byte) (<-chan ch.Row, error) {
 			inferred = true
 		}
 
-		// Buffer for inference
-		const inferenceLines = 5
-
 		for lineBytes := range in {
-			line := string(lineBytes)
+			fields, ok, err := fr.read(lineBytes)
+			if err != nil {
+				ch.ReportError(fmt.Errorf("selecting columns: %v", err))
+				return
+			}
+			if !ok {
+				continue
+			}
 			if !inferred {
-				buffer = append(buffer, line)
-				if len(buffer) >= inferenceLines {
+				buffer = append(buffer, clone(fields))
+				if len(buffer) >= p.InferLines {
 					lf = p.infer(buffer)
 					inferred = true
 					// Process buffered lines
-					for _, l := range buffer {
-						p.emit(l, lf, out)
+					schema = p.schema(lf, fr)
+					for _, fs := range buffer {
+						p.emit(fs, lf, schema, slab, out)
 					}
 					buffer = nil
 				}
-			} else {
-				p.emit(line, lf, out)
+				continue
+			}
+			if schema == nil {
+				schema = p.schema(lf, fr)
+			}
+			if p.emit(fields, lf, schema, slab, out) {
+				drift = nil
+				continue
+			}
+			if p.LineFormat != "" || p.DriftLines <= 0 {
+				continue
+			}
+			// Sustained mismatches mean the shape of the stream changed
+			drift = append(drift, clone(fields))
+			if len(drift) >= p.DriftLines {
+				if dlf := p.infer(drift); dlf.String() != lf.String() {
+					lf, schema = dlf, p.schema(dlf, fr)
+				}
+				for _, fs := range drift {
+					p.emit(fs, lf, schema, slab, out)
+				}
+				drift = nil
 			}
 		}
 
-		// If stream ended before inferenceLines, infer from what we have
+		// If stream ended before InferLines, infer from what we have
 		if !inferred && len(buffer) > 0 {
 			lf = p.infer(buffer)
-			for _, l := range buffer {
-				p.emit(l, lf, out)
+			schema = p.schema(lf, fr)
+			for _, fs := range buffer {
+				p.emit(fs, lf, schema, slab, out)
 			}
 		}
 	}()
@@ -77,35 +139,126 @@ func (p *CSVParser) Parse(in <-chan []byte) (<-chan ch.Row, error) {
 	return out, nil
 }
 
-func (p *CSVParser) infer(lines []string) LineFormat {
-	counts := make(map[string]int)
-	for _, l := range lines {
-		fmtStr := InferLineFormat(l, p.Separator, p.DateFormat)
-		counts[fmtStr]++
+// Inspect reads up to InferLines lines of input and returns the Inference
+// that Parse would base the line format on, without emitting any rows.
+func (p *CSVParser) Inspect(in <-chan []byte) (Inference, error) {
+	var (
+		buffer [][]string
+		fr     = p.newFieldReader()
+	)
+	for lineBytes := range in {
+		fields, ok, err := fr.read(lineBytes)
+		if err != nil {
+			return Inference{}, err
+		}
+		if ok {
+			buffer = append(buffer, clone(fields))
+		}
+		if len(buffer) >= p.InferLines {
+			break
+		}
 	}
-
-	max := 0
-	best := ""
-	for k, v := range counts {
-		if v > max {
-			max = v
-			best = k
+	inf := Infer(buffer, p.DateFormat, p.InferThreshold)
+	for i := range inf.Columns {
+		if i < len(fr.names) {
+			inf.Columns[i].Name = fr.names[i]
 		}
 	}
+	return inf, nil
+}
 
-	lf, _ := NewLineFormat(best, p.Separator, p.DateFormat)
+func (p *CSVParser) infer(lines [][]string) LineFormat {
+	lf, _ := NewLineFormat(Infer(lines, p.DateFormat, p.InferThreshold).LineFormat(), p.Separator, p.DateFormat)
 	return lf
 }
 
-func (p *CSVParser) emit(line string, lf LineFormat, out chan<- ch.Row) {
-	fs, ss, ds, err := lf.ParseLine(line)
+// schema names the columns of the given line format, after the header if
+// there is one, or else after their 1-based position in the line, e.g. `$3`.
+func (p *CSVParser) schema(lf LineFormat, fr *fieldReader) *ch.Schema {
+	s := &ch.Schema{
+		Floats:     []string{},
+		Strings:    []string{},
+		DateTimes:  []string{},
+		DateFormat: p.DateFormat,
+	}
+	for i, colType := range lf.ColTypes {
+		name := fmt.Sprintf("$%v", i+1)
+		if p.Columns != nil && i < len(p.Columns.indices) {
+			name = fmt.Sprintf("$%v", p.Columns.indices[i]+1)
+		}
+		if i < len(fr.names) {
+			name = fr.names[i]
+		}
+		switch colType {
+		case String:
+			s.Strings = append(s.Strings, name)
+		case Float:
+			s.Floats = append(s.Floats, name)
+		case DateTime:
+			s.DateTimes = append(s.DateTimes, name)
+		}
+	}
+	return s
+}
+
+// emit sends the parsed line, returning false if it doesn't match the line format.
+func (p *CSVParser) emit(fields []string, lf LineFormat, schema *ch.Schema, slab *rowSlab, out chan<- ch.Row) bool {
+	fs, ss, ds, err := lf.parseFields(fields, slab)
 	if err != nil {
-		// Skip bad lines? Or log?
-		return
+		return false
 	}
 	out <- ch.Row{
 		Floats:    fs,
 		Strings:   ss,
 		DateTimes: ds,
+		Schema:    schema,
 	}
+	return true
+}
+
+// fieldReader splits lines of input into their selected fields, consuming
+// the header line if there is one. To avoid allocating on every line, it
+// reuses the returned slice on the next read.
+type fieldReader struct {
+	p        *CSVParser
+	header   bool
+	names    []string
+	fields   []string
+	selected []string
+}
+
+func (p *CSVParser) newFieldReader() *fieldReader {
+	return &fieldReader{p: p, header: p.Header || (p.Columns != nil && p.Columns.NeedsHeader())}
+}
+
+// read returns the selected fields of a line, or false if the line holds no
+// data: either it's the header or it lacks some selected column.
+func (r *fieldReader) read(line []byte) ([]string, bool, error) {
+	r.fields = r.p.Splitter.AppendSplit(r.fields[:0], string(line))
+	fields := r.fields
+	if r.header {
+		r.header = false
+		if r.p.Columns != nil {
+			if err := r.p.Columns.Resolve(fields); err != nil {
+				return nil, false, err
+			}
+			fields, _ = r.p.Columns.Select(fields)
+		}
+		for _, f := range fields {
+			r.names = append(r.names, strings.TrimSpace(f))
+		}
+		return nil, false, nil
+	}
+	if r.p.Columns != nil {
+		selected, err := r.p.Columns.AppendSelect(r.selected[:0], fields)
+		if err != nil {
+			return nil, false, nil
+		}
+		r.selected, fields = selected, selected
+	}
+	return fields, true, nil
+}
+
+func clone(fields []string) []string {
+	return append([]string(nil), fields...)
 }
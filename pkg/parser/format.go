@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -12,6 +13,7 @@ import (
 type LineFormat struct {
 	ColTypes   []ColType
 	Separator  rune
+	Splitter   Splitter
 	DateFormat string
 
 	HasFloats     bool
@@ -57,7 +59,11 @@ func NewLineFormat(lineFormat string, separator rune, dateFormat string) (LineFo
 	if ok, err := regexp.Match("[dfs ]*", []byte(lineFormat)); !ok || err != nil {
 		return LineFormat{}, fmt.Errorf("format: supplied lineFormat doesn't match syntax `[dfs ]*`")
 	}
-	var lf = LineFormat{ColTypes: nil, Separator: separator, DateFormat: dateFormat}
+	splitter, err := NewSplitter(string(separator))
+	if err != nil {
+		return LineFormat{}, err
+	}
+	var lf = LineFormat{ColTypes: nil, Separator: separator, Splitter: splitter, DateFormat: dateFormat}
 
 	for _, b := range lineFormat {
 		switch b {
@@ -92,17 +98,29 @@ func (l LineFormat) ParseLine(line string) ([]float64, []string, []string, error
 	// However, JSON marshaling time.Time is standard.
 	// Let's keep it as string in Row but ensure it's a valid date here.
 
-	line = string(regexp.MustCompile(string(l.Separator)+"{2,}").ReplaceAll([]byte(line), []byte(string(l.Separator))))
-	sp := strings.Split(strings.TrimSpace(line), string(l.Separator))
+	if l.Splitter == nil {
+		return l.ParseFields(SplitLine(line, l.Separator))
+	}
+	return l.ParseFields(l.Splitter.Split(line))
+}
 
-	fs := []float64{}
-	ss := []string{}
-	ds := []string{}
+// ParseFields parses the already split fields of one line of input according to the given format
+func (l LineFormat) ParseFields(sp []string) ([]float64, []string, []string, error) {
+	return l.parseFields(sp, nil)
+}
 
+// parseFields is ParseFields taking the returned slices from the given slab,
+// if not nil, rather than allocating them.
+func (l LineFormat) parseFields(sp []string, slab *rowSlab) ([]float64, []string, []string, error) {
 	if len(sp) < len(l.ColTypes) {
-		return fs, ss, ds, fmt.Errorf("Input line has invalid format length; expected %v vs found %v", len(l.ColTypes), len(sp))
+		return nil, nil, nil, fmt.Errorf("Input line has invalid format length; expected %v vs found %v", len(l.ColTypes), len(sp))
 	}
 
+	// Size the slices exactly, sharing one slice for strings and datetimes
+	fs, sds := slab.take(l.FloatCount, l.StringCount+l.DateTimeCount)
+	ss := sds[:0:l.StringCount]
+	ds := sds[l.StringCount:l.StringCount]
+
 	for i, colType := range l.ColTypes {
 		s := strings.TrimSpace(sp[i])
 		switch colType {
@@ -116,6 +134,11 @@ func (l LineFormat) ParseLine(line string) ([]float64, []string, []string, error
 			ds = append(ds, s) // Keep as string
 		case Float:
 			f, err := strconv.ParseFloat(s, 64)
+			if err != nil && nulls[s] {
+				// Inference tolerates null-like values in float columns, so
+				// they're missing values rather than invalid lines
+				f, err = math.NaN(), nil
+			}
 			if err != nil {
 				return fs, ss, ds, fmt.Errorf("Couldn't convert %v to float given: %v", s, err)
 			}
@@ -126,9 +149,58 @@ func (l LineFormat) ParseLine(line string) ([]float64, []string, []string, error
 	return fs, ss, ds, nil
 }
 
+// rowSlab hands out the slices of parsed rows from larger allocations shared
+// by slabRows rows, so that parsing a line doesn't allocate them. A nil
+// rowSlab allocates them on every call.
+type rowSlab struct {
+	floats  []float64
+	strings []string
+}
+
+// slabRows is the number of rows sharing each allocation of a rowSlab. Rows
+// keep their whole allocation from being garbage collected, so it's small.
+const slabRows = 256
+
+// take returns an empty slice with capacity for nf floats and a slice of ns
+// strings, none of which are shared with any other call.
+func (s *rowSlab) take(nf, ns int) ([]float64, []string) {
+	if s == nil {
+		return make([]float64, 0, nf), make([]string, ns)
+	}
+	if len(s.floats) < nf {
+		s.floats = make([]float64, slabRows*nf)
+	}
+	if len(s.strings) < ns {
+		s.strings = make([]string, slabRows*ns)
+	}
+	// Rows without floats or strings still get empty slices rather than nil
+	// ones, e.g. so that they're encoded as [] rather than null
+	fs, ss := []float64{}, []string{}
+	if nf > 0 {
+		fs, s.floats = s.floats[:0:nf], s.floats[nf:]
+	}
+	if ns > 0 {
+		ss, s.strings = s.strings[:ns:ns], s.strings[ns:]
+	}
+	return fs, ss
+}
+
+// SplitLine splits a line of input into its fields. Repeated separators are
+// treated as one.
+func SplitLine(s string, sep rune) []string {
+	splitter, err := NewSplitter(string(sep))
+	if err != nil {
+		return []string{s}
+	}
+	return splitter.Split(s)
+}
+
 func InferLineFormat(s string, sep rune, df string) string {
-	s = string(regexp.MustCompile(string(sep)+"{2,}").ReplaceAll([]byte(s), []byte(string(sep))))
-	ss := strings.Split(strings.TrimSpace(s), string(sep))
+	return InferFieldsFormat(SplitLine(s, sep), df)
+}
+
+// InferFieldsFormat infers the line format of the already split fields of one line of input
+func InferFieldsFormat(ss []string, df string) string {
 	lf := ""
 	for _, sc := range ss {
 		sc = strings.TrimSpace(sc)
@@ -0,0 +1,128 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// DefaultInferLines is the number of lines sampled to infer the line format.
+	DefaultInferLines = 100
+	// DefaultInferThreshold is the fraction of non-null sampled values of a
+	// column that must parse as a float (or datetime) for the column to be
+	// inferred as one.
+	DefaultInferThreshold = 0.9
+)
+
+// nulls are values that don't count towards the type of a column.
+var nulls = map[string]bool{"": true, "-": true, "N/A": true, "n/a": true, "NA": true, "null": true, "NULL": true, "None": true, "nil": true}
+
+// ColumnInference explains the type inferred for one column of input.
+type ColumnInference struct {
+	Name       string  // Column name, if the input has a header
+	Type       ColType // Inferred type
+	Confidence float64 // Fraction of non-null sampled values that parsed as Type
+	Floats     int     // Sampled values that parsed as floats
+	DateTimes  int     // Sampled values that parsed as datetimes
+	Strings    int     // Sampled values that parsed as neither
+	Nulls      int     // Sampled values that were empty or null-like (e.g. N/A)
+}
+
+// Inference is the result of inferring the line format of a sample of lines,
+// one column at a time.
+type Inference struct {
+	Lines   int // Number of sampled lines
+	Columns []ColumnInference
+}
+
+// Infer infers the type of every column of the given already split lines.
+// The number of columns is the most common number of fields in a line. A
+// column is a Float if at least `threshold` of its non-null values parse as
+// floats, else a DateTime if at least `threshold` parse with dateFormat,
+// else a String. A few noisy values (e.g. a header) don't flip the type.
+func Infer(lines [][]string, dateFormat string, threshold float64) Inference {
+	inf := Inference{Lines: len(lines)}
+	for i := 0; i < modeFieldCount(lines); i++ {
+		c := ColumnInference{}
+		for _, fields := range lines {
+			if i >= len(fields) {
+				continue
+			}
+			s := strings.TrimSpace(fields[i])
+			if nulls[s] {
+				c.Nulls++
+			} else if _, err := strconv.ParseFloat(s, 64); err == nil {
+				c.Floats++
+			} else if _, err := time.Parse(dateFormat, s); err == nil {
+				c.DateTimes++
+			} else {
+				c.Strings++
+			}
+		}
+		c.Type, c.Confidence = String, 0
+		if nonNull := c.Floats + c.DateTimes + c.Strings; nonNull > 0 {
+			c.Confidence = float64(c.Strings) / float64(nonNull)
+			if f := float64(c.Floats) / float64(nonNull); f >= threshold {
+				c.Type, c.Confidence = Float, f
+			} else if d := float64(c.DateTimes) / float64(nonNull); d >= threshold {
+				c.Type, c.Confidence = DateTime, d
+			}
+		}
+		inf.Columns = append(inf.Columns, c)
+	}
+	return inf
+}
+
+func modeFieldCount(lines [][]string) int {
+	var (
+		counts = make(map[int]int)
+		max    = 0
+		mode   = 0
+	)
+	for _, fields := range lines {
+		counts[len(fields)]++
+	}
+	for n, count := range counts {
+		if count > max || (count == max && n > mode) {
+			max, mode = count, n
+		}
+	}
+	return mode
+}
+
+// LineFormat returns the inferred line format string, e.g. `sfd`.
+func (inf Inference) LineFormat() string {
+	var bs = make([]byte, 0, len(inf.Columns))
+	for _, c := range inf.Columns {
+		bs = append(bs, c.Type.String()...)
+	}
+	return string(bs)
+}
+
+// String returns a report explaining the type inferred for every column.
+func (inf Inference) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Inferred line format %q from %v lines\n\n", inf.LineFormat(), inf.Lines)
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "column\tname\ttype\tconfidence\tfloats\tdatetimes\tstrings\tnulls")
+	for i, c := range inf.Columns {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%.1f%%\t%v\t%v\t%v\t%v\n", i+1, c.Name, typeName(c.Type), c.Confidence*100, c.Floats, c.DateTimes, c.Strings, c.Nulls)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+func typeName(c ColType) string {
+	switch c {
+	case Float:
+		return "float"
+	case DateTime:
+		return "datetime"
+	default:
+		return "string"
+	}
+}
@@ -1,6 +1,10 @@
 package parser
 
 import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/marianogappa/ch/pkg/ch"
@@ -152,6 +156,14 @@ func TestLineFormat_ParseLine(t *testing.T) {
 			input:       "2021-01-01",
 			expectDates: []string{"2021-01-01"},
 		},
+		{
+			name:          "Regex metacharacter separator",
+			format:        "sf",
+			sep:           '|',
+			input:         "hello||1.0",
+			expectFloats:  []float64{1.0},
+			expectStrings: []string{"hello"},
+		},
 		{
 			name:    "Invalid Float",
 			format:  "f",
@@ -204,3 +216,416 @@ func TestLineFormat_ParseLine(t *testing.T) {
 		})
 	}
 }
+
+func TestLineFormat_ParseLine_Nulls(t *testing.T) {
+	lf, err := NewLineFormat("sf", '\t', "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, null := range []string{"N/A", "-", "null"} {
+		fs, _, _, err := lf.ParseLine("b\t" + null)
+		if err != nil || len(fs) != 1 || !math.IsNaN(fs[0]) {
+			t.Errorf("ParseLine(%q) = %v, %v; want a NaN float", "b\t"+null, fs, err)
+		}
+	}
+}
+
+func TestColumnSelector(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     string
+		header   []string
+		fields   []string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "By index",
+			spec:     "3,1",
+			fields:   []string{"a", "b", "c"},
+			expected: []string{"c", "a"},
+		},
+		{
+			name:     "By name",
+			spec:     "latency,name",
+			header:   []string{"name", "host", " latency "},
+			fields:   []string{"a", "b", "c"},
+			expected: []string{"c", "a"},
+		},
+		{
+			name:     "Mixed",
+			spec:     "latency,2",
+			header:   []string{"name", "host", "latency"},
+			fields:   []string{"a", "b", "c"},
+			expected: []string{"c", "b"},
+		},
+		{
+			name:    "Index out of range",
+			spec:    "4",
+			fields:  []string{"a", "b", "c"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewColumnSelector(tt.spec)
+			if err != nil {
+				t.Fatalf("NewColumnSelector() error = %v", err)
+			}
+			if c.NeedsHeader() != (tt.header != nil) {
+				t.Errorf("NeedsHeader() = %v, want %v", c.NeedsHeader(), tt.header != nil)
+			}
+			if tt.header != nil {
+				if err := c.Resolve(tt.header); err != nil {
+					t.Fatalf("Resolve() error = %v", err)
+				}
+			}
+			got, err := c.Select(tt.fields)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Select() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+
+	for _, spec := range []string{"0", "1,,2", "-1"} {
+		if _, err := NewColumnSelector(spec); err == nil {
+			t.Errorf("NewColumnSelector(%q) expected error", spec)
+		}
+	}
+
+	c, _ := NewColumnSelector("missing")
+	if err := c.Resolve([]string{"name"}); err == nil {
+		t.Error("Resolve() expected error for unknown column")
+	}
+}
+
+func TestCSVParser_Columns(t *testing.T) {
+	c, err := NewColumnSelector("latency,name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewCSVParser(',', "")
+	p.Columns = c
+
+	in := make(chan []byte, 3)
+	in <- []byte("name,host,latency")
+	in <- []byte("a,h1,10")
+	in <- []byte("b,h2,20")
+	close(in)
+
+	out, err := p.Parse(in)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var rows []ch.Row
+	for r := range out {
+		rows = append(rows, r)
+	}
+
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"name"}, DateTimes: []string{}}
+	expected := []ch.Row{
+		{Floats: []float64{10}, Strings: []string{"a"}, DateTimes: []string{}, Schema: schema},
+		{Floats: []float64{20}, Strings: []string{"b"}, DateTimes: []string{}, Schema: schema},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Parse() = %v, want %v", rows, expected)
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		separator string
+		regex     string
+		input     string
+		expected  []string
+	}{
+		{
+			name:      "Single character",
+			separator: ",",
+			input:     "a,,b,c",
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "Regex metacharacters are literal",
+			separator: ".",
+			input:     "a.b..c",
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "Multi-character",
+			separator: "::",
+			input:     "a::b:c::::d",
+			expected:  []string{"a", "b:c", "d"},
+		},
+		{
+			name:      "Padded multi-character",
+			separator: " | ",
+			input:     " a | b | c ",
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:      "Whitespace",
+			separator: " ",
+			input:     "  a \t b\t\tc  ",
+			expected:  []string{"a", "b", "c"},
+		},
+		{
+			name:     "Regex",
+			regex:    `\s*[;|]\s*`,
+			input:    "a ; b|c",
+			expected: []string{"a", "b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				s   Splitter
+				err error
+			)
+			if tt.regex != "" {
+				s, err = NewRegexSplitter(tt.regex)
+			} else {
+				s, err = NewSplitter(tt.separator)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := s.Split(tt.input); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Split() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := NewSplitter(""); err == nil {
+		t.Error("NewSplitter() expected error for empty separator")
+	}
+	if _, err := NewRegexSplitter("("); err == nil {
+		t.Error("NewRegexSplitter() expected error for invalid regex")
+	}
+}
+
+func TestInfer(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     [][]string
+		df        string
+		threshold float64
+		expected  string
+	}{
+		{
+			name:      "Noisy header doesn't flip the format",
+			lines:     [][]string{{"name", "latency"}, {"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}, {"e", "5"}},
+			threshold: 0.8,
+			expected:  "sf",
+		},
+		{
+			name:      "Nulls don't count",
+			lines:     [][]string{{"a", "N/A"}, {"b", "2"}, {"c", ""}, {"d", "4"}},
+			threshold: 0.9,
+			expected:  "sf",
+		},
+		{
+			name:      "Below threshold is a string",
+			lines:     [][]string{{"a", "1"}, {"b", "x"}, {"c", "y"}, {"d", "4"}},
+			threshold: 0.9,
+			expected:  "ss",
+		},
+		{
+			name:      "Dates",
+			lines:     [][]string{{"2021-01-01", "1"}, {"2021-01-02", "2"}},
+			df:        "2006-01-02",
+			threshold: 0.9,
+			expected:  "df",
+		},
+		{
+			name:      "Most common field count wins",
+			lines:     [][]string{{"1", "2", "3"}, {"1", "2"}, {"3", "4"}},
+			threshold: 0.9,
+			expected:  "ff",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Infer(tt.lines, tt.df, tt.threshold).LineFormat(); got != tt.expected {
+				t.Errorf("Infer() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCSVParser_Inspect(t *testing.T) {
+	p := NewCSVParser(',', "")
+	p.Header = true
+	p.InferLines = 3
+
+	in := make(chan []byte, 5)
+	for _, l := range []string{"host,latency", "a,1", "b,N/A", "c,3", "d,x"} {
+		in <- []byte(l)
+	}
+	close(in)
+
+	inf, err := p.Inspect(in)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	expected := Inference{
+		Lines: 3,
+		Columns: []ColumnInference{
+			{Name: "host", Type: String, Confidence: 1, Strings: 3},
+			{Name: "latency", Type: Float, Confidence: 1, Floats: 2, Nulls: 1},
+		},
+	}
+	if !reflect.DeepEqual(inf, expected) {
+		t.Errorf("Inspect() = %+v, want %+v", inf, expected)
+	}
+	if !strings.Contains(inf.String(), "latency  float") {
+		t.Errorf("Unexpected report:\n%v", inf)
+	}
+}
+
+func TestCSVParser_Drift(t *testing.T) {
+	p := NewCSVParser(',', "")
+	p.InferLines = 2
+	p.DriftLines = 2
+
+	lines := []string{"a,1", "b,2", "c,3", "d,x,4", "e,y,5", "f,z,6", "g,7"}
+	in := make(chan []byte, len(lines))
+	for _, l := range lines {
+		in <- []byte(l)
+	}
+	close(in)
+
+	out, err := p.Parse(in)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	var rows []ch.Row
+	for r := range out {
+		rows = append(rows, r)
+	}
+
+	if len(rows) != 6 {
+		t.Fatalf("Expected 6 rows, got %d: %v", len(rows), rows)
+	}
+	before, after := rows[0].Schema, rows[3].Schema
+	if rows[2].Schema != before || rows[5].Schema != after {
+		t.Errorf("Expected rows parsed with the same format to share their schema")
+	}
+	if !reflect.DeepEqual(before.Strings, []string{"$1"}) || !reflect.DeepEqual(before.Floats, []string{"$2"}) {
+		t.Errorf("Unexpected schema before drift: %v", before)
+	}
+	if !reflect.DeepEqual(after.Strings, []string{"$1", "$2"}) || !reflect.DeepEqual(after.Floats, []string{"$3"}) {
+		t.Errorf("Unexpected schema after drift: %v", after)
+	}
+	if !reflect.DeepEqual(rows[3].Strings, []string{"d", "x"}) || rows[3].Floats[0] != 4 {
+		t.Errorf("Expected drifting lines to be emitted after re-inference, got %v", rows[3])
+	}
+}
+
+func TestSplitter_AppendSplitDoesNotAllocate(t *testing.T) {
+	for _, sep := range []string{"\t", " ", "::"} {
+		s, _ := NewSplitter(sep)
+		line := strings.Join([]string{"host1", "12.5", "2021-01-02", "36"}, sep)
+		dst := make([]string, 0, 8)
+		if allocs := testing.AllocsPerRun(100, func() { dst = s.AppendSplit(dst[:0], line) }); allocs != 0 {
+			t.Errorf("AppendSplit() with separator %q allocated %v times per line", sep, allocs)
+		}
+	}
+}
+
+func TestLineFormat_ParseFieldsFromSlabDoesNotAllocate(t *testing.T) {
+	lf, _ := NewLineFormat("sfdf", '\t', "2006-01-02")
+	fields := []string{"host1", "12.5", "2021-01-02", "36"}
+	slab := &rowSlab{}
+	// Only one in slabRows lines allocates, which rounds down to none per line
+	if allocs := testing.AllocsPerRun(100, func() { lf.parseFields(fields, slab) }); allocs != 0 {
+		t.Errorf("parseFields() allocated %v times per line", allocs)
+	}
+	fs, ss, ds, _ := lf.parseFields(fields, slab)
+	if cap(fs) != 2 || cap(ss) != 1 || cap(ds) != 1 {
+		t.Errorf("Expected slices not to share capacity with other rows, got %v %v %v", cap(fs), cap(ss), cap(ds))
+	}
+
+	// Rows of no floats or no strings get empty slices, which JSON encodes as []
+	lf, _ = NewLineFormat("d", '\t', "2006-01-02")
+	fs, ss, _, _ = lf.parseFields([]string{"2021-01-02"}, &rowSlab{})
+	if fs == nil || ss == nil {
+		t.Errorf("Expected empty slices, got %#v %#v", fs, ss)
+	}
+}
+
+func benchmarkLines(n int) [][]byte {
+	lines := make([][]byte, n)
+	for i := range lines {
+		lines[i] = []byte(fmt.Sprintf("host%d\t%d.5\t2021-01-%02d\t%d", i%10, i, i%28+1, i*3))
+	}
+	return lines
+}
+
+// BenchmarkCSVParser parses inputs of up to millions of lines, like the
+// exports ch is meant to chart.
+func BenchmarkCSVParser(b *testing.B) {
+	for _, n := range []int{100000, 5000000} {
+		b.Run(fmt.Sprintf("%v lines", n), func(b *testing.B) {
+			lines := benchmarkLines(n)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for range b.N {
+				p := NewCSVParser('\t', "2006-01-02")
+				in := make(chan []byte, 1024)
+				go func() {
+					for _, l := range lines {
+						in <- l
+					}
+					close(in)
+				}()
+				out, _ := p.Parse(in)
+				for range out {
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkParse parses lines like the CSVParser does, which allocates only
+// the copy of each line that its string fields share.
+func BenchmarkParse(b *testing.B) {
+	lf, _ := NewLineFormat("sfdf", '\t', "2006-01-02")
+	lines := benchmarkLines(1000)
+	fr, slab := NewCSVParser('\t', "2006-01-02").newFieldReader(), &rowSlab{}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		fields, _, _ := fr.read(lines[n%len(lines)])
+		if _, _, _, err := lf.parseFields(fields, slab); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLineFormat_ParseLine(b *testing.B) {
+	lf, _ := NewLineFormat("sfdf", '\t', "2006-01-02")
+	line := "host1\t12.5\t2021-01-02\t36"
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, _, _, err := lf.ParseLine(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSplitter_AppendSplit(b *testing.B) {
+	s, _ := NewSplitter("\t")
+	line := "host1\t12.5\t2021-01-02\t36"
+	dst := make([]string, 0, 8)
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		dst = s.AppendSplit(dst[:0], line)
+	}
+}
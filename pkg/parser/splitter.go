@@ -0,0 +1,108 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Splitter splits a line of input into its fields.
+type Splitter interface {
+	Split(line string) []string
+	// AppendSplit appends the fields of line to dst and returns the extended
+	// slice, so that callers can reuse dst across lines without allocating.
+	AppendSplit(dst []string, line string) []string
+}
+
+// NewSplitter creates a Splitter for a literal separator of any length, e.g.
+// `,`, `::` or ` | `. Repeated separators are treated as one. A single space
+// splits on any run of whitespace, like awk's default field separator.
+func NewSplitter(separator string) (Splitter, error) {
+	if separator == "" {
+		return nil, fmt.Errorf("separator: separator can't be empty")
+	}
+	if separator == " " {
+		return WhitespaceSplitter{}, nil
+	}
+	return separatorSplitter{separator}, nil
+}
+
+// NewRegexSplitter creates a Splitter that splits on every match of the given
+// regular expression, e.g. `\s*[,;]\s*`.
+func NewRegexSplitter(expr string) (Splitter, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("separator: invalid regex separator: %v", err)
+	}
+	return regexSplitter{re}, nil
+}
+
+type separatorSplitter struct {
+	separator string
+}
+
+func (s separatorSplitter) Split(line string) []string {
+	return s.AppendSplit(nil, line)
+}
+
+func (s separatorSplitter) AppendSplit(dst []string, line string) []string {
+	line = strings.TrimSpace(line)
+	for {
+		i := strings.Index(line, s.separator)
+		if i == -1 {
+			return append(dst, line)
+		}
+		dst = append(dst, line[:i])
+		line = line[i+len(s.separator):]
+		for strings.HasPrefix(line, s.separator) {
+			line = line[len(s.separator):]
+		}
+	}
+}
+
+type regexSplitter struct {
+	re *regexp.Regexp
+}
+
+func (s regexSplitter) Split(line string) []string {
+	return s.re.Split(strings.TrimSpace(line), -1)
+}
+
+func (s regexSplitter) AppendSplit(dst []string, line string) []string {
+	return append(dst, s.Split(line)...)
+}
+
+// WhitespaceSplitter splits on any run of whitespace, ignoring leading and
+// trailing whitespace.
+type WhitespaceSplitter struct{}
+
+func (w WhitespaceSplitter) Split(line string) []string {
+	return w.AppendSplit(nil, line)
+}
+
+func (WhitespaceSplitter) AppendSplit(dst []string, line string) []string {
+	start := -1
+	for i, r := range line {
+		if isSpace(r) {
+			if start >= 0 {
+				dst = append(dst, line[start:i])
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		dst = append(dst, line[start:])
+	}
+	return dst
+}
+
+func isSpace(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '\v' || r == '\f'
+	}
+	return unicode.IsSpace(r)
+}
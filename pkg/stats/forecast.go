@@ -0,0 +1,223 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+)
+
+// Forecast is a series' predicted values some steps ahead, with the standard
+// error of each prediction.
+type Forecast struct {
+	Values  []float64
+	StdErrs []float64
+}
+
+// HoltWinters forecasts the horizon values following ys, which are evenly
+// spaced, with additive Holt-Winters exponential smoothing of their level,
+// trend and seasonal component of the given period (none if it's under 2,
+// which is Holt's linear trend method). The smoothing factors are chosen to
+// minimise the errors of one step ahead predictions over ys, and the standard
+// error of a prediction h steps ahead is approximated as that of one step
+// ahead times √h, or NaN if there are too few predictions to estimate it
+// given the smoothing factors fitted to them. NaN values are replaced by
+// their prediction.
+func HoltWinters(ys []float64, period, horizon int) (Forecast, error) {
+	if period < 2 {
+		period = 0
+	}
+	if len(ys) < max(2, 2*period) {
+		return Forecast{}, fmt.Errorf("Holt-Winters needs at least %v values, but got %v", max(2, 2*period), len(ys))
+	}
+	factors := []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9}
+	gammas := factors
+	if period == 0 {
+		gammas = []float64{0}
+	}
+	var (
+		best  *holtWinters
+		bestE = math.Inf(1)
+	)
+	for _, a := range factors {
+		for _, b := range factors {
+			for _, g := range gammas {
+				hw, err := newHoltWinters(ys, period)
+				if err != nil {
+					return Forecast{}, err
+				}
+				if sse := hw.smooth(ys, a, b, g); sse < bestE {
+					best, bestE = hw, sse
+				}
+			}
+		}
+	}
+	if best == nil || best.n == 0 {
+		return Forecast{}, fmt.Errorf("too few values to forecast")
+	}
+	// Like LinearTrend's, the errors are corrected for the fitted parameters
+	params := 2
+	if period > 0 {
+		params = 3
+	}
+	sigma := math.NaN()
+	if df := best.n - params; df > 0 {
+		sigma = math.Sqrt(bestE / float64(df))
+	}
+
+	f := Forecast{Values: make([]float64, horizon), StdErrs: make([]float64, horizon)}
+	for h := 1; h <= horizon; h++ {
+		f.Values[h-1] = best.level + float64(h)*best.trend
+		if period > 0 {
+			f.Values[h-1] += best.season[(len(ys)+h-1)%period]
+		}
+		f.StdErrs[h-1] = sigma * math.Sqrt(float64(h))
+	}
+	return f, nil
+}
+
+// holtWinters is the state of Holt-Winters smoothing.
+type holtWinters struct {
+	period       int
+	level, trend float64
+	season       []float64
+	start        int // the first value that is smoothed rather than initialising the state
+	n            int // the number of predictions checked
+}
+
+// newHoltWinters initialises the state from the first two seasons of ys, or
+// from its first two values if there's no seasonality.
+func newHoltWinters(ys []float64, period int) (*holtWinters, error) {
+	hw := &holtWinters{period: period}
+	if period == 0 {
+		hw.level, hw.trend, hw.start = ys[0], ys[1]-ys[0], 1
+		if math.IsNaN(hw.trend) {
+			return nil, fmt.Errorf("Holt-Winters needs the first two values not to be NaN")
+		}
+		return hw, nil
+	}
+	first, second := finiteMean(ys[:period]), finiteMean(ys[period:2*period])
+	if math.IsNaN(first) || math.IsNaN(second) {
+		return nil, fmt.Errorf("Holt-Winters needs values within each of the first two seasons")
+	}
+	// The first season's mean is its level at its middle
+	hw.trend, hw.start = (second-first)/float64(period), period
+	middle := float64(period-1) / 2
+	hw.level = first + middle*hw.trend
+	hw.season = make([]float64, period)
+	for i := range hw.season {
+		if !math.IsNaN(ys[i]) {
+			hw.season[i] = ys[i] - (first + (float64(i)-middle)*hw.trend)
+		}
+	}
+	return hw, nil
+}
+
+// smooth updates the state with ys from its start, returning the sum of the
+// squared errors of the predictions of each value.
+func (hw *holtWinters) smooth(ys []float64, alpha, beta, gamma float64) float64 {
+	var sse float64
+	for t := hw.start; t < len(ys); t++ {
+		var s float64
+		if hw.period > 0 {
+			s = hw.season[t%hw.period]
+		}
+		predicted := hw.level + hw.trend + s
+		y := ys[t]
+		if math.IsNaN(y) || math.IsInf(y, 0) {
+			y = predicted
+		} else {
+			sse += (y - predicted) * (y - predicted)
+			hw.n++
+		}
+		level := alpha*(y-s) + (1-alpha)*(hw.level+hw.trend)
+		hw.trend = beta*(level-hw.level) + (1-beta)*hw.trend
+		if hw.period > 0 {
+			hw.season[t%hw.period] = gamma*(y-level) + (1-gamma)*s
+		}
+		hw.level = level
+	}
+	return sse
+}
+
+// LinearTrend forecasts the horizon values following ys, which are evenly
+// spaced, by extending the lines of a common slope fitted to the values at
+// each position within a season of the given period (a single line if it's
+// under 2) by least squares. The standard errors are those of the lines'
+// prediction intervals, or NaN if there are too few values to estimate them
+// (e.g. a line through 2 values, which fits them exactly whatever their noise).
+func LinearTrend(ys []float64, period, horizon int) (Forecast, error) {
+	period = max(1, period)
+	var (
+		n            = make([]float64, period)
+		meanX, meanY = make([]float64, period), make([]float64, period)
+		total        float64
+	)
+	for i, y := range ys {
+		if !math.IsNaN(y) && !math.IsInf(y, 0) {
+			k := i % period
+			n[k]++
+			meanX[k] += float64(i)
+			meanY[k] += y
+			total++
+		}
+	}
+	for k := range n {
+		if n[k] == 0 {
+			return Forecast{}, fmt.Errorf("a linear trend with seasons of %v values needs values at each position within them", period)
+		}
+		meanX[k] /= n[k]
+		meanY[k] /= n[k]
+	}
+	var sxy, sxx float64
+	for i, y := range ys {
+		if !math.IsNaN(y) && !math.IsInf(y, 0) {
+			k := i % period
+			sxy += (float64(i) - meanX[k]) * (y - meanY[k])
+			sxx += (float64(i) - meanX[k]) * (float64(i) - meanX[k])
+		}
+	}
+	if sxx == 0 {
+		return Forecast{}, fmt.Errorf("too few values to fit a linear trend")
+	}
+	slope := sxy / sxx
+	at := func(i int) float64 {
+		k := i % period
+		return meanY[k] + slope*(float64(i)-meanX[k])
+	}
+
+	var sse float64
+	for i, y := range ys {
+		if !math.IsNaN(y) && !math.IsInf(y, 0) {
+			sse += (y - at(i)) * (y - at(i))
+		}
+	}
+	sigma := math.NaN()
+	if df := total - float64(period) - 1; df > 0 {
+		sigma = math.Sqrt(sse / df)
+	}
+
+	f := Forecast{Values: make([]float64, horizon), StdErrs: make([]float64, horizon)}
+	for h := 1; h <= horizon; h++ {
+		i := len(ys) + h - 1
+		k := i % period
+		d := float64(i) - meanX[k]
+		f.Values[h-1] = at(i)
+		f.StdErrs[h-1] = sigma * math.Sqrt(1+1/n[k]+d*d/sxx)
+	}
+	return f, nil
+}
+
+// NormalQuantile returns the z such that a normally distributed value lies
+// within ±z standard deviations of its mean with the given probability.
+func NormalQuantile(confidence float64) float64 {
+	return math.Sqrt2 * math.Erfinv(confidence)
+}
+
+func finiteMean(xs []float64) float64 {
+	var sum, n float64
+	for _, x := range xs {
+		if !math.IsNaN(x) && !math.IsInf(x, 0) {
+			sum, n = sum+x, n+1
+		}
+	}
+	return sum / n
+}
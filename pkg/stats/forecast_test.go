@@ -0,0 +1,88 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHoltWinters(t *testing.T) {
+	tests := []struct {
+		name   string
+		ys     []float64
+		period int
+		want   []float64
+	}{
+		{name: "Trend", ys: []float64{10, 12, 14, 16, 18, 20, 22, 24}, want: []float64{26, 28, 30}},
+		{name: "Seasonal", ys: []float64{1, 5, 1, 5, 1, 5, 1, 5, 1, 5}, period: 2, want: []float64{1, 5, 1}},
+		{name: "Seasonal with trend", ys: []float64{0, 10, 2, 12, 4, 14, 6, 16, 8, 18}, period: 2, want: []float64{10, 20, 12}},
+		{name: "NaN", ys: []float64{10, 12, math.NaN(), 16, 18, 20}, want: []float64{22, 24, 26}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := HoltWinters(tt.ys, tt.period, len(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, want := range tt.want {
+				if math.Abs(f.Values[i]-want) > 1e-6 {
+					t.Errorf("Values = %v, want %v", f.Values, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestHoltWinters_StdErrs(t *testing.T) {
+	f, err := HoltWinters([]float64{10, 13, 11, 14, 12, 15, 13, 16}, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h := 1; h < len(f.StdErrs); h++ {
+		if f.StdErrs[h] <= f.StdErrs[h-1] {
+			t.Errorf("StdErrs = %v, want them to grow with the horizon", f.StdErrs)
+		}
+	}
+	// Smoothing factors fitted to 2 predictions fit them too well to tell
+	if f, err := HoltWinters([]float64{10, 13, 11}, 0, 2); err != nil || !math.IsNaN(f.StdErrs[0]) {
+		t.Errorf("StdErrs = %v, %v, want NaN from 3 values", f.StdErrs, err)
+	}
+	if _, err := HoltWinters([]float64{1, 2, 3}, 2, 1); err == nil {
+		t.Error("Expected an error for less than two seasons of values")
+	}
+}
+
+func TestLinearTrend(t *testing.T) {
+	f, err := LinearTrend([]float64{0, 10, 2, 12, 4, 14, 6, 16}, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(f.Values[0]-8) > 1e-6 || math.Abs(f.Values[1]-18) > 1e-6 {
+		t.Errorf("Values = %v, want [8 18]", f.Values)
+	}
+	if f.StdErrs[0] > 1e-6 {
+		t.Errorf("StdErrs = %v, want none for an exact fit", f.StdErrs)
+	}
+
+	f, err = LinearTrend([]float64{1, 3, 2, 4, 3, 5}, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !(f.StdErrs[0] > 0 && f.StdErrs[0] < f.StdErrs[2]) {
+		t.Errorf("StdErrs = %v, want them to grow away from the data", f.StdErrs)
+	}
+
+	f, err = LinearTrend([]float64{1, 3}, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(f.Values[0]-5) > 1e-6 || !math.IsNaN(f.StdErrs[0]) {
+		t.Errorf("Forecast = %+v, want 5 without a standard error", f)
+	}
+}
+
+func TestNormalQuantile(t *testing.T) {
+	if got := NormalQuantile(0.95); math.Abs(got-1.96) > 0.001 {
+		t.Errorf("NormalQuantile(0.95) = %v, want 1.96", got)
+	}
+}
@@ -0,0 +1,68 @@
+package stats
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision is the number of bits of a hash that pick a register, so
+// there are 2^14 registers (16KB) and estimates are within about 0.8%.
+const hllPrecision = 14
+
+// HyperLogLog estimates the number of distinct values added to it, in
+// constant memory however many there are.
+type HyperLogLog struct {
+	registers []uint8
+}
+
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// Add adds a value.
+func (h *HyperLogLog) Add(value string) {
+	f := fnv.New64a()
+	f.Write([]byte(value))
+	x := mix64(f.Sum64())
+
+	// The first bits pick a register, which keeps the longest run of leading
+	// zeros of the rest of the bits of its values' hashes
+	i := x >> (64 - hllPrecision)
+	rho := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rho > h.registers[i] {
+		h.registers[i] = rho
+	}
+}
+
+// Count returns the estimated number of distinct values added.
+func (h *HyperLogLog) Count() float64 {
+	var (
+		m     = float64(len(h.registers))
+		sum   float64
+		zeros float64
+	)
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Few values leave many registers empty, which linear counting estimates better
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/zeros)
+	}
+	return math.Round(estimate)
+}
+
+// mix64 spreads the bits of FNV hashes, whose high bits are poorly
+// distributed for similar values (the finaliser of MurmurHash3).
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
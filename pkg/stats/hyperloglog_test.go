@@ -0,0 +1,20 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		h := NewHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("user-%v", i))
+			h.Add(fmt.Sprintf("user-%v", i)) // duplicates don't count
+		}
+		if got := h.Count(); math.Abs(got-float64(n)) > 0.02*float64(n) {
+			t.Errorf("Count() = %v, want about %v", got, n)
+		}
+	}
+}
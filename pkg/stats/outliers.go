@@ -0,0 +1,83 @@
+package stats
+
+import "math"
+
+// ZScoreOutliers returns whether each of xs lies more than threshold
+// standard deviations away from their mean. NaN values aren't outliers.
+func ZScoreOutliers(xs []float64, threshold float64) []bool {
+	finite := finiteValues(xs)
+	m, sd := Mean(finite), StdDev(finite)
+	return flag(xs, func(x float64) bool { return sd > 0 && math.Abs(x-m)/sd > threshold })
+}
+
+// MADOutliers returns whether each of xs has a modified z-score (its distance
+// from their median in median absolute deviations, scaled to be comparable
+// to standard deviations) above threshold, which is robust to the outliers
+// themselves. If most values are equal, the mean absolute deviation is used.
+// NaN values aren't outliers.
+func MADOutliers(xs []float64, threshold float64) []bool {
+	finite := finiteValues(xs)
+	med := Median(finite)
+	devs := make([]float64, len(finite))
+	for i, x := range finite {
+		devs[i] = math.Abs(x - med)
+	}
+	scale := Median(devs) / 0.6745
+	if scale == 0 {
+		scale = Mean(devs) * 1.2533
+	}
+	return flag(xs, func(x float64) bool { return scale > 0 && math.Abs(x-med)/scale > threshold })
+}
+
+// IQROutliers returns whether each of xs lies more than k interquartile
+// ranges below their first quartile or above their third (Tukey's fences).
+// NaN values aren't outliers.
+func IQROutliers(xs []float64, k float64) []bool {
+	sorted := Sorted(finiteValues(xs))
+	q1, q3 := Quantile(sorted, 0.25), Quantile(sorted, 0.75)
+	lo, hi := q1-k*(q3-q1), q3+k*(q3-q1)
+	return flag(xs, func(x float64) bool { return x < lo || x > hi })
+}
+
+// SeasonalOutliers returns whether the residual of each of xs, which are
+// evenly spaced, from the median of the values at its position within a
+// season of the given period is a MAD outlier. Without seasonality (a period
+// under 2), it's the same as MADOutliers.
+func SeasonalOutliers(xs []float64, period int, threshold float64) []bool {
+	if period < 2 {
+		return MADOutliers(xs, threshold)
+	}
+	positions := make([][]float64, period)
+	for i, x := range xs {
+		if !math.IsNaN(x) && !math.IsInf(x, 0) {
+			positions[i%period] = append(positions[i%period], x)
+		}
+	}
+	medians := make([]float64, period)
+	for k, p := range positions {
+		medians[k] = Median(p)
+	}
+	residuals := make([]float64, len(xs))
+	for i, x := range xs {
+		residuals[i] = x - medians[i%period]
+	}
+	return MADOutliers(residuals, threshold)
+}
+
+func finiteValues(xs []float64) []float64 {
+	var finite []float64
+	for _, x := range xs {
+		if !math.IsNaN(x) && !math.IsInf(x, 0) {
+			finite = append(finite, x)
+		}
+	}
+	return finite
+}
+
+func flag(xs []float64, outlier func(float64) bool) []bool {
+	flags := make([]bool, len(xs))
+	for i, x := range xs {
+		flags[i] = !math.IsNaN(x) && !math.IsInf(x, 0) && outlier(x)
+	}
+	return flags
+}
@@ -0,0 +1,51 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestOutliers(t *testing.T) {
+	xs := []float64{10, 12, 11, 13, 12, 11, 95, 12, math.NaN(), 10, 11, 13}
+	want := []bool{false, false, false, false, false, false, true, false, false, false, false, false}
+	tests := []struct {
+		name     string
+		outliers []bool
+	}{
+		{name: "zscore", outliers: ZScoreOutliers(xs, 3)},
+		{name: "mad", outliers: MADOutliers(xs, 3.5)},
+		{name: "iqr", outliers: IQROutliers(xs, 1.5)},
+		{name: "seasonal without seasons", outliers: SeasonalOutliers(xs, 0, 3.5)},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.outliers, want) {
+			t.Errorf("%v outliers = %v, want %v", tt.name, tt.outliers, want)
+		}
+	}
+}
+
+func TestMADOutliers_EqualValues(t *testing.T) {
+	// The MAD of mostly equal values is zero, so the mean deviation is used
+	got := MADOutliers([]float64{5, 5, 5, 5, 5, 5, 5, 6, 5, 50}, 3.5)
+	want := []bool{false, false, false, false, false, false, false, false, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MADOutliers() = %v, want %v", got, want)
+	}
+	if got := MADOutliers([]float64{5, 5, 5}, 3.5); !reflect.DeepEqual(got, []bool{false, false, false}) {
+		t.Errorf("MADOutliers() = %v, want no outliers among equal values", got)
+	}
+}
+
+func TestSeasonalOutliers(t *testing.T) {
+	// Peaks every other value are normal, but a peak out of season isn't
+	xs := []float64{1, 50, 2, 51, 1, 49, 2, 50, 48, 51, 1, 50}
+	want := make([]bool, len(xs))
+	want[8] = true
+	if got := SeasonalOutliers(xs, 2, 3.5); !reflect.DeepEqual(got, want) {
+		t.Errorf("SeasonalOutliers() = %v, want %v", got, want)
+	}
+	if got := MADOutliers(xs, 3.5); reflect.DeepEqual(got, want) {
+		t.Error("Expected the out of season peak not to stand out without seasons")
+	}
+}
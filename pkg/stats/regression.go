@@ -0,0 +1,337 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fit is a curve fitted to points by regression.
+type Fit struct {
+	Name     string                  // e.g. "linear"
+	Equation string                  // e.g. "y = 2.5x + 1"
+	R2       float64                 // coefficient of determination
+	At       func(x float64) float64 // the fitted y at x
+}
+
+// Fitter fits a curve to the points with the given coordinates.
+type Fitter func(xs, ys []float64) (Fit, error)
+
+// ParseFitter returns the Fitter for a spec like linear, poly (of degree 2),
+// poly:3, exp or loess:0.5 (the fraction of points each local regression
+// spans, 0.3 by default).
+func ParseFitter(spec string) (Fitter, error) {
+	name, param, hasParam := strings.Cut(strings.TrimSpace(spec), ":")
+	switch name {
+	case "linear":
+		if !hasParam {
+			return FitLinear, nil
+		}
+	case "exp":
+		if !hasParam {
+			return FitExponential, nil
+		}
+	case "poly":
+		degree := 2
+		if hasParam {
+			d, err := strconv.Atoi(param)
+			if err != nil || d < 1 || d > 10 {
+				return nil, fmt.Errorf("invalid polynomial degree %q; use 1 to 10", param)
+			}
+			degree = d
+		}
+		return func(xs, ys []float64) (Fit, error) { return FitPolynomial(xs, ys, degree) }, nil
+	case "loess":
+		span := 0.3
+		if hasParam {
+			s, err := strconv.ParseFloat(param, 64)
+			if err != nil || s <= 0 || s > 1 {
+				return nil, fmt.Errorf("invalid LOESS span %q; use a fraction in (0, 1]", param)
+			}
+			span = s
+		}
+		return func(xs, ys []float64) (Fit, error) { return FitLOESS(xs, ys, span) }, nil
+	}
+	return nil, fmt.Errorf("unknown regression %q; use linear, poly[:degree], exp or loess[:span]", spec)
+}
+
+// FitLinear fits a line by least squares.
+func FitLinear(xs, ys []float64) (Fit, error) {
+	f, err := FitPolynomial(xs, ys, 1)
+	f.Name = "linear"
+	return f, err
+}
+
+// FitPolynomial fits a polynomial of the given degree by least squares.
+func FitPolynomial(xs, ys []float64, degree int) (Fit, error) {
+	xs, ys = finitePoints(xs, ys)
+	if len(xs) <= degree {
+		return Fit{}, fmt.Errorf("a polynomial of degree %v needs more than %v points", degree, degree)
+	}
+	// Fit over standardised xs, as powers of e.g. timestamps overflow
+	m, s := Mean(xs), StdDev(xs)
+	if s == 0 {
+		return Fit{}, fmt.Errorf("can't fit a curve to points with a single x")
+	}
+	ts := make([]float64, len(xs))
+	for i, x := range xs {
+		ts[i] = (x - m) / s
+	}
+	cs, err := leastSquares(ts, ys, degree)
+	if err != nil {
+		return Fit{}, err
+	}
+	at := func(x float64) float64 { return horner(cs, (x-m)/s) }
+	return Fit{
+		Name:     fmt.Sprintf("poly:%v", degree),
+		Equation: "y = " + polynomial(unstandardise(cs, m, s), math.Abs(m)+s),
+		R2:       rSquared(xs, ys, at),
+		At:       at,
+	}, nil
+}
+
+// FitExponential fits y = a·e^(bx) by least squares over the logarithms of
+// the positive ys.
+func FitExponential(xs, ys []float64) (Fit, error) {
+	xs, ys = finitePoints(xs, ys)
+	var lxs, lys []float64
+	for i, y := range ys {
+		if y > 0 {
+			lxs, lys = append(lxs, xs[i]), append(lys, math.Log(y))
+		}
+	}
+	line, err := FitPolynomial(lxs, lys, 1)
+	if err != nil {
+		return Fit{}, err
+	}
+	// ln y = c0 + c1·x, so a = e^c0 and b = c1
+	c0, c1 := line.At(0), line.At(1)-line.At(0)
+	at := func(x float64) float64 { return math.Exp(line.At(x)) }
+	return Fit{
+		Name:     "exp",
+		Equation: fmt.Sprintf("y = %v·e^(%vx)", formatCoefficient(math.Exp(c0)), formatCoefficient(c1)),
+		R2:       rSquared(xs, ys, at),
+		At:       at,
+	}, nil
+}
+
+// FitLOESS fits a smooth curve by locally weighted linear regression: the y
+// at x is that of a line fitted to the span fraction of points nearest to x,
+// weighted by the tricube of their distance.
+func FitLOESS(xs, ys []float64, span float64) (Fit, error) {
+	xs, ys = finitePoints(xs, ys)
+	if len(xs) < 3 {
+		return Fit{}, fmt.Errorf("LOESS needs at least 3 points")
+	}
+	idx := make([]int, len(xs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return xs[idx[i]] < xs[idx[j]] })
+	sx, sy := make([]float64, len(xs)), make([]float64, len(xs))
+	for i, j := range idx {
+		sx[i], sy[i] = xs[j], ys[j]
+	}
+	q := max(3, int(math.Ceil(span*float64(len(sx)))))
+	q = min(q, len(sx))
+
+	at := func(x float64) float64 {
+		// Widen a window of the q nearest points around x
+		lo := sort.SearchFloat64s(sx, x)
+		hi := lo
+		for hi-lo < q {
+			if lo > 0 && (hi == len(sx) || x-sx[lo-1] <= sx[hi]-x) {
+				lo--
+			} else {
+				hi++
+			}
+		}
+		maxD := math.Max(math.Abs(x-sx[lo]), math.Abs(sx[hi-1]-x))
+		var sw, swx, swy float64
+		ws := make([]float64, hi-lo)
+		for i := lo; i < hi; i++ {
+			w := 1.0
+			if maxD > 0 {
+				w = math.Pow(1-math.Pow(math.Abs(sx[i]-x)/maxD, 3), 3)
+			}
+			ws[i-lo] = w
+			sw, swx, swy = sw+w, swx+w*sx[i], swy+w*sy[i]
+		}
+		if sw == 0 {
+			return Mean(sy[lo:hi])
+		}
+		mx, my := swx/sw, swy/sw
+		var sxy, sxx float64
+		for i := lo; i < hi; i++ {
+			w := ws[i-lo]
+			sxy += w * (sx[i] - mx) * (sy[i] - my)
+			sxx += w * (sx[i] - mx) * (sx[i] - mx)
+		}
+		if sxx == 0 {
+			return my
+		}
+		return my + sxy/sxx*(x-mx)
+	}
+	return Fit{
+		Name:     "loess",
+		Equation: fmt.Sprintf("LOESS, span %v", span),
+		R2:       rSquared(xs, ys, at),
+		At:       at,
+	}, nil
+}
+
+// finitePoints leaves out points with NaN or infinite coordinates.
+func finitePoints(xs, ys []float64) ([]float64, []float64) {
+	var fxs, fys []float64
+	for i := 0; i < len(xs) && i < len(ys); i++ {
+		if !math.IsNaN(xs[i]) && !math.IsInf(xs[i], 0) && !math.IsNaN(ys[i]) && !math.IsInf(ys[i], 0) {
+			fxs, fys = append(fxs, xs[i]), append(fys, ys[i])
+		}
+	}
+	return fxs, fys
+}
+
+// leastSquares returns the coefficients, from the constant up, of the
+// polynomial of the given degree that best fits the points, solving the
+// normal equations by Gaussian elimination.
+func leastSquares(xs, ys []float64, degree int) ([]float64, error) {
+	n := degree + 1
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+	}
+	for k, x := range xs {
+		p := make([]float64, 2*n-1)
+		p[0] = 1
+		for i := 1; i < len(p); i++ {
+			p[i] = p[i-1] * x
+		}
+		for i := 0; i < n; i++ {
+			for j := 0; j < n; j++ {
+				a[i][j] += p[i+j]
+			}
+			a[i][n] += p[i] * ys[k]
+		}
+	}
+	for col := 0; col < n; col++ {
+		pivot := col
+		for r := col + 1; r < n; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, fmt.Errorf("too few distinct points to fit a polynomial of degree %v", degree)
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < n; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for c := col; c <= n; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+	cs := make([]float64, n)
+	for i := range cs {
+		cs[i] = a[i][n] / a[i][i]
+	}
+	return cs, nil
+}
+
+func horner(cs []float64, x float64) float64 {
+	var y float64
+	for i := len(cs) - 1; i >= 0; i-- {
+		y = y*x + cs[i]
+	}
+	return y
+}
+
+// unstandardise turns the coefficients of a polynomial of t = (x-m)/s into
+// those of a polynomial of x.
+func unstandardise(cs []float64, m, s float64) []float64 {
+	out := make([]float64, len(cs))
+	for k, c := range cs {
+		// c·((x-m)/s)^k = c/s^k · Σj C(k,j)·x^j·(-m)^(k-j)
+		f := c / math.Pow(s, float64(k))
+		binomial := 1.0
+		for j := 0; j <= k; j++ {
+			out[j] += f * binomial * math.Pow(-m, float64(k-j))
+			binomial = binomial * float64(k-j) / float64(j+1)
+		}
+	}
+	return out
+}
+
+// polynomial formats a polynomial given its coefficients from the constant
+// up, e.g. "2.5x² - x + 1", leaving out terms that are rounding errors next
+// to the others for xs of about the given scale.
+func polynomial(cs []float64, scale float64) string {
+	var largest float64
+	for k, c := range cs {
+		largest = math.Max(largest, math.Abs(c)*math.Pow(scale, float64(k)))
+	}
+	var b strings.Builder
+	for k := len(cs) - 1; k >= 0; k-- {
+		c := cs[k]
+		if math.Abs(c)*math.Pow(scale, float64(k)) < 1e-9*largest {
+			c = 0
+		}
+		if c == 0 && !(k == 0 && b.Len() == 0) {
+			continue
+		}
+		switch {
+		case b.Len() == 0 && c < 0:
+			b.WriteString("-")
+		case b.Len() > 0 && c < 0:
+			b.WriteString(" - ")
+		case b.Len() > 0:
+			b.WriteString(" + ")
+		}
+		if abs := formatCoefficient(math.Abs(c)); abs != "1" || k == 0 {
+			b.WriteString(abs)
+		}
+		if k > 0 {
+			b.WriteString("x")
+		}
+		if k > 1 {
+			b.WriteString(superscript(k))
+		}
+	}
+	return b.String()
+}
+
+func formatCoefficient(c float64) string {
+	return strconv.FormatFloat(c, 'g', 4, 64)
+}
+
+func superscript(n int) string {
+	const digits = "⁰¹²³⁴⁵⁶⁷⁸⁹"
+	var b strings.Builder
+	for _, d := range strconv.Itoa(n) {
+		b.WriteString(string([]rune(digits)[d-'0']))
+	}
+	return b.String()
+}
+
+// rSquared returns the coefficient of determination of the fitted f.
+func rSquared(xs, ys []float64, f func(float64) float64) float64 {
+	m := Mean(ys)
+	var ssRes, ssTot float64
+	for i, x := range xs {
+		d := ys[i] - f(x)
+		ssRes += d * d
+		ssTot += (ys[i] - m) * (ys[i] - m)
+	}
+	if ssTot == 0 {
+		if ssRes == 0 {
+			return 1
+		}
+		return 0
+	}
+	return 1 - ssRes/ssTot
+}
@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitPolynomial(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4}
+	tests := []struct {
+		name     string
+		fit      Fitter
+		ys       []float64
+		equation string
+		at       float64 // the fitted y at x = 10
+	}{
+		{name: "linear", fit: FitLinear, ys: []float64{1, 3.5, 6, 8.5, 11}, equation: "y = 2.5x + 1", at: 26},
+		{name: "linear decreasing", fit: FitLinear, ys: []float64{4, 3, 2, 1, 0}, equation: "y = -x + 4", at: -6},
+		{name: "poly:2", fit: mustParseFitter(t, "poly"), ys: []float64{1, 2, 5, 10, 17}, equation: "y = x² + 1", at: 101},
+		{name: "poly:3", fit: mustParseFitter(t, "poly:3"), ys: []float64{0, 1, 8, 27, 64}, equation: "y = x³", at: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fit, err := tt.fit(xs, tt.ys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fit.Name != tt.name && fit.Name+" decreasing" != tt.name {
+				t.Errorf("Name = %q", fit.Name)
+			}
+			if fit.Equation != tt.equation {
+				t.Errorf("Equation = %q, want %q", fit.Equation, tt.equation)
+			}
+			if math.Abs(fit.R2-1) > 1e-9 {
+				t.Errorf("R2 = %v, want 1", fit.R2)
+			}
+			if got := fit.At(10); math.Abs(got-tt.at) > 1e-6 {
+				t.Errorf("At(10) = %v, want %v", got, tt.at)
+			}
+		})
+	}
+}
+
+func TestFitPolynomial_Timestamps(t *testing.T) {
+	// Powers of Unix timestamps would lose all precision unless standardised
+	xs := []float64{1.7e9, 1.7e9 + 60, 1.7e9 + 120, 1.7e9 + 180}
+	ys := []float64{10, 12, 14, 16}
+	fit, err := FitPolynomial(xs, ys, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fit.At(1.7e9 + 240); math.Abs(got-18) > 1e-6 {
+		t.Errorf("At() = %v, want 18", got)
+	}
+}
+
+func TestFitExponential(t *testing.T) {
+	xs := []float64{0, 1, 2, 3, 4}
+	ys := make([]float64, len(xs))
+	for i, x := range xs {
+		ys[i] = 3 * math.Exp(0.5*x)
+	}
+	fit, err := FitExponential(xs, ys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fit.Equation != "y = 3·e^(0.5x)" {
+		t.Errorf("Equation = %q", fit.Equation)
+	}
+	if math.Abs(fit.R2-1) > 1e-9 {
+		t.Errorf("R2 = %v, want 1", fit.R2)
+	}
+}
+
+func TestFitLOESS(t *testing.T) {
+	var xs, ys []float64
+	for i := 0; i < 50; i++ {
+		x := float64(i) / 5
+		xs, ys = append(xs, x), append(ys, math.Sin(x))
+	}
+	fit, err := FitLOESS(xs, ys, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fit.R2 < 0.99 {
+		t.Errorf("R2 = %v, want a close fit to a smooth curve", fit.R2)
+	}
+	if got := fit.At(math.Pi / 2); math.Abs(got-1) > 0.05 {
+		t.Errorf("At(π/2) = %v, want about 1", got)
+	}
+}
+
+func TestFit_Errors(t *testing.T) {
+	if _, err := FitLinear([]float64{1}, []float64{1}); err == nil {
+		t.Error("Expected an error fitting a line to a single point")
+	}
+	if _, err := FitLinear([]float64{2, 2, 2}, []float64{1, 2, 3}); err == nil {
+		t.Error("Expected an error fitting a line to points with a single x")
+	}
+	if _, err := FitExponential([]float64{1, 2}, []float64{-1, -2}); err == nil {
+		t.Error("Expected an error fitting an exponential to negative ys")
+	}
+	for _, spec := range []string{"quadratic", "poly:0", "poly:x", "loess:2", "linear:1"} {
+		if _, err := ParseFitter(spec); err == nil {
+			t.Errorf("Expected an error parsing %q", spec)
+		}
+	}
+}
+
+func TestFit_NaN(t *testing.T) {
+	fit, err := FitLinear([]float64{0, 1, math.NaN(), 2}, []float64{0, 2, 5, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fit.Equation != "y = 2x" {
+		t.Errorf("Equation = %q, want NaN points left out", fit.Equation)
+	}
+}
+
+func mustParseFitter(t *testing.T, spec string) Fitter {
+	t.Helper()
+	f, err := ParseFitter(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
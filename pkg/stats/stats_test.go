@@ -0,0 +1,54 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	tests := []struct {
+		xs       []float64
+		q        float64
+		expected float64
+	}{
+		{xs: []float64{1}, q: 0.99, expected: 1},
+		{xs: []float64{1, 2, 3, 4}, q: 0, expected: 1},
+		{xs: []float64{1, 2, 3, 4}, q: 1, expected: 4},
+		{xs: []float64{1, 2, 3, 4}, q: 0.5, expected: 2.5},
+		{xs: []float64{1, 2, 3, 4, 5}, q: 0.25, expected: 2},
+		{xs: []float64{0, 10}, q: 0.9, expected: 9},
+	}
+	for _, tt := range tests {
+		if got := Quantile(tt.xs, tt.q); got != tt.expected {
+			t.Errorf("Quantile(%v, %v) = %v, want %v", tt.xs, tt.q, got, tt.expected)
+		}
+	}
+	if !math.IsNaN(Quantile(nil, 0.5)) {
+		t.Error("Expected NaN quantile of empty slice")
+	}
+}
+
+func TestMeanMedian(t *testing.T) {
+	xs := []float64{5, 1, 3, 100}
+	if got := Mean(xs); got != 27.25 {
+		t.Errorf("Mean() = %v, want 27.25", got)
+	}
+	if got := Median(xs); got != 4 {
+		t.Errorf("Median() = %v, want 4", got)
+	}
+	if xs[0] != 5 {
+		t.Error("Median() modified its input")
+	}
+	if !math.IsNaN(Mean(nil)) {
+		t.Error("Expected NaN mean of empty slice")
+	}
+}
+
+func TestStdDev(t *testing.T) {
+	if got := StdDev([]float64{2, 4, 4, 4, 5, 5, 7, 9}); got != 2 {
+		t.Errorf("StdDev() = %v, want 2", got)
+	}
+	if !math.IsNaN(StdDev(nil)) {
+		t.Error("Expected NaN standard deviation of empty slice")
+	}
+}
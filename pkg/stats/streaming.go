@@ -0,0 +1,152 @@
+package stats
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// Moments accumulates the count, extremes, mean and (population) standard
+// deviation of values added one at a time, in constant memory, with
+// Welford's algorithm.
+type Moments struct {
+	n             int
+	min, max      float64
+	mean, sumSqDs float64 // sum of squared deviations from the mean
+}
+
+// Add adds a value.
+func (m *Moments) Add(x float64) {
+	m.n++
+	if m.n == 1 || x < m.min {
+		m.min = x
+	}
+	if m.n == 1 || x > m.max {
+		m.max = x
+	}
+	d := x - m.mean
+	m.mean += d / float64(m.n)
+	m.sumSqDs += d * (x - m.mean)
+}
+
+// Count returns the number of values added.
+func (m *Moments) Count() int { return m.n }
+
+// Min returns the smallest value added, or NaN if there are none.
+func (m *Moments) Min() float64 { return m.orNaN(m.min) }
+
+// Max returns the largest value added, or NaN if there are none.
+func (m *Moments) Max() float64 { return m.orNaN(m.max) }
+
+// Mean returns the arithmetic mean of the values added, or NaN if there are
+// none.
+func (m *Moments) Mean() float64 { return m.orNaN(m.mean) }
+
+// StdDev returns the (population) standard deviation of the values added, or
+// NaN if there are none.
+func (m *Moments) StdDev() float64 { return m.orNaN(math.Sqrt(m.sumSqDs / float64(m.n))) }
+
+func (m *Moments) orNaN(x float64) float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return x
+}
+
+// Reservoir keeps a uniform random sample of at most size of the values added
+// to it (all of them until there are more), e.g. to estimate their quantiles
+// in constant memory.
+type Reservoir struct {
+	values []float64
+	size   int
+	seen   int
+	rng    *rand.Rand
+}
+
+// NewReservoir returns a Reservoir of the given size, whose sample of the
+// same values is always the same for the same seed.
+func NewReservoir(size int, seed uint64) *Reservoir {
+	return &Reservoir{size: size, rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Add adds a value.
+func (r *Reservoir) Add(x float64) {
+	// Every value seen so far is in the sample with probability size/seen
+	r.seen++
+	if len(r.values) < r.size {
+		r.values = append(r.values, x)
+	} else if i := r.rng.IntN(r.seen); i < r.size {
+		r.values[i] = x
+	}
+}
+
+// Values returns the sample, in no particular order.
+func (r *Reservoir) Values() []float64 { return r.values }
+
+// Exact reports whether the sample holds all the values added.
+func (r *Reservoir) Exact() bool { return r.seen <= r.size }
+
+// HeavyHitters counts how many times values are added to it, holding counts
+// of at most size distinct values with the Misra-Gries algorithm: once they
+// don't fit, counts are underestimated by at most the number of values added
+// over size+1, so that values more frequent than that are sure to be kept.
+// Adding a value takes constant amortised time however many are counted.
+type HeavyHitters struct {
+	counts     map[string]int // plus decrements; those not over it were dropped
+	byCount    map[int]int    // the number of values kept with each count in counts
+	kept       int
+	decrements int
+	size       int
+	exact      bool
+}
+
+func NewHeavyHitters(size int) *HeavyHitters {
+	return &HeavyHitters{counts: make(map[string]int), byCount: make(map[int]int), size: size, exact: true}
+}
+
+// Add adds a value.
+func (h *HeavyHitters) Add(value string) {
+	n, ok := h.counts[value]
+	ok = ok && n > h.decrements
+	if !ok && h.kept >= h.size {
+		// Every count, and the value's, is decremented, freeing room for
+		// others, by dropping the values whose counts were 1
+		h.exact = false
+		h.decrements++
+		h.kept -= h.byCount[h.decrements]
+		delete(h.byCount, h.decrements)
+		return
+	}
+	if ok {
+		if h.byCount[n]--; h.byCount[n] == 0 {
+			delete(h.byCount, n)
+		}
+	} else {
+		n = h.decrements
+		h.kept++
+	}
+	h.counts[value] = n + 1
+	h.byCount[n+1]++
+
+	// Dropped values are deleted once they are as many as those kept
+	if len(h.counts) >= 2*h.size {
+		for v, n := range h.counts {
+			if n <= h.decrements {
+				delete(h.counts, v)
+			}
+		}
+	}
+}
+
+// Counts returns the (under)estimated counts of the values that are kept.
+func (h *HeavyHitters) Counts() map[string]int {
+	counts := make(map[string]int, h.kept)
+	for v, n := range h.counts {
+		if n > h.decrements {
+			counts[v] = n - h.decrements
+		}
+	}
+	return counts
+}
+
+// Exact reports whether Counts holds every value added and their exact counts.
+func (h *HeavyHitters) Exact() bool { return h.exact }
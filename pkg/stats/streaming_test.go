@@ -0,0 +1,114 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMoments(t *testing.T) {
+	var m Moments
+	if !math.IsNaN(m.Min()) || !math.IsNaN(m.Mean()) || !math.IsNaN(m.StdDev()) {
+		t.Errorf("Expected no statistics of no values, got %+v", m)
+	}
+	xs := []float64{3, 1, 4, 1, 5, 9, 2, 6}
+	for _, x := range xs {
+		m.Add(x)
+	}
+	if m.Count() != 8 || m.Min() != 1 || m.Max() != 9 {
+		t.Errorf("Count, Min, Max = %v, %v, %v, want 8, 1, 9", m.Count(), m.Min(), m.Max())
+	}
+	if math.Abs(m.Mean()-Mean(xs)) > 1e-12 || math.Abs(m.StdDev()-StdDev(xs)) > 1e-12 {
+		t.Errorf("Mean, StdDev = %v, %v, want %v, %v", m.Mean(), m.StdDev(), Mean(xs), StdDev(xs))
+	}
+}
+
+func TestReservoir(t *testing.T) {
+	r := NewReservoir(1000, 1)
+	for i := 0; i < 500; i++ {
+		r.Add(float64(i))
+	}
+	if !r.Exact() || len(r.Values()) != 500 {
+		t.Errorf("Expected all %v values to be kept, got %v", 500, len(r.Values()))
+	}
+	for i := 500; i < 100000; i++ {
+		r.Add(float64(i))
+	}
+	if r.Exact() || len(r.Values()) != 1000 {
+		t.Errorf("Expected a sample of 1000 values, got %v", len(r.Values()))
+	}
+	sorted := Sorted(r.Values())
+	if median := Quantile(sorted, 0.5); math.Abs(median-50000) > 5000 {
+		t.Errorf("Median of the sample = %v, want about 50000", median)
+	}
+}
+
+func TestHeavyHitters(t *testing.T) {
+	h := NewHeavyHitters(3)
+	for _, v := range []string{"a", "b", "a", "c"} {
+		h.Add(v)
+	}
+	if !h.Exact() || h.Counts()["a"] != 2 || len(h.Counts()) != 3 {
+		t.Errorf("Expected exact counts while they fit, got %v", h.Counts())
+	}
+
+	// A value making up half of them is kept among many rarer ones
+	h = NewHeavyHitters(10)
+	for i := 0; i < 1000; i++ {
+		h.Add("hot")
+		h.Add(fmt.Sprintf("cold-%v", i))
+	}
+	if h.Exact() || len(h.Counts()) > 10 {
+		t.Errorf("Expected at most 10 estimated counts, got %v", len(h.Counts()))
+	}
+	var values []string
+	for v := range h.Counts() {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return h.Counts()[values[i]] > h.Counts()[values[j]] })
+	if values[0] != "hot" || h.Counts()["hot"] < 1000-2000/11 {
+		t.Errorf("Expected %q to be the heaviest hitter, got %v", "hot", h.Counts())
+	}
+}
+
+func TestHeavyHitters_MisraGries(t *testing.T) {
+	// Counts match those of decrementing every count on each value not kept
+	var (
+		h    = NewHeavyHitters(5)
+		want = make(map[string]int)
+		rng  = rand.New(rand.NewPCG(1, 1))
+	)
+	for i := 0; i < 10000; i++ {
+		v := fmt.Sprint(rng.IntN(8))
+		h.Add(v)
+		if _, ok := want[v]; ok || len(want) < 5 {
+			want[v]++
+			continue
+		}
+		for w := range want {
+			if want[w]--; want[w] == 0 {
+				delete(want, w)
+			}
+		}
+	}
+	if !reflect.DeepEqual(h.Counts(), want) {
+		t.Errorf("Counts = %v, want %v", h.Counts(), want)
+	}
+}
+
+func BenchmarkHeavyHitters(b *testing.B) {
+	values := make([]string, 1000000)
+	for i := range values {
+		values[i] = fmt.Sprint(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h := NewHeavyHitters(10000)
+		for _, v := range values {
+			h.Add(v)
+		}
+	}
+}
@@ -0,0 +1,426 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+)
+
+func init() {
+	ch.RegisterTransformer(NewAggregateTransformer())
+}
+
+// AggregateTransformer groups rows by the values of some columns and produces
+// one row per group, with one float per aggregation, e.g. the p99 latency
+// per host.
+type AggregateTransformer struct{}
+
+func NewAggregateTransformer() *AggregateTransformer {
+	return &AggregateTransformer{}
+}
+
+func (t *AggregateTransformer) Name() string {
+	return "aggregate"
+}
+
+type AggregateConfig struct {
+	GroupBy      string
+	Aggregations string
+}
+
+func (t *AggregateTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &AggregateConfig{}
+	fs.StringVar(&c.GroupBy, "group-by", "", "Comma-separated columns to group rows by (e.g. 'host').")
+	fs.StringVar(&c.Aggregations, "agg", "count()", "Comma-separated aggregations per group, out of count(), sum(col), mean(col), min(col), max(col), median(col), percentiles like p99(col), count_distinct(col) and approx_count_distinct(col) (estimated with HyperLogLog in constant memory).")
+	return c
+}
+
+func (t *AggregateTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*AggregateConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for AggregateTransformer")
+	}
+	aggs, err := ParseAggregations(cfg.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+	var groupBy []string
+	for _, name := range strings.Split(cfg.GroupBy, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			groupBy = append(groupBy, name)
+		}
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, err := findColumns(first.Schema, groupBy); err != nil {
+		return nil, err
+	}
+	if err := bindAggregations(first.Schema, aggs); err != nil {
+		return nil, err
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			groups  = make(map[string]*group)
+			keys    []string
+			keyCols []column
+			schema  *ch.Schema
+			outSch  *ch.Schema
+			err     error
+		)
+		for row := range rows {
+			if row.Schema != schema || outSch == nil {
+				schema = row.Schema
+				if keyCols, err = findColumns(schema, groupBy); err == nil {
+					err = bindAggregations(schema, aggs)
+				}
+				if err != nil {
+					ch.ReportError(fmt.Errorf("aggregating: %v", err))
+					return
+				}
+				outSch = aggregateSchema(schema, keyCols, aggs)
+			}
+
+			var key strings.Builder
+			for _, c := range keyCols {
+				key.WriteString(c.str(row))
+				key.WriteByte(0)
+			}
+			g, ok := groups[key.String()]
+			if !ok {
+				g = newGroup(row, keyCols, aggs)
+				groups[key.String()] = g
+				keys = append(keys, key.String())
+			}
+			g.add(row, aggs)
+		}
+
+		for _, k := range keys {
+			out <- groups[k].row(outSch)
+		}
+	}()
+	return out, nil
+}
+
+func findColumns(s *ch.Schema, names []string) ([]column, error) {
+	cols := make([]column, 0, len(names))
+	for _, name := range names {
+		c, err := findColumn(s, name)
+		if err != nil {
+			return nil, err
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+// aggregateSchema names the columns of the rows produced from groups: the
+// datetime keys, the other keys as strings, and one float per aggregation.
+func aggregateSchema(in *ch.Schema, keyCols []column, aggs []*Aggregation) *ch.Schema {
+	s := newSchema(in, nil, []string{}, []string{})
+	for _, c := range keyCols {
+		if c.Type == dateTimeColumn {
+			s.DateTimes = append(s.DateTimes, c.Name)
+		} else {
+			s.Strings = append(s.Strings, c.Name)
+		}
+	}
+	s.Floats = aggregationNames(aggs)
+	return s
+}
+
+func aggregationNames(aggs []*Aggregation) []string {
+	names := make([]string, len(aggs))
+	for i, a := range aggs {
+		names[i] = a.Spec
+	}
+	return names
+}
+
+type group struct {
+	strings   []string
+	dateTimes []string
+	accs      []accumulator
+}
+
+func newGroup(r ch.Row, keyCols []column, aggs []*Aggregation) *group {
+	g := &group{strings: []string{}, dateTimes: []string{}}
+	for _, c := range keyCols {
+		if c.Type == dateTimeColumn {
+			g.dateTimes = append(g.dateTimes, c.str(r))
+		} else {
+			g.strings = append(g.strings, c.str(r))
+		}
+	}
+	for _, a := range aggs {
+		g.accs = append(g.accs, a.newAccumulator())
+	}
+	return g
+}
+
+func (g *group) add(r ch.Row, aggs []*Aggregation) {
+	for i, a := range aggs {
+		g.accs[i].add(r, a.column)
+	}
+}
+
+func (g *group) row(s *ch.Schema) ch.Row {
+	fs := make([]float64, len(g.accs))
+	for i, acc := range g.accs {
+		fs[i] = acc.result()
+	}
+	return ch.Row{Floats: fs, Strings: g.strings, DateTimes: g.dateTimes, Schema: s}
+}
+
+// Aggregation computes a single value out of a column of a group of rows,
+// e.g. `p99(latency)`.
+type Aggregation struct {
+	Spec     string // e.g. `p99(latency)`
+	Func     string // e.g. `p99`
+	Column   string // e.g. `latency`; empty for count()
+	quantile float64
+	column   column
+}
+
+var aggregationFuncs = map[string]bool{"count": true, "sum": true, "mean": true, "avg": true, "min": true, "max": true, "median": true, "count_distinct": true, "approx_count_distinct": true}
+
+// countsValues returns whether an aggregation counts the values of a column
+// rather than computing with them, so that it may be of any type.
+func countsValues(fn string) bool {
+	return fn == "count" || fn == "count_distinct" || fn == "approx_count_distinct"
+}
+
+// ParseAggregations parses a comma-separated list of aggregations, e.g.
+// `p99(latency),count()`.
+func ParseAggregations(spec string) ([]*Aggregation, error) {
+	var aggs []*Aggregation
+	for _, s := range splitTopLevel(spec) {
+		a, err := parseAggregation(s)
+		if err != nil {
+			return nil, err
+		}
+		aggs = append(aggs, a)
+	}
+	if len(aggs) == 0 {
+		return nil, fmt.Errorf("aggregate: no aggregations in %q", spec)
+	}
+	return aggs, nil
+}
+
+func parseAggregation(spec string) (*Aggregation, error) {
+	open := strings.Index(spec, "(")
+	if open <= 0 || !strings.HasSuffix(spec, ")") {
+		return nil, fmt.Errorf("aggregate: invalid aggregation %q; expected e.g. `mean(latency)`", spec)
+	}
+	a := &Aggregation{
+		Spec:   spec,
+		Func:   strings.ToLower(strings.TrimSpace(spec[:open])),
+		Column: strings.TrimSpace(spec[open+1 : len(spec)-1]),
+	}
+	if strings.HasPrefix(a.Func, "p") && !aggregationFuncs[a.Func] {
+		q, err := strconv.ParseFloat(a.Func[1:], 64)
+		if err != nil || q < 0 || q > 100 {
+			return nil, fmt.Errorf("aggregate: invalid percentile %q; expected e.g. `p99`", a.Func)
+		}
+		a.quantile = q / 100
+	} else if !aggregationFuncs[a.Func] {
+		return nil, fmt.Errorf("aggregate: unknown aggregation %q", a.Func)
+	}
+	if a.Column == "" && a.Func != "count" {
+		return nil, fmt.Errorf("aggregate: %v requires a column, e.g. `%v(latency)`", a.Func, a.Func)
+	}
+	return a, nil
+}
+
+// splitTopLevel splits a comma-separated list, ignoring commas within
+// parentheses or quotes.
+func splitTopLevel(s string) []string {
+	var (
+		parts   []string
+		depth   int
+		start   int
+		quote   rune
+		escaped bool
+	)
+	for i, r := range s {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == quote:
+				quote = 0
+			}
+			continue
+		}
+		switch r {
+		case '"', '\'', '`':
+			quote = r
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// bindAggregations locates the columns of the aggregations in the given Schema.
+func bindAggregations(s *ch.Schema, aggs []*Aggregation) error {
+	for _, a := range aggs {
+		if a.Column == "" {
+			continue
+		}
+		c, err := findColumn(s, a.Column)
+		if err != nil {
+			return err
+		}
+		if c.Type != floatColumn && !countsValues(a.Func) {
+			return fmt.Errorf("%v requires a numeric column but %q isn't one", a.Func, a.Column)
+		}
+		a.column = c
+	}
+	return nil
+}
+
+// accumulator computes an aggregation incrementally, one row at a time.
+type accumulator interface {
+	add(r ch.Row, c column)
+	result() float64
+}
+
+func (a *Aggregation) newAccumulator() accumulator {
+	switch a.Func {
+	case "count":
+		return &countAcc{all: a.Column == ""}
+	case "sum":
+		return &sumAcc{}
+	case "mean", "avg":
+		return &meanAcc{}
+	case "min":
+		return &extremeAcc{v: math.NaN(), better: func(x, y float64) bool { return x < y }}
+	case "max":
+		return &extremeAcc{v: math.NaN(), better: func(x, y float64) bool { return x > y }}
+	case "median":
+		return &quantileAcc{q: 0.5}
+	case "count_distinct":
+		return &distinctAcc{seen: make(map[string]bool)}
+	case "approx_count_distinct":
+		return &approxDistinctAcc{hll: stats.NewHyperLogLog()}
+	default:
+		return &quantileAcc{q: a.quantile}
+	}
+}
+
+// countAcc counts rows, or only rows with a non-empty value if it has a column.
+type countAcc struct {
+	all bool
+	n   float64
+}
+
+func (a *countAcc) add(r ch.Row, c column) {
+	if a.all || (c.Type == floatColumn && !math.IsNaN(c.float(r))) || (c.Type != floatColumn && c.str(r) != "") {
+		a.n++
+	}
+}
+func (a *countAcc) result() float64 { return a.n }
+
+// distinctAcc counts the distinct non-empty values of a column exactly,
+// keeping every one.
+type distinctAcc struct{ seen map[string]bool }
+
+func (a *distinctAcc) add(r ch.Row, c column) {
+	if v, ok := distinctValue(r, c); ok {
+		a.seen[v] = true
+	}
+}
+func (a *distinctAcc) result() float64 { return float64(len(a.seen)) }
+
+// approxDistinctAcc estimates the number of distinct non-empty values of a
+// column in constant memory.
+type approxDistinctAcc struct{ hll *stats.HyperLogLog }
+
+func (a *approxDistinctAcc) add(r ch.Row, c column) {
+	if v, ok := distinctValue(r, c); ok {
+		a.hll.Add(v)
+	}
+}
+func (a *approxDistinctAcc) result() float64 { return a.hll.Count() }
+
+// distinctValue returns the value of a column that distinct counts compare,
+// or ok false if it's empty.
+func distinctValue(r ch.Row, c column) (string, bool) {
+	if c.Type == floatColumn && math.IsNaN(c.float(r)) {
+		return "", false
+	}
+	v := c.str(r)
+	return v, v != ""
+}
+
+type sumAcc struct{ sum float64 }
+
+func (a *sumAcc) add(r ch.Row, c column) {
+	if x := c.float(r); !math.IsNaN(x) {
+		a.sum += x
+	}
+}
+func (a *sumAcc) result() float64 { return a.sum }
+
+type meanAcc struct{ sum, n float64 }
+
+func (a *meanAcc) add(r ch.Row, c column) {
+	if x := c.float(r); !math.IsNaN(x) {
+		a.sum += x
+		a.n++
+	}
+}
+func (a *meanAcc) result() float64 { return a.sum / a.n }
+
+type extremeAcc struct {
+	v      float64
+	better func(x, y float64) bool
+}
+
+func (a *extremeAcc) add(r ch.Row, c column) {
+	if x := c.float(r); !math.IsNaN(x) && (math.IsNaN(a.v) || a.better(x, a.v)) {
+		a.v = x
+	}
+}
+func (a *extremeAcc) result() float64 { return a.v }
+
+// quantileAcc keeps every value to compute exact quantiles.
+type quantileAcc struct {
+	q  float64
+	xs []float64
+}
+
+func (a *quantileAcc) add(r ch.Row, c column) {
+	if x := c.float(r); !math.IsNaN(x) {
+		a.xs = append(a.xs, x)
+	}
+}
+func (a *quantileAcc) result() float64 {
+	sort.Float64s(a.xs)
+	return stats.Quantile(a.xs, a.q)
+}
@@ -0,0 +1,104 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestAggregate(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency", "status"}, Strings: []string{"host"}, DateTimes: []string{}}
+	in := []ch.Row{
+		{Floats: []float64{10, 200}, Strings: []string{"a"}, Schema: schema},
+		{Floats: []float64{30, 500}, Strings: []string{"b"}, Schema: schema},
+		{Floats: []float64{20, 200}, Strings: []string{"a"}, Schema: schema},
+		{Floats: []float64{40, 200}, Strings: []string{"a"}, Schema: schema},
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		strings [][]string
+		floats  [][]float64
+		schema  *ch.Schema
+	}{
+		{
+			name:    "Count per group by default",
+			args:    []string{"--group-by", "host"},
+			strings: [][]string{{"a"}, {"b"}},
+			floats:  [][]float64{{3}, {1}},
+			schema:  &ch.Schema{Floats: []string{"count()"}, Strings: []string{"host"}, DateTimes: []string{}},
+		},
+		{
+			name:    "Many aggregations",
+			args:    []string{"--group-by", "host", "--agg", "sum(latency), mean(latency),min(latency),max(latency),median(latency),p50(latency),p100(latency)"},
+			strings: [][]string{{"a"}, {"b"}},
+			floats:  [][]float64{{70, 70.0 / 3, 10, 40, 20, 20, 40}, {30, 30, 30, 30, 30, 30, 30}},
+		},
+		{
+			name:    "Group by a numeric column",
+			args:    []string{"--group-by", "status", "--agg", "p90(latency)"},
+			strings: [][]string{{"200"}, {"500"}},
+			floats:  [][]float64{{36}, {30}},
+		},
+		{
+			name:    "Group by many columns",
+			args:    []string{"--group-by", "host,status"},
+			strings: [][]string{{"a", "200"}, {"b", "500"}},
+			floats:  [][]float64{{3}, {1}},
+		},
+		{
+			name:    "Distinct counts",
+			args:    []string{"--group-by", "host", "--agg", "count_distinct(status),approx_count_distinct(status),count_distinct(host)"},
+			strings: [][]string{{"a"}, {"b"}},
+			floats:  [][]float64{{1, 1, 1}, {1, 1, 1}},
+		},
+		{
+			name:    "Single group",
+			args:    []string{"--agg", "count(),max(status),count_distinct(status),approx_count_distinct(host)"},
+			strings: [][]string{{}},
+			floats:  [][]float64{{4, 500, 2, 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := transform(t, "aggregate", tt.args, in...)
+			var (
+				strings [][]string
+				floats  [][]float64
+			)
+			for _, r := range rows {
+				strings = append(strings, r.Strings)
+				floats = append(floats, r.Floats)
+			}
+			if !reflect.DeepEqual(strings, tt.strings) {
+				t.Errorf("Strings = %v, want %v", strings, tt.strings)
+			}
+			if !reflect.DeepEqual(floats, tt.floats) {
+				t.Errorf("Floats = %v, want %v", floats, tt.floats)
+			}
+			if tt.schema != nil && !reflect.DeepEqual(rows[0].Schema, tt.schema) {
+				t.Errorf("Schema = %v, want %v", rows[0].Schema, tt.schema)
+			}
+		})
+	}
+}
+
+func TestParseAggregations(t *testing.T) {
+	aggs, err := ParseAggregations("p99.9(latency), count()")
+	if err != nil {
+		t.Fatalf("ParseAggregations() error = %v", err)
+	}
+	if len(aggs) != 2 || aggs[0].Func != "p99.9" || aggs[0].Column != "latency" || math.Abs(aggs[0].quantile-0.999) > 1e-9 || aggs[1].Func != "count" {
+		t.Errorf("Unexpected aggregations %+v %+v", aggs[0], aggs[1])
+	}
+
+	for _, spec := range []string{"", "latency", "sum()", "p101(x)", "foo(x)", "mean(x"} {
+		if _, err := ParseAggregations(spec); err == nil {
+			t.Errorf("ParseAggregations(%q) expected error", spec)
+		}
+	}
+}
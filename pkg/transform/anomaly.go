@@ -0,0 +1,211 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+)
+
+func init() {
+	ch.RegisterTransformer(NewAnomalyTransformer())
+}
+
+// AnomalyFlag is the kind of the float columns AnomalyTransformer adds for
+// each checked column, which are named e.g. anomaly(errors) and have the
+// ch.RoleAnomaly role.
+const AnomalyFlag = "anomaly"
+
+// Outlier detection methods, and their default thresholds.
+var anomalyThresholds = map[string]float64{
+	"zscore":   3,
+	"mad":      3.5,
+	"iqr":      1.5,
+	"seasonal": 3.5,
+}
+
+// AnomalyTransformer flags outliers among the values of float columns,
+// adding an anomaly(column) column for each that is 1 on rows where the
+// column's value is an outlier and 0 elsewhere. Outliers of time series are
+// found within each series, which are told apart by their string columns;
+// without a datetime column, strings are labels and all rows are compared.
+type AnomalyTransformer struct{}
+
+func NewAnomalyTransformer() *AnomalyTransformer {
+	return &AnomalyTransformer{}
+}
+
+func (t *AnomalyTransformer) Name() string {
+	return "anomaly"
+}
+
+type AnomalyConfig struct {
+	Method    string
+	Threshold float64
+	Columns   string
+	Season    string
+}
+
+func (t *AnomalyTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &AnomalyConfig{}
+	fs.StringVar(&c.Method, "anomalies", "mad", "Outlier detection method flagging rows: zscore, mad (median absolute deviation), iqr, or seasonal (mad of the residuals from each position's median within --anomaly-season).")
+	fs.Float64Var(&c.Threshold, "anomaly-threshold", 0, "Deviation beyond which values are outliers: in standard deviations for zscore (3 by default), in scaled MADs for mad and seasonal (3.5), or in IQRs beyond the quartiles for iqr (1.5).")
+	fs.StringVar(&c.Columns, "anomaly-columns", "", "Comma-separated float columns to check for outliers. Defaults to all of them.")
+	fs.StringVar(&c.Season, "anomaly-season", "", "Length of seasons for seasonal outliers, as a number of rows or an interval like 1d or 1w.")
+	return c
+}
+
+func (t *AnomalyTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*AnomalyConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for AnomalyTransformer")
+	}
+	threshold, ok := anomalyThresholds[cfg.Method]
+	if !ok {
+		return nil, fmt.Errorf("anomaly: unknown method %q; use zscore, mad, iqr or seasonal", cfg.Method)
+	}
+	if cfg.Threshold < 0 {
+		return nil, fmt.Errorf("anomaly: --anomaly-threshold can't be negative")
+	}
+	if cfg.Threshold > 0 {
+		threshold = cfg.Threshold
+	}
+	season, err := parseSeason(cfg.Season)
+	if err != nil {
+		return nil, fmt.Errorf("anomaly: invalid --anomaly-season %q; use a number of rows or an interval like 1d or 1w", cfg.Season)
+	}
+	if cfg.Method == "seasonal" && season == (seasonLength{}) {
+		return nil, fmt.Errorf("anomaly: seasonal outliers require --anomaly-season")
+	}
+	names := splitColumns(cfg.Columns)
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := derivedColumns(first.Schema, "anomaly detection", names); err != nil {
+		return nil, fmt.Errorf("anomaly: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema   *ch.Schema
+			buffered []ch.Row
+		)
+		flush := func() error {
+			if len(buffered) == 0 {
+				return nil
+			}
+			return flagAnomalies(buffered, names, cfg.Method, threshold, season, out)
+		}
+		for row := range rows {
+			if row.Schema != schema && len(buffered) > 0 {
+				if err := flush(); err != nil {
+					ch.ReportError(fmt.Errorf("detecting anomalies: %v", err))
+					return
+				}
+				buffered = nil
+			}
+			schema = row.Schema
+			buffered = append(buffered, row)
+		}
+		if err := flush(); err != nil {
+			ch.ReportError(fmt.Errorf("detecting anomalies: %v", err))
+		}
+	}()
+	return out, nil
+}
+
+// flagAnomalies emits the given rows, which share a Schema, with the
+// anomaly flags of their columns.
+func flagAnomalies(rows []ch.Row, names []string, method string, threshold float64, season seasonLength, out chan<- ch.Row) error {
+	schema := rows[0].Schema
+	cols, _, err := derivedColumns(schema, "anomaly detection", names)
+	if err != nil {
+		return err
+	}
+	floats := append([]string{}, schema.Floats...)
+	for _, c := range cols {
+		floats = append(floats, fmt.Sprintf("%v(%v)", AnomalyFlag, c.Name))
+	}
+	outSch := newSchema(schema, floats, schema.Strings, schema.DateTimes)
+	for k, c := range cols {
+		outSch.SetFloatRole(len(schema.Floats)+k, ch.ColumnRole{Role: ch.RoleAnomaly, Of: c.Name})
+	}
+
+	// Seasons are in rows, so put each series' rows in order of time
+	var (
+		times  []time.Time
+		tsCol  column
+		series = make(map[string][]int)
+		keys   []string
+	)
+	if len(schema.DateTimes) > 0 {
+		if tsCol, err = findDateTimeColumn(schema, ""); err != nil {
+			return err
+		}
+		times = make([]time.Time, len(rows))
+	}
+	for i, row := range rows {
+		var key string
+		if times != nil {
+			times[i], _ = time.Parse(schema.DateFormat, tsCol.str(row))
+			key = strings.Join(row.Strings, "\x00")
+		}
+		if _, ok := series[key]; !ok {
+			keys = append(keys, key)
+		}
+		series[key] = append(series[key], i)
+	}
+
+	flags := make([][]float64, len(rows))
+	for i := range flags {
+		flags[i] = make([]float64, len(cols))
+	}
+	for _, key := range keys {
+		idx := series[key]
+		period := season.rows
+		if times != nil {
+			sort.SliceStable(idx, func(i, j int) bool { return times[idx[i]].Before(times[idx[j]]) })
+			period = season.periodOf(medianStep(times, idx))
+		} else if method == "seasonal" && season.rows == 0 {
+			return fmt.Errorf("seasons can only be an interval if the input has a datetime column; use a number of rows")
+		}
+		for k, c := range cols {
+			xs := make([]float64, len(idx))
+			for i, j := range idx {
+				xs[i] = c.float(rows[j])
+			}
+			var outliers []bool
+			switch method {
+			case "zscore":
+				outliers = stats.ZScoreOutliers(xs, threshold)
+			case "iqr":
+				outliers = stats.IQROutliers(xs, threshold)
+			case "seasonal":
+				outliers = stats.SeasonalOutliers(xs, period, threshold)
+			default:
+				outliers = stats.MADOutliers(xs, threshold)
+			}
+			for i, j := range idx {
+				if outliers[i] {
+					flags[j][k] = 1
+				}
+			}
+		}
+	}
+
+	for i, row := range rows {
+		fs := make([]float64, len(schema.Floats), len(floats))
+		copy(fs, row.Floats)
+		out <- ch.Row{Floats: append(fs, flags[i]...), Strings: row.Strings, DateTimes: row.DateTimes, Schema: outSch}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestAnomaly(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"errors", "latency"}, Strings: []string{"host"}, DateTimes: []string{}}
+	var in []ch.Row
+	for i, e := range []float64{3, 4, 3, 90, 5, 4, 3, 4} {
+		host := "a"
+		if i == 7 {
+			host = "b"
+		}
+		in = append(in, ch.Row{Floats: []float64{e, 100}, Strings: []string{host}, Schema: schema})
+	}
+
+	tests := []struct {
+		name   string
+		args   []string
+		floats []string
+		flags  [][]float64
+	}{
+		{
+			name:   "All columns",
+			args:   nil,
+			floats: []string{"errors", "latency", "anomaly(errors)", "anomaly(latency)"},
+			flags:  [][]float64{{0, 0}, {0, 0}, {0, 0}, {1, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 0}},
+		},
+		{
+			name:   "IQR of a column",
+			args:   []string{"--anomalies", "iqr", "--anomaly-columns", "errors"},
+			floats: []string{"errors", "latency", "anomaly(errors)"},
+			flags:  [][]float64{{0}, {0}, {0}, {1}, {0}, {0}, {0}, {0}},
+		},
+		{
+			name:   "Lenient z-score",
+			args:   []string{"--anomalies", "zscore", "--anomaly-threshold", "10", "--anomaly-columns", "errors"},
+			floats: []string{"errors", "latency", "anomaly(errors)"},
+			flags:  [][]float64{{0}, {0}, {0}, {0}, {0}, {0}, {0}, {0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := transform(t, "anomaly", tt.args, in...)
+			if len(rows) != len(in) {
+				t.Fatalf("Expected %v rows, got %v", len(in), len(rows))
+			}
+			if !reflect.DeepEqual(rows[0].Schema.Floats, tt.floats) {
+				t.Errorf("Floats = %v, want %v", rows[0].Schema.Floats, tt.floats)
+			}
+			var flags [][]float64
+			for _, r := range rows {
+				flags = append(flags, r.Floats[2:])
+			}
+			if !reflect.DeepEqual(flags, tt.flags) {
+				t.Errorf("Flags = %v, want %v", flags, tt.flags)
+			}
+		})
+	}
+}
+
+func TestAnomaly_Seasonal(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"requests"}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04"}
+	var in []ch.Row
+	for i, v := range []float64{1, 50, 2, 51, 1, 49, 2, 50, 48, 51, 1, 50} {
+		ts := "2024-01-0" + string(rune('1'+i/2)) + []string{" 00:00", " 12:00"}[i%2]
+		in = append(in, ch.Row{Floats: []float64{v}, DateTimes: []string{ts}, Schema: schema})
+	}
+	rows := transform(t, "anomaly", []string{"--anomalies", "seasonal", "--anomaly-season", "1d"}, in...)
+	for i, r := range rows {
+		if want := i == 8; (r.Floats[1] == 1) != want {
+			t.Errorf("Row %v %v flagged = %v, want %v", i, r.DateTimes, r.Floats[1], want)
+		}
+	}
+}
+
+func TestAnomaly_Errors(t *testing.T) {
+	tr := NewAnomalyTransformer()
+	for _, cfg := range []*AnomalyConfig{
+		{Method: "prophet"},
+		{Method: "mad", Threshold: -1},
+		{Method: "seasonal"},
+		{Method: "seasonal", Season: "sometimes"},
+	} {
+		if _, err := tr.Transform(make(chan ch.Row), cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
+
+func TestAnomaly_Roles(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"errors"}, Strings: []string{}, DateTimes: []string{"day"}, DateFormat: "2006-01-02"}
+	var in []ch.Row
+	for i, day := range []string{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04"} {
+		in = append(in, ch.Row{Floats: []float64{float64(i)}, DateTimes: []string{day}, Schema: schema})
+	}
+	rows := transform(t, "anomaly", nil, in...)
+	if got, want := rows[0].Schema.FloatRoles, []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FloatRoles = %v, want %v", got, want)
+	}
+
+	// Flags keep their role through later transformers, which leave them be
+	rows = transform(t, "normalize", []string{"--normalize", "minmax"}, rows...)
+	if got := rows[0].Schema.Floats; !reflect.DeepEqual(got, []string{"minmax(errors)", "anomaly(errors)"}) {
+		t.Errorf("Floats = %v, want the flags not normalized", got)
+	}
+	if r := rows[0].Schema.FloatRole(1); r.Role != ch.RoleAnomaly {
+		t.Errorf("Role = %v, want the flags' role kept", r)
+	}
+}
@@ -0,0 +1,213 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+)
+
+func init() {
+	ch.RegisterTransformer(NewBinTransformer())
+}
+
+// Column names of the rows BinTransformer produces.
+const (
+	BinStart = "bin_start"
+	BinEnd   = "bin_end"
+	BinCount = "count"
+)
+
+// maxBins keeps a tiny --bin-width from exhausting memory.
+const maxBins = 100000
+
+// BinTransformer counts the values of a float column within bins of equal
+// width (or of equal ratio, with log bins), emitting one (bin_start,
+// bin_end, count) row per bin, including empty ones. Unless the number of
+// bins or their width is given, it's chosen with the Freedman–Diaconis rule,
+// or Sturges' if the data's interquartile range is zero.
+type BinTransformer struct{}
+
+func NewBinTransformer() *BinTransformer {
+	return &BinTransformer{}
+}
+
+func (t *BinTransformer) Name() string {
+	return "bin"
+}
+
+type BinConfig struct {
+	Bins   int
+	Width  string
+	Unit   time.Duration
+	Rule   string
+	Log    bool
+	Column string
+}
+
+func (t *BinTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &BinConfig{}
+	fs.IntVar(&c.Bins, "bins", 0, "Number of histogram bins. Chosen with --bin-rule if neither it nor --bin-width are set.")
+	fs.StringVar(&c.Width, "bin-width", "", "Width of histogram bins, as a number or a duration like 10ms (see --bin-unit). With --bin-log, in powers of ten.")
+	fs.DurationVar(&c.Unit, "bin-unit", time.Millisecond, "Unit of the binned values, to interpret --bin-width durations.")
+	fs.StringVar(&c.Rule, "bin-rule", "fd", "Rule choosing the number of bins: fd (Freedman–Diaconis) or sturges.")
+	fs.BoolVar(&c.Log, "bin-log", false, "Use logarithmic bins, dropping values that aren't positive.")
+	fs.StringVar(&c.Column, "bin-column", "", "Float column to bin. Defaults to the first one.")
+	return c
+}
+
+func (t *BinTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*BinConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for BinTransformer")
+	}
+	width, err := parseBinWidth(cfg.Width, cfg.Unit)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Bins < 0 || cfg.Bins > maxBins {
+		return nil, fmt.Errorf("bin: --bins must be between 0 (automatic) and %v", maxBins)
+	}
+	if cfg.Rule != "fd" && cfg.Rule != "sturges" {
+		return nil, fmt.Errorf("bin: unknown --bin-rule %q; use fd or sturges", cfg.Rule)
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, err := findFloatColumn(first.Schema, cfg.Column); err != nil {
+		return nil, fmt.Errorf("bin: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema  *ch.Schema
+			col     column
+			xs      []float64
+			dropped int
+			err     error
+		)
+		for row := range rows {
+			if row.Schema != schema || col.Name == "" {
+				schema = row.Schema
+				if col, err = findFloatColumn(schema, cfg.Column); err != nil {
+					ch.ReportError(fmt.Errorf("binning: %v", err))
+					return
+				}
+			}
+			x := col.float(row)
+			if cfg.Log {
+				if x <= 0 {
+					dropped++
+					continue
+				}
+				x = math.Log10(x)
+			}
+			if !math.IsNaN(x) && !math.IsInf(x, 0) {
+				xs = append(xs, x)
+			}
+		}
+		if dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: dropped %v values that aren't positive from logarithmic bins\n", dropped)
+		}
+		if len(xs) == 0 {
+			return
+		}
+
+		start, width, n, err := binEdges(stats.Sorted(xs), cfg.Bins, width, cfg.Rule)
+		if err != nil {
+			ch.ReportError(fmt.Errorf("binning: %v", err))
+			return
+		}
+		counts := make([]float64, n)
+		for _, x := range xs {
+			i := int(math.Floor((x - start) / width))
+			counts[max(0, min(i, n-1))]++
+		}
+
+		outSch := newSchema(schema, []string{BinStart, BinEnd, BinCount}, []string{}, []string{})
+		outSch.Sorted = false // ordered by bin
+		edge := func(i int) float64 {
+			e := start + float64(i)*width
+			if cfg.Log {
+				return math.Pow(10, e)
+			}
+			return e
+		}
+		for i, c := range counts {
+			out <- ch.Row{Floats: []float64{edge(i), edge(i + 1), c}, Strings: []string{}, DateTimes: []string{}, Schema: outSch}
+		}
+	}()
+	return out, nil
+}
+
+// parseBinWidth parses a bin width like 2.5 or 10ms, which is expressed in
+// units of unit.
+func parseBinWidth(s string, unit time.Duration) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	w, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		d, derr := time.ParseDuration(s)
+		if derr != nil || unit <= 0 {
+			return 0, fmt.Errorf("bin: invalid --bin-width %q; use a number or a duration like 10ms", s)
+		}
+		w = float64(d) / float64(unit)
+	}
+	if w <= 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+		return 0, fmt.Errorf("bin: --bin-width must be positive")
+	}
+	return w, nil
+}
+
+// binEdges returns the first edge, width and number of the bins for the
+// given sorted values. Bins of a given width are aligned to its multiples,
+// and a given number of bins spans the values exactly.
+func binEdges(sorted []float64, bins int, width float64, rule string) (float64, float64, int, error) {
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	if width == 0 && lo == hi {
+		return lo, 1, 1, nil
+	}
+	if width == 0 && bins == 0 {
+		if iqr := stats.Quantile(sorted, 0.75) - stats.Quantile(sorted, 0.25); rule == "fd" && iqr > 0 {
+			width = 2 * iqr / math.Cbrt(float64(len(sorted)))
+		} else {
+			bins = int(math.Ceil(math.Log2(float64(len(sorted))))) + 1
+		}
+	}
+	if width == 0 {
+		return lo, (hi - lo) / float64(bins), bins, nil
+	}
+	start := math.Floor(lo/width) * width
+	n := math.Floor((hi-start)/width) + 1
+	if n > maxBins {
+		return 0, 0, 0, fmt.Errorf("%v bins of width %v would be needed; use a wider --bin-width", n, width)
+	}
+	return start, width, int(n), nil
+}
+
+// IsBinned returns whether rows of the given Schema are histogram bins made
+// by BinTransformer, which outputs chart as bars labelled by their range.
+func IsBinned(s *ch.Schema) bool {
+	return s != nil && len(s.Floats) == 3 && len(s.Strings) == 0 &&
+		s.Floats[0] == BinStart && s.Floats[1] == BinEnd && s.Floats[2] == BinCount
+}
+
+// BinLabel returns the label of a histogram bin row, e.g. "[10, 20)", and its
+// count.
+func BinLabel(row ch.Row) (string, float64) {
+	if len(row.Floats) < 3 {
+		return "", math.NaN()
+	}
+	return fmt.Sprintf("[%v, %v)", strconv.FormatFloat(row.Floats[0], 'g', 4, 64), strconv.FormatFloat(row.Floats[1], 'g', 4, 64)), row.Floats[2]
+}
@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestBin(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"host"}}
+	var in []ch.Row
+	for _, x := range []float64{1, 2, 3, 9, 11, 12, 35, 100} {
+		in = append(in, ch.Row{Floats: []float64{x}, Strings: []string{"web"}, Schema: schema})
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want [][]float64
+	}{
+		{
+			name: "Fixed number of bins spanning the values",
+			args: []string{"--bins", "3"},
+			want: [][]float64{{1, 34, 6}, {34, 67, 1}, {67, 100, 1}},
+		},
+		{
+			name: "Width as a duration, aligned to its multiples and with empty bins",
+			args: []string{"--bin-width", "0.025s"},
+			want: [][]float64{{0, 25, 6}, {25, 50, 1}, {50, 75, 0}, {75, 100, 0}, {100, 125, 1}},
+		},
+		{
+			name: "Logarithmic bins",
+			args: []string{"--bin-log", "--bin-width", "1"},
+			want: [][]float64{{1, 10, 4}, {10, 100, 3}, {100, 1000, 1}},
+		},
+		{
+			name: "Sturges' rule",
+			args: []string{"--bin-rule", "sturges"},
+			want: [][]float64{{1, 25.75, 6}, {25.75, 50.5, 1}, {50.5, 75.25, 0}, {75.25, 100, 1}},
+		},
+		{
+			name: "Freedman–Diaconis rule",
+			want: [][]float64{{0, 15, 6}, {15, 30, 0}, {30, 45, 1}, {45, 60, 0}, {60, 75, 0}, {75, 90, 0}, {90, 105, 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := transform(t, "bin", tt.args, in...)
+			var got [][]float64
+			for _, r := range rows {
+				got = append(got, r.Floats)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if len(rows) > 0 && !IsBinned(rows[0].Schema) {
+				t.Errorf("Schema = %v, want bins", rows[0].Schema)
+			}
+		})
+	}
+}
+
+func TestBinLabel(t *testing.T) {
+	label, count := BinLabel(ch.Row{Floats: []float64{0.5, 1.25, 3}})
+	if label != "[0.5, 1.25)" || count != 3 {
+		t.Errorf("got %v, %v", label, count)
+	}
+}
@@ -0,0 +1,251 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewBucketTransformer())
+}
+
+// bucketDateFormat is the layout of the bucket start times; it's precise
+// enough for any interval, unlike the input's date format might be.
+const bucketDateFormat = time.RFC3339
+
+// maxFilledBuckets keeps filling the gaps between distant rows with a tiny
+// --bucket from flooding the output.
+const maxFilledBuckets = 100000
+
+// BucketTransformer resamples rows into fixed time intervals by their
+// datetime column, producing one row per interval with the start of the
+// interval and one float per aggregation, e.g. the request count per minute.
+type BucketTransformer struct{}
+
+func NewBucketTransformer() *BucketTransformer {
+	return &BucketTransformer{}
+}
+
+func (t *BucketTransformer) Name() string {
+	return "bucket"
+}
+
+type BucketConfig struct {
+	Interval     string
+	Aggregations string
+	Column       string
+	Fill         string
+}
+
+func (t *BucketTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &BucketConfig{}
+	fs.StringVar(&c.Interval, "bucket", "", "Resamples rows into time intervals, e.g. 30s, 5m, 1h, 1d, or calendar weeks and months: 1w, 1mo.")
+	fs.StringVar(&c.Aggregations, "bucket-agg", "count()", "Comma-separated aggregations per time interval (see --agg).")
+	fs.StringVar(&c.Column, "bucket-column", "", "Datetime column to bucket by. Defaults to the first one.")
+	fs.StringVar(&c.Fill, "bucket-fill", "none", "How to fill intervals without rows: none (skip them), zero or previous.")
+	return c
+}
+
+func (t *BucketTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*BucketConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for BucketTransformer")
+	}
+	iv, err := parseInterval(cfg.Interval)
+	if err != nil {
+		return nil, err
+	}
+	aggs, err := ParseAggregations(cfg.Aggregations)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Fill != "none" && cfg.Fill != "zero" && cfg.Fill != "previous" {
+		return nil, fmt.Errorf("bucket: unknown fill %q; expected none, zero or previous", cfg.Fill)
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, err := findDateTimeColumn(first.Schema, cfg.Column); err != nil {
+		return nil, fmt.Errorf("bucket: %v", err)
+	}
+	if err := bindAggregations(first.Schema, aggs); err != nil {
+		return nil, fmt.Errorf("bucket: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			buckets = make(map[time.Time][]accumulator)
+			starts  []time.Time
+			col     column
+			schema  *ch.Schema
+			outSch  *ch.Schema
+			err     error
+			dropped int
+		)
+		for row := range rows {
+			if row.Schema != schema || outSch == nil {
+				schema = row.Schema
+				if col, err = findDateTimeColumn(schema, cfg.Column); err == nil {
+					err = bindAggregations(schema, aggs)
+				}
+				if err != nil {
+					ch.ReportError(fmt.Errorf("bucketing: %v", err))
+					return
+				}
+				outSch = newSchema(schema, aggregationNames(aggs), []string{}, []string{col.Name})
+				outSch.DateFormat = bucketDateFormat
+				outSch.Sorted = false // ordered by bucket
+			}
+
+			ts, err := time.Parse(schema.DateFormat, col.str(row))
+			if err != nil {
+				dropped++ // e.g. null datetimes of left joins
+				continue
+			}
+			b := iv.truncate(ts)
+			accs, ok := buckets[b]
+			if !ok {
+				for _, a := range aggs {
+					accs = append(accs, a.newAccumulator())
+				}
+				buckets[b] = accs
+				starts = append(starts, b)
+			}
+			for i, a := range aggs {
+				accs[i].add(row, a.column)
+			}
+		}
+		if dropped > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: dropped %v rows without a valid %q from buckets\n", dropped, col.Name)
+		}
+		if len(starts) == 0 {
+			return
+		}
+		sort.Slice(starts, func(i, j int) bool { return starts[i].Before(starts[j]) })
+
+		// Without filling, only buckets with rows are emitted; otherwise every
+		// one between the first and the last, as long as there aren't too many
+		if cfg.Fill != "none" {
+			first, last := starts[0], starts[len(starts)-1]
+			starts = starts[:0]
+			for b := first; !b.After(last); b = iv.next(b) {
+				if len(starts) == maxFilledBuckets {
+					ch.ReportError(fmt.Errorf("bucketing: filling the buckets from %v to %v would emit more than %v rows; use a longer --bucket or --bucket-fill none", first.Format(bucketDateFormat), last.Format(bucketDateFormat), maxFilledBuckets))
+					return
+				}
+				starts = append(starts, b)
+			}
+		}
+
+		var prev []float64
+		for _, b := range starts {
+			fs := make([]float64, len(aggs))
+			if accs, ok := buckets[b]; ok {
+				for i, acc := range accs {
+					fs[i] = acc.result()
+				}
+			} else if cfg.Fill == "previous" {
+				copy(fs, prev)
+			}
+			prev = fs
+			out <- ch.Row{
+				Floats:    fs,
+				Strings:   []string{},
+				DateTimes: []string{b.Format(bucketDateFormat)},
+				Schema:    outSch,
+			}
+		}
+	}()
+	return out, nil
+}
+
+// findDateTimeColumn looks up the named datetime column, or the first one if
+// name is empty.
+func findDateTimeColumn(s *ch.Schema, name string) (column, error) {
+	if name == "" {
+		if s == nil || len(s.DateTimes) == 0 {
+			return column{}, fmt.Errorf("the input has no datetime column; is --date-format set?")
+		}
+		name = s.DateTimes[0]
+	}
+	c, err := findColumn(s, name)
+	if err == nil && c.Type != dateTimeColumn {
+		err = fmt.Errorf("column %q isn't a datetime column", name)
+	}
+	return c, err
+}
+
+// interval is a span of time that is either fixed (e.g. 5m) or calendar
+// based (e.g. 1w, 1mo), in which case it's aligned to the start of a week
+// (Monday) or month.
+type interval struct {
+	d      time.Duration
+	days   int
+	months int
+}
+
+// epochMonday is the Monday that multi-week intervals are aligned to.
+var epochMonday = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+func parseInterval(s string) (interval, error) {
+	s = strings.TrimSpace(s)
+	for _, unit := range []struct {
+		suffix string
+		days   int
+		months int
+	}{{"mo", 0, 1}, {"y", 0, 12}, {"w", 7, 0}, {"d", 1, 0}} {
+		if !strings.HasSuffix(s, unit.suffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(s, unit.suffix))
+		if err != nil || n <= 0 {
+			return interval{}, fmt.Errorf("bucket: invalid interval %q", s)
+		}
+		return interval{days: n * unit.days, months: n * unit.months}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return interval{}, fmt.Errorf("bucket: invalid interval %q; expected e.g. 30s, 5m, 1h, 1d, 1w or 1mo", s)
+	}
+	return interval{d: d}, nil
+}
+
+// truncate returns the start of the interval that t belongs to.
+func (iv interval) truncate(t time.Time) time.Time {
+	switch {
+	case iv.months > 0:
+		months := t.Year()*12 + int(t.Month()) - 1
+		months -= months % iv.months
+		return time.Date(months/12, time.Month(months%12+1), 1, 0, 0, 0, 0, t.Location())
+	case iv.days > 0:
+		since := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Sub(epochMonday).Hours()) / 24
+		offset := ((since % iv.days) + iv.days) % iv.days
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+	default:
+		return t.Truncate(iv.d)
+	}
+}
+
+// next returns the start of the interval after the one starting at t.
+func (iv interval) next(t time.Time) time.Time {
+	switch {
+	case iv.months > 0:
+		return t.AddDate(0, iv.months, 0)
+	case iv.days > 0:
+		return t.AddDate(0, 0, iv.days)
+	default:
+		return t.Add(iv.d)
+	}
+}
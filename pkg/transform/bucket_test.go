@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestBucket(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04"}
+	in := []ch.Row{
+		{Floats: []float64{10}, DateTimes: []string{"2024-01-01 10:01"}, Schema: schema},
+		{Floats: []float64{20}, DateTimes: []string{"2024-01-01 10:04"}, Schema: schema},
+		{Floats: []float64{30}, DateTimes: []string{"2024-01-01 10:16"}, Schema: schema},
+		{Floats: []float64{40}, DateTimes: []string{"2024-01-01 10:05"}, Schema: schema},
+		{Floats: []float64{50}, DateTimes: []string{"not a date"}, Schema: schema},
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		dateTimes []string
+		floats    [][]float64
+	}{
+		{
+			name:      "Counts without gaps",
+			args:      []string{"--bucket", "5m"},
+			dateTimes: []string{"2024-01-01T10:00:00Z", "2024-01-01T10:05:00Z", "2024-01-01T10:15:00Z"},
+			floats:    [][]float64{{2}, {1}, {1}},
+		},
+		{
+			name:      "Zero filled gaps",
+			args:      []string{"--bucket", "5m", "--bucket-fill", "zero", "--bucket-agg", "mean(latency),count()"},
+			dateTimes: []string{"2024-01-01T10:00:00Z", "2024-01-01T10:05:00Z", "2024-01-01T10:10:00Z", "2024-01-01T10:15:00Z"},
+			floats:    [][]float64{{15, 2}, {40, 1}, {0, 0}, {30, 1}},
+		},
+		{
+			name:      "Previous filled gaps",
+			args:      []string{"--bucket", "5m", "--bucket-fill", "previous", "--bucket-agg", "max(latency)"},
+			dateTimes: []string{"2024-01-01T10:00:00Z", "2024-01-01T10:05:00Z", "2024-01-01T10:10:00Z", "2024-01-01T10:15:00Z"},
+			floats:    [][]float64{{20}, {40}, {40}, {30}},
+		},
+		{
+			name:      "Days",
+			args:      []string{"--bucket", "1d", "--bucket-agg", "sum(latency)"},
+			dateTimes: []string{"2024-01-01T00:00:00Z"},
+			floats:    [][]float64{{100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := transform(t, "bucket", tt.args, in...)
+			var (
+				dateTimes []string
+				floats    [][]float64
+			)
+			for _, r := range rows {
+				dateTimes = append(dateTimes, r.DateTimes...)
+				floats = append(floats, r.Floats)
+			}
+			if !reflect.DeepEqual(dateTimes, tt.dateTimes) {
+				t.Errorf("DateTimes = %v, want %v", dateTimes, tt.dateTimes)
+			}
+			if !reflect.DeepEqual(floats, tt.floats) {
+				t.Errorf("Floats = %v, want %v", floats, tt.floats)
+			}
+			if rows[0].Schema.DateFormat != time.RFC3339 || !reflect.DeepEqual(rows[0].Schema.DateTimes, []string{"ts"}) {
+				t.Errorf("Unexpected schema %v", rows[0].Schema)
+			}
+		})
+	}
+}
+
+func TestBucket_DistantRows(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	in := []ch.Row{
+		{DateTimes: []string{"2024-01-01"}, Schema: schema},
+		{DateTimes: []string{"2018-01-01"}, Schema: schema},
+	}
+	rows := transform(t, "bucket", []string{"--bucket", "1s"}, in...)
+	if len(rows) != 2 || rows[0].DateTimes[0] != "2018-01-01T00:00:00Z" {
+		t.Errorf("Expected only the buckets with rows, in order, got %v", rows)
+	}
+	if err := transformErr(t, "bucket", []string{"--bucket", "1s", "--bucket-fill", "zero"}, in...); err == nil {
+		t.Error("Expected an error filling millions of buckets")
+	}
+}
+
+func TestInterval(t *testing.T) {
+	ts := time.Date(2024, 5, 15, 13, 47, 12, 0, time.UTC) // A Wednesday
+	tests := []struct {
+		interval string
+		start    time.Time
+		next     time.Time
+	}{
+		{"30s", time.Date(2024, 5, 15, 13, 47, 0, 0, time.UTC), time.Date(2024, 5, 15, 13, 47, 30, 0, time.UTC)},
+		{"15m", time.Date(2024, 5, 15, 13, 45, 0, 0, time.UTC), time.Date(2024, 5, 15, 14, 0, 0, 0, time.UTC)},
+		{"1h", time.Date(2024, 5, 15, 13, 0, 0, 0, time.UTC), time.Date(2024, 5, 15, 14, 0, 0, 0, time.UTC)},
+		{"1d", time.Date(2024, 5, 15, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 16, 0, 0, 0, 0, time.UTC)},
+		{"1w", time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 20, 0, 0, 0, 0, time.UTC)},
+		{"1mo", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"3mo", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"1y", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		iv, err := parseInterval(tt.interval)
+		if err != nil {
+			t.Fatalf("parseInterval(%q) error = %v", tt.interval, err)
+		}
+		if got := iv.truncate(ts); !got.Equal(tt.start) {
+			t.Errorf("%v: truncate() = %v, want %v", tt.interval, got, tt.start)
+		}
+		if got := iv.next(tt.start); !got.Equal(tt.next) {
+			t.Errorf("%v: next() = %v, want %v", tt.interval, got, tt.next)
+		}
+	}
+
+	for _, s := range []string{"", "0m", "-1h", "xw", "1q"} {
+		if _, err := parseInterval(s); err == nil {
+			t.Errorf("parseInterval(%q) expected error", s)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/expr"
+)
+
+func init() {
+	ch.RegisterTransformer(NewComputeTransformer())
+}
+
+// ComputeTransformer appends columns computed from the others with an
+// expression, e.g. `err_rate = errors / total * 100`. The type of a column
+// is that of its expression: numbers become float columns, times datetime
+// columns, and strings and bools string columns. Expressions are checked
+// against the columns of the first row, and are null (NaN or empty) on rows
+// they can't be evaluated on. See package expr for the syntax of expressions.
+type ComputeTransformer struct{}
+
+func NewComputeTransformer() *ComputeTransformer {
+	return &ComputeTransformer{}
+}
+
+func (t *ComputeTransformer) Name() string {
+	return "compute"
+}
+
+type ComputeConfig struct {
+	Columns string
+}
+
+func (t *ComputeTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &ComputeConfig{}
+	fs.StringVar(&c.Columns, "compute", "", `Comma-separated columns to append, computed with expressions, e.g. 'err_rate = errors / total * 100, service = lower(extract(path, "^/(\w+)"))'. Later columns may refer to earlier ones.`)
+	return c
+}
+
+// computation is a column computed with an expression.
+type computation struct {
+	name string
+	expr *expr.Expr
+}
+
+func (t *ComputeTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*ComputeConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for ComputeTransformer")
+	}
+	cs, err := parseComputations(cfg.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, _, err := computeEnvs(first.Schema, cs); err != nil {
+		return nil, fmt.Errorf("compute: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema *ch.Schema
+			// schemas[i] is the schema of the rows the i-th computation is
+			// evaluated over, and schemas[len(cs)] that of the output rows
+			schemas []*ch.Schema
+			envs    []*rowEnv
+			kinds   []expr.Kind
+			err     error
+			nulls   int
+			nullErr error
+		)
+		for row := range rows {
+			if row.Schema != schema || schemas == nil {
+				schema = row.Schema
+				if envs, kinds, schemas, err = computeEnvs(schema, cs); err != nil {
+					ch.ReportError(fmt.Errorf("computing columns: %v", err))
+					return
+				}
+			}
+			for i, c := range cs {
+				envs[i].row = row
+				v, err := c.expr.Eval(envs[i])
+				if err != nil {
+					// e.g. a datetime that doesn't parse; other rows may be fine
+					if nulls++; nullErr == nil {
+						nullErr = fmt.Errorf("%v: %v", c.name, err)
+					}
+					row = appendNull(row, kinds[i], schemas[i+1])
+					continue
+				}
+				row = appendValue(row, v, schemas[i+1])
+			}
+			out <- row
+		}
+		if nulls > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: left %v computed values null that couldn't be evaluated, e.g. %v\n", nulls, nullErr)
+		}
+	}()
+	return out, nil
+}
+
+// computeEnvs resolves the identifiers of each computation to the columns of
+// the rows it's evaluated over, starting with rows of the given Schema, and
+// returns the kinds of their values, and those rows' schemas followed by that
+// of the output rows.
+func computeEnvs(s *ch.Schema, cs []computation) ([]*rowEnv, []expr.Kind, []*ch.Schema, error) {
+	envs, kinds, schemas := make([]*rowEnv, len(cs)), make([]expr.Kind, len(cs)), []*ch.Schema{s}
+	for i, c := range cs {
+		env, err := newRowEnv(schemas[i], c.expr)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%v: %v", c.name, err)
+		}
+		k, err := c.expr.Check(env.kinds())
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%v: %v", c.name, err)
+		}
+		envs[i], kinds[i] = env, k
+		schemas = append(schemas, computedSchema(schemas[i], c.name, k))
+	}
+	return envs, kinds, schemas, nil
+}
+
+// parseComputations parses a comma-separated list of `name = expression`.
+func parseComputations(spec string) ([]computation, error) {
+	var cs []computation
+	for _, s := range splitTopLevel(spec) {
+		name, src, ok := cutAssignment(s)
+		if !ok {
+			return nil, fmt.Errorf("compute: %q should look like `name = expression`", s)
+		}
+		e, err := expr.Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("compute: %v", err)
+		}
+		cs = append(cs, computation{name: name, expr: e})
+	}
+	if len(cs) == 0 {
+		return nil, fmt.Errorf("compute: --compute is required")
+	}
+	return cs, nil
+}
+
+// cutAssignment splits `name = expression` on its first lone `=`, i.e. one
+// that isn't part of ==, !=, <=, >= or =~.
+func cutAssignment(s string) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' {
+			continue
+		}
+		if i+1 < len(s) && (s[i+1] == '=' || s[i+1] == '~') {
+			return "", "", false
+		}
+		if i > 0 && strings.ContainsRune("!<>", rune(s[i-1])) {
+			return "", "", false
+		}
+		name := strings.Trim(strings.TrimSpace(s[:i]), "`")
+		return name, s[i+1:], name != ""
+	}
+	return "", "", false
+}
+
+// computedSchema returns the Schema of rows with a column of the given kind
+// appended.
+func computedSchema(s *ch.Schema, name string, kind expr.Kind) *ch.Schema {
+	var floats, strs, dateTimes []string
+	if s != nil {
+		floats, strs, dateTimes = s.Floats, s.Strings, s.DateTimes
+	}
+	// Copy the column lists, as they may be shared with other schemas
+	switch kind {
+	case expr.Number:
+		floats = append(floats[:len(floats):len(floats)], name)
+	case expr.Time:
+		dateTimes = append(dateTimes[:len(dateTimes):len(dateTimes)], name)
+	default:
+		strs = append(strs[:len(strs):len(strs)], name)
+	}
+	out := newSchema(s, floats, strs, dateTimes)
+	if out.DateFormat == "" && kind == expr.Time {
+		out.DateFormat = time.RFC3339
+	}
+	return out
+}
+
+// appendNull returns the row with a null appended to the column of the given
+// kind, without modifying the original row's fields.
+func appendNull(row ch.Row, kind expr.Kind, s *ch.Schema) ch.Row {
+	switch kind {
+	case expr.Number:
+		row.Floats = append(row.Floats[:len(row.Floats):len(row.Floats)], math.NaN())
+	case expr.Time:
+		row.DateTimes = append(row.DateTimes[:len(row.DateTimes):len(row.DateTimes)], "")
+	default:
+		row.Strings = append(row.Strings[:len(row.Strings):len(row.Strings)], "")
+	}
+	row.Schema = s
+	return row
+}
+
+// appendValue returns the row with the value appended to the column of its
+// kind, without modifying the original row's fields.
+func appendValue(row ch.Row, v expr.Value, s *ch.Schema) ch.Row {
+	switch v.Kind {
+	case expr.Number:
+		row.Floats = append(row.Floats[:len(row.Floats):len(row.Floats)], v.Num)
+	case expr.Time:
+		row.DateTimes = append(row.DateTimes[:len(row.DateTimes):len(row.DateTimes)], v.Time.Format(s.DateFormat))
+	case expr.String:
+		row.Strings = append(row.Strings[:len(row.Strings):len(row.Strings)], v.Str)
+	default:
+		row.Strings = append(row.Strings[:len(row.Strings):len(row.Strings)], fmt.Sprint(v.Bool))
+	}
+	row.Schema = s
+	return row
+}
@@ -0,0 +1,77 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestCompute(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"errors", "total"}, Strings: []string{"path"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04"}
+	in := []ch.Row{
+		{Floats: []float64{5, 200}, Strings: []string{"/API/users/1"}, DateTimes: []string{"2024-01-01 10:00"}, Schema: schema},
+		{Floats: []float64{1, 10}, Strings: []string{"/health"}, DateTimes: []string{"2024-01-01 10:30"}, Schema: schema},
+	}
+
+	rows := transform(t, "compute", []string{"--compute", `err_rate = errors / total * 100, service = lower(extract(path, "^/(\w+)")), bad = err_rate > 5, ` + "`next hour`" + ` = 2024-01-01T11:00:00Z - ts`}, in...)
+	if len(rows) != 2 {
+		t.Fatalf("got %v rows, want 2", len(rows))
+	}
+	want := ch.Schema{Floats: []string{"errors", "total", "err_rate", "next hour"}, Strings: []string{"path", "service", "bad"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04"}
+	if !reflect.DeepEqual(*rows[1].Schema, want) {
+		t.Errorf("Schema = %v, want %v", rows[1].Schema, want)
+	}
+	if rows[0].Schema != rows[1].Schema {
+		t.Error("rows of the same input schema should share the output schema")
+	}
+	if got, want := rows[0].Floats, []float64{5, 200, 2.5, 3600}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Floats = %v, want %v", got, want)
+	}
+	if got, want := rows[1].Strings, []string{"/health", "health", "true"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Strings = %v, want %v", got, want)
+	}
+	if len(in[0].Floats) != 2 || len(schema.Floats) != 2 {
+		t.Error("Input rows or schema were modified")
+	}
+}
+
+func TestParseComputations(t *testing.T) {
+	for _, spec := range []string{"", "a == b", "a >= 1", "= 1", "a = (", "a = b, c"} {
+		if _, err := parseComputations(spec); err == nil {
+			t.Errorf("parseComputations(%q) should have failed", spec)
+		}
+	}
+	cs, err := parseComputations(`ok = a == "x,y", b = c <= 1`)
+	if err != nil || len(cs) != 2 || cs[0].name != "ok" || cs[1].name != "b" {
+		t.Errorf("got %v, %v", cs, err)
+	}
+}
+
+func TestCompute_Errors(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{"s"}, DateTimes: []string{}}
+	row := ch.Row{Floats: []float64{3}, Strings: []string{"a"}, Schema: schema}
+	for _, spec := range []string{`r = if(x > 2, "big", 1)`, "r = y + 1", "r = s * 2"} {
+		if err := transformErr(t, "compute", []string{"--compute", spec}, row); err == nil {
+			t.Errorf("Expected --compute %q to be rejected", spec)
+		}
+	}
+}
+
+func TestCompute_Nulls(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	rows := transform(t, "compute", []string{"--compute", "age = 2024-01-10T00:00:00Z - ts"},
+		ch.Row{DateTimes: []string{"2024-01-09"}, Schema: schema},
+		ch.Row{DateTimes: []string{"yesterday"}, Schema: schema},
+	)
+	if len(rows) != 2 {
+		t.Fatalf("Expected rows that can't be computed to be kept, got %v", rows)
+	}
+	if f := rows[0].Floats; len(f) != 1 || f[0] != 86400 {
+		t.Errorf("Floats = %v, want [86400]", f)
+	}
+	if f := rows[1].Floats; len(f) != 1 || !math.IsNaN(f[0]) {
+		t.Errorf("Floats = %v, want a null", f)
+	}
+}
@@ -0,0 +1,296 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewCumSumTransformer())
+	ch.RegisterTransformer(NewDiffTransformer())
+	ch.RegisterTransformer(NewRateTransformer())
+}
+
+// CumSumTransformer replaces float columns with their running totals.
+type CumSumTransformer struct{}
+
+func NewCumSumTransformer() *CumSumTransformer {
+	return &CumSumTransformer{}
+}
+
+func (t *CumSumTransformer) Name() string {
+	return "cumsum"
+}
+
+type CumSumConfig struct {
+	Columns string
+	By      string
+}
+
+func (t *CumSumTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &CumSumConfig{}
+	fs.StringVar(&c.Columns, "cumsum", "", "Comma-separated float columns to replace with their running totals. With --transform cumsum, all of them.")
+	fs.StringVar(&c.By, "cumsum-by", "", seriesByUsage)
+	return c
+}
+
+func (t *CumSumTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*CumSumConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for CumSumTransformer")
+	}
+	return derive(rows, "cumsum", splitColumns(cfg.Columns), splitColumns(cfg.By), 0)
+}
+
+// DiffTransformer replaces float columns with their difference from the
+// previous row.
+type DiffTransformer struct{}
+
+func NewDiffTransformer() *DiffTransformer {
+	return &DiffTransformer{}
+}
+
+func (t *DiffTransformer) Name() string {
+	return "diff"
+}
+
+type DiffConfig struct {
+	Columns string
+	By      string
+}
+
+func (t *DiffTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &DiffConfig{}
+	fs.StringVar(&c.Columns, "diff", "", "Comma-separated float columns to replace with their difference from the previous row. With --transform diff, all of them.")
+	fs.StringVar(&c.By, "diff-by", "", seriesByUsage)
+	return c
+}
+
+func (t *DiffTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*DiffConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for DiffTransformer")
+	}
+	return derive(rows, "diff", splitColumns(cfg.Columns), splitColumns(cfg.By), 0)
+}
+
+// RateTransformer replaces monotonic counters with their rate of change per
+// second (or per --rate-per), using the time between rows. A counter lower
+// than its previous value is assumed to have been reset to zero.
+type RateTransformer struct{}
+
+func NewRateTransformer() *RateTransformer {
+	return &RateTransformer{}
+}
+
+func (t *RateTransformer) Name() string {
+	return "rate"
+}
+
+type RateConfig struct {
+	Columns string
+	Per     time.Duration
+	By      string
+}
+
+func (t *RateTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &RateConfig{}
+	fs.StringVar(&c.Columns, "rate", "", "Comma-separated counter columns to replace with their rate of change. With --transform rate, all float columns.")
+	fs.DurationVar(&c.Per, "rate-per", time.Second, "Time unit of rates, e.g. 1s or 1m.")
+	fs.StringVar(&c.By, "rate-by", "", seriesByUsage)
+	return c
+}
+
+func (t *RateTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*RateConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for RateTransformer")
+	}
+	if cfg.Per <= 0 {
+		return nil, fmt.Errorf("rate: --rate-per must be positive")
+	}
+	return derive(rows, "rate", splitColumns(cfg.Columns), splitColumns(cfg.By), cfg.Per)
+}
+
+// seriesByUsage describes the flags choosing the columns that tell the series
+// of derived values apart.
+const seriesByUsage = "Comma-separated columns telling apart series (e.g. 'host,metric') whose rows are derived from each other. Defaults to the first string column."
+
+func splitColumns(s string) []string {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// series is the state of a derivation for the rows of one series.
+type series struct {
+	prev   []float64   // of each column, NaN until it has a finite value
+	prevTs []time.Time // of each column's previous finite value
+	lastTs time.Time   // of the latest row
+}
+
+func newSeries(n int) *series {
+	s := &series{prev: make([]float64, n), prevTs: make([]time.Time, n)}
+	for i := range s.prev {
+		s.prev[i] = math.NaN()
+	}
+	return s
+}
+
+// derive replaces the given float columns (all of them if none) with values
+// derived from the previous row of the same series, i.e. the previous row
+// with the same values of the by columns (the first string column if none),
+// so that e.g. counters of many hosts can be interleaved. The first row of
+// every series is dropped by diff and rate, which have nothing to compare it
+// with, and values without a previous finite value to compare with are NaN.
+func derive(rows <-chan ch.Row, kind string, names, by []string, per time.Duration) (<-chan ch.Row, error) {
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := derivedColumns(first.Schema, kind, names); err != nil {
+		return nil, fmt.Errorf("%v: %v", kind, err)
+	}
+	if _, err := seriesColumns(first.Schema, by); err != nil {
+		return nil, fmt.Errorf("%v: %v", kind, err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema  *ch.Schema
+			outSch  *ch.Schema
+			cols    []column
+			keyCols []column
+			tsCol   column
+			state   map[string]*series
+			err     error
+		)
+		for row := range rows {
+			if row.Schema != schema || outSch == nil {
+				schema = row.Schema
+				if cols, tsCol, err = derivedColumns(schema, kind, names); err == nil {
+					keyCols, err = seriesColumns(schema, by)
+				}
+				if err != nil {
+					ch.ReportError(fmt.Errorf("computing %v: %v", kind, err))
+					return
+				}
+				outSch = newSchema(schema, append([]string(nil), schema.Floats...), schema.Strings, schema.DateTimes)
+				for _, c := range cols {
+					outSch.Floats[c.Index] = fmt.Sprintf("%v(%v)", kind, c.Name)
+				}
+				state = make(map[string]*series)
+			}
+
+			var key strings.Builder
+			for _, c := range keyCols {
+				key.WriteString(c.str(row))
+				key.WriteByte(0)
+			}
+			s, ok := state[key.String()]
+			if !ok {
+				s = newSeries(len(row.Floats))
+				state[key.String()] = s
+			}
+			var ts time.Time
+			if kind == "rate" {
+				if ts, err = time.Parse(schema.DateFormat, tsCol.str(row)); err != nil {
+					continue
+				}
+			}
+			later := !ok || ts.After(s.lastTs)
+			if later {
+				s.lastTs = ts
+			}
+
+			fs := append([]float64(nil), row.Floats...)
+			for _, c := range cols {
+				x, prev := c.float(row), s.prev[c.Index]
+				if math.IsNaN(x) {
+					continue
+				}
+				switch kind {
+				case "cumsum":
+					if math.IsNaN(prev) {
+						prev = 0
+					}
+					fs[c.Index] = prev + x
+					s.prev[c.Index] = fs[c.Index]
+				case "diff":
+					fs[c.Index] = x - prev
+					s.prev[c.Index] = x
+				case "rate":
+					elapsed := ts.Sub(s.prevTs[c.Index])
+					if !math.IsNaN(prev) && elapsed <= 0 {
+						fs[c.Index] = math.NaN()
+						continue
+					}
+					delta := x - prev
+					if delta < 0 { // counter reset
+						delta = x
+					}
+					fs[c.Index] = delta * float64(per) / float64(elapsed)
+					s.prev[c.Index], s.prevTs[c.Index] = x, ts
+				}
+			}
+
+			if kind != "cumsum" && (!ok || (kind == "rate" && !later)) {
+				continue
+			}
+			row.Floats, row.Schema = fs, outSch
+			out <- row
+		}
+	}()
+	return out, nil
+}
+
+// seriesColumns locates the named columns telling series apart, or the first
+// string column if none, if there is one.
+func seriesColumns(s *ch.Schema, names []string) ([]column, error) {
+	if len(names) == 0 && s != nil && len(s.Strings) > 0 {
+		names = s.Strings[:1]
+	}
+	return findColumns(s, names)
+}
+
+// derivedColumns locates the named float columns (all of those holding
+// values, rather than e.g. anomaly flags, if none), and the datetime column
+// rates are computed over.
+func derivedColumns(s *ch.Schema, kind string, names []string) ([]column, column, error) {
+	var tsCol column
+	if s == nil {
+		return nil, tsCol, fmt.Errorf("the input's columns are unknown")
+	}
+	if len(names) == 0 {
+		for i, name := range s.Floats {
+			if s.FloatRole(i).Role == ch.RoleValue {
+				names = append(names, name)
+			}
+		}
+	}
+	cols, err := findColumns(s, names)
+	if err != nil {
+		return nil, tsCol, err
+	}
+	for _, c := range cols {
+		if c.Type != floatColumn {
+			return nil, tsCol, fmt.Errorf("%v requires numeric columns but %q isn't one", kind, c.Name)
+		}
+	}
+	if kind == "rate" {
+		tsCol, err = findDateTimeColumn(s, "")
+	}
+	return cols, tsCol, err
+}
@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestDerive(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"requests", "cpu"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: "15:04:05"}
+	in := []ch.Row{
+		{Floats: []float64{100, 1}, Strings: []string{"a"}, DateTimes: []string{"10:00:00"}, Schema: schema},
+		{Floats: []float64{500, 2}, Strings: []string{"b"}, DateTimes: []string{"10:00:00"}, Schema: schema},
+		{Floats: []float64{160, 3}, Strings: []string{"a"}, DateTimes: []string{"10:00:10"}, Schema: schema},
+		{Floats: []float64{20, 4}, Strings: []string{"a"}, DateTimes: []string{"10:00:20"}, Schema: schema},
+		{Floats: []float64{800, 5}, Strings: []string{"b"}, DateTimes: []string{"10:00:30"}, Schema: schema},
+	}
+
+	tests := []struct {
+		name      string
+		transform string
+		args      []string
+		floats    [][]float64
+		names     []string
+	}{
+		{
+			name:      "Cumulative sum of every column",
+			transform: "cumsum",
+			floats:    [][]float64{{100, 1}, {500, 2}, {260, 4}, {280, 8}, {1300, 7}},
+			names:     []string{"cumsum(requests)", "cumsum(cpu)"},
+		},
+		{
+			name:      "Difference of one column",
+			transform: "diff",
+			args:      []string{"--diff", "cpu"},
+			floats:    [][]float64{{160, 2}, {20, 1}, {800, 3}},
+			names:     []string{"requests", "diff(cpu)"},
+		},
+		{
+			name:      "Rate per second with counter reset",
+			transform: "rate",
+			args:      []string{"--rate", "requests"},
+			floats:    [][]float64{{6, 3}, {2, 4}, {10, 5}},
+			names:     []string{"rate(requests)", "cpu"},
+		},
+		{
+			name:      "Rate per minute",
+			transform: "rate",
+			args:      []string{"--rate", "requests", "--rate-per", "1m"},
+			floats:    [][]float64{{360, 3}, {120, 4}, {600, 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := transform(t, tt.transform, tt.args, in...)
+			var floats [][]float64
+			for _, r := range rows {
+				floats = append(floats, r.Floats)
+			}
+			if !reflect.DeepEqual(floats, tt.floats) {
+				t.Errorf("Floats = %v, want %v", floats, tt.floats)
+			}
+			if tt.names != nil && !reflect.DeepEqual(rows[0].Schema.Floats, tt.names) {
+				t.Errorf("Float columns = %v, want %v", rows[0].Schema.Floats, tt.names)
+			}
+		})
+	}
+	if in[0].Floats[0] != 100 {
+		t.Error("Input rows were modified")
+	}
+}
+
+func TestDerive_Series(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"requests"}, Strings: []string{"host", "msg"}, DateTimes: []string{"ts"}, DateFormat: "15:04:05"}
+	in := []ch.Row{
+		{Floats: []float64{100}, Strings: []string{"a", "started"}, DateTimes: []string{"10:00:00"}, Schema: schema},
+		{Floats: []float64{160}, Strings: []string{"a", "busy"}, DateTimes: []string{"10:00:10"}, Schema: schema},
+		{Floats: []float64{170}, Strings: []string{"a", "busy"}, DateTimes: []string{"10:00:20"}, Schema: schema},
+	}
+
+	// Free text in other string columns doesn't start new series
+	rows := transform(t, "diff", nil, in...)
+	if len(rows) != 2 || rows[0].Floats[0] != 60 || rows[1].Floats[0] != 10 {
+		t.Errorf("Rows = %v, want diffs of 60 and 10", rows)
+	}
+	rows = transform(t, "diff", []string{"--diff-by", "host,msg"}, in...)
+	if len(rows) != 1 || rows[0].Floats[0] != 10 {
+		t.Errorf("Rows = %v, want a diff of 10", rows)
+	}
+	if err := transformErr(t, "diff", []string{"--diff-by", "nonexistent"}, in...); err == nil {
+		t.Error("Expected an error for an unknown --diff-by column")
+	}
+}
+
+func TestDerive_Nulls(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"requests"}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "15:04:05"}
+	in := []ch.Row{
+		{Floats: []float64{math.NaN()}, DateTimes: []string{"10:00:00"}, Schema: schema},
+		{Floats: []float64{100}, DateTimes: []string{"10:00:10"}, Schema: schema},
+		{Floats: []float64{math.NaN()}, DateTimes: []string{"10:00:20"}, Schema: schema},
+		{Floats: []float64{160}, DateTimes: []string{"10:00:30"}, Schema: schema},
+	}
+
+	// Values are derived from the previous finite one, and when it was
+	for _, tt := range []struct {
+		transform string
+		want      []float64
+	}{
+		{"diff", []float64{math.NaN(), math.NaN(), 60}},
+		{"rate", []float64{math.NaN(), math.NaN(), 3}},
+		{"cumsum", []float64{math.NaN(), 100, math.NaN(), 260}},
+	} {
+		rows := transform(t, tt.transform, nil, in...)
+		var got []float64
+		for _, r := range rows {
+			got = append(got, r.Floats[0])
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%v = %v, want %v", tt.transform, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewDistinctTransformer())
+}
+
+// DistinctTransformer drops duplicate rows, i.e. rows whose key columns (all
+// of them by default) equal those of an earlier row, keeping the first of
+// each. It streams, remembering every distinct key it has seen.
+type DistinctTransformer struct{}
+
+func NewDistinctTransformer() *DistinctTransformer {
+	return &DistinctTransformer{}
+}
+
+func (t *DistinctTransformer) Name() string {
+	return "distinct"
+}
+
+type DistinctConfig struct {
+	Distinct bool
+	By       string
+}
+
+func (t *DistinctTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &DistinctConfig{}
+	fs.BoolVar(&c.Distinct, "distinct", true, "Drops duplicate rows, keeping the first of each. Implied by --distinct-by; --distinct=false keeps them.")
+	fs.StringVar(&c.By, "distinct-by", "", "Comma-separated columns whose values tell rows apart (e.g. 'user'). Defaults to all of them.")
+	return c
+}
+
+func (t *DistinctTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*DistinctConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for DistinctTransformer")
+	}
+	if !cfg.Distinct {
+		return rows, nil
+	}
+	names := splitColumns(cfg.By)
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, err := findColumns(first.Schema, names); err != nil {
+		return nil, fmt.Errorf("distinct: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			seen    = make(map[string]bool)
+			schema  *ch.Schema
+			keyCols []column
+			err     error
+		)
+		for row := range rows {
+			if names != nil && (row.Schema != schema || keyCols == nil) {
+				schema = row.Schema
+				if keyCols, err = findColumns(schema, names); err != nil {
+					ch.ReportError(fmt.Errorf("dropping duplicates: %v", err))
+					return
+				}
+			}
+			key := distinctKey(row, keyCols)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out <- row
+		}
+	}()
+	return out, nil
+}
+
+// distinctKey returns the values of the row's key columns, or of all of its
+// columns if there are none.
+func distinctKey(row ch.Row, keyCols []column) string {
+	var key strings.Builder
+	if keyCols != nil {
+		for _, c := range keyCols {
+			key.WriteString(c.str(row))
+			key.WriteByte(0)
+		}
+		return key.String()
+	}
+	for _, f := range row.Floats {
+		key.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+		key.WriteByte(0)
+	}
+	for _, vs := range [][]string{row.Strings, row.DateTimes} {
+		key.WriteByte(1) // rows of different shapes differ
+		for _, v := range vs {
+			key.WriteString(v)
+			key.WriteByte(0)
+		}
+	}
+	return key.String()
+}
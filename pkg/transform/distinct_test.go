@@ -0,0 +1,44 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestDistinct(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"bytes"}, Strings: []string{"user"}, DateTimes: []string{"hour"}, DateFormat: "2006-01-02T15"}
+	in := []ch.Row{
+		{Floats: []float64{10}, Strings: []string{"ann"}, DateTimes: []string{"2024-01-01T10"}, Schema: schema},
+		{Floats: []float64{10}, Strings: []string{"ann"}, DateTimes: []string{"2024-01-01T10"}, Schema: schema},
+		{Floats: []float64{20}, Strings: []string{"ann"}, DateTimes: []string{"2024-01-01T10"}, Schema: schema},
+		{Floats: []float64{10}, Strings: []string{"bob"}, DateTimes: []string{"2024-01-01T10"}, Schema: schema},
+		{Floats: []float64{30}, Strings: []string{"ann"}, DateTimes: []string{"2024-01-01T11"}, Schema: schema},
+	}
+	bytes := func(rows []ch.Row) []float64 {
+		var fs []float64
+		for _, row := range rows {
+			fs = append(fs, row.Floats[0])
+		}
+		return fs
+	}
+
+	if got := bytes(transform(t, "distinct", []string{"--distinct"}, in...)); !reflect.DeepEqual(got, []float64{10, 20, 10, 30}) {
+		t.Errorf("Distinct rows = %v, want [10 20 10 30]", got)
+	}
+	if got := bytes(transform(t, "distinct", []string{"--distinct-by", "user,hour"}, in...)); !reflect.DeepEqual(got, []float64{10, 10, 30}) {
+		t.Errorf("Distinct users per hour = %v, want [10 10 30]", got)
+	}
+	if err := transformErr(t, "distinct", []string{"--distinct-by", "nope"}, in...); err == nil {
+		t.Error("Expected an error for an unknown column")
+	}
+}
+
+func TestDistinct_Disabled(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{}, Strings: []string{"user"}, DateTimes: []string{}}
+	row := ch.Row{Floats: []float64{}, Strings: []string{"a"}, Schema: schema}
+	if rows := transform(t, "distinct", []string{"--distinct=false"}, row, row); len(rows) != 2 {
+		t.Errorf("Expected --distinct=false to keep duplicates, got %v", rows)
+	}
+}
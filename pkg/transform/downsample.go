@@ -0,0 +1,304 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewDownsampleTransformer())
+}
+
+// Downsampling methods.
+const (
+	// DownsampleLTTB picks the points forming the largest triangles with
+	// their neighbouring buckets' (Largest-Triangle-Three-Buckets), which
+	// keeps a series' visual shape.
+	DownsampleLTTB = "lttb"
+	// DownsampleMinMax keeps the lowest and highest points within each of
+	// equally wide ranges of x, like pixels, so that no peak is lost.
+	DownsampleMinMax = "minmax"
+)
+
+// DownsampleTransformer reduces long series to at most --max-points rows that
+// preserve their shape, so that charts of millions of points stay usable.
+type DownsampleTransformer struct{}
+
+func NewDownsampleTransformer() *DownsampleTransformer {
+	return &DownsampleTransformer{}
+}
+
+func (t *DownsampleTransformer) Name() string {
+	return "downsample"
+}
+
+type DownsampleConfig struct {
+	MaxPoints int
+	Method    string
+}
+
+func (t *DownsampleTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &DownsampleConfig{}
+	fs.IntVar(&c.MaxPoints, "max-points", 1000, "Downsamples series to at most this many rows in total, besides flagged anomalies.")
+	fs.StringVar(&c.Method, "downsample", DownsampleLTTB, "Downsampling method: lttb (Largest-Triangle-Three-Buckets) or minmax (lowest and highest points per x range).")
+	return c
+}
+
+func (t *DownsampleTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*DownsampleConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for DownsampleTransformer")
+	}
+	if cfg.Method != DownsampleLTTB && cfg.Method != DownsampleMinMax {
+		return nil, fmt.Errorf("downsample: unknown method %q; use lttb or minmax", cfg.Method)
+	}
+	if cfg.MaxPoints < 3 {
+		return nil, fmt.Errorf("downsample: --max-points must be at least 3")
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema   *ch.Schema
+			buffered []ch.Row
+		)
+		flush := func() {
+			for _, row := range Downsample(buffered, cfg.MaxPoints, cfg.Method) {
+				out <- row
+			}
+		}
+		for row := range rows {
+			if row.Schema != schema && len(buffered) > 0 {
+				flush()
+				buffered = nil
+			}
+			schema = row.Schema
+			buffered = append(buffered, row)
+		}
+		flush()
+	}()
+	return out, nil
+}
+
+// Downsample returns at most maxPoints of the given rows, which share a
+// Schema, in their original order. The points are split among the float
+// columns, which are downsampled separately against the rows' x: their first
+// datetime column, or their first float column if they have no datetimes but
+// many floats, or else the order of rows. Each series (i.e. the rows with the
+// same strings) is given 3 of a column's points, or as many rows as it has if
+// fewer, and a share of the rest proportional to its length; if there are
+// too many series for that, e.g. because every row has its own label, the
+// rows are downsampled as one. Rows flagged as outliers by AnomalyTransformer
+// are always kept, even beyond maxPoints.
+func Downsample(rows []ch.Row, maxPoints int, method string) []ch.Row {
+	if len(rows) <= maxPoints || len(rows) == 0 {
+		return rows
+	}
+	xs, yCols := downsampleAxes(rows)
+	if len(yCols) == 0 {
+		return rows
+	}
+
+	var (
+		series = make(map[string][]int)
+		keys   []string
+	)
+	for i, row := range rows {
+		key := strings.Join(row.Strings, "\x00")
+		if _, ok := series[key]; !ok {
+			keys = append(keys, key)
+		}
+		series[key] = append(series[key], i)
+	}
+	budget := maxPoints / len(yCols)
+	if 3*len(keys) > budget {
+		keys, series = []string{""}, map[string][]int{"": allIndices(len(rows))}
+	}
+	rest := max(0, budget-3*len(keys))
+
+	keep := make([]bool, len(rows))
+	for _, key := range keys {
+		idx := series[key]
+		sort.SliceStable(idx, func(i, j int) bool { return xs[idx[i]] < xs[idx[j]] })
+		n := max(3, min(3, len(idx))+rest*len(idx)/len(rows))
+
+		sx, sy := make([]float64, len(idx)), make([]float64, len(idx))
+		for i, j := range idx {
+			sx[i] = xs[j]
+		}
+		for _, c := range yCols {
+			for i, j := range idx {
+				sy[i] = math.NaN()
+				if c < len(rows[j].Floats) {
+					sy[i] = rows[j].Floats[c]
+				}
+			}
+			var picked []int
+			if method == DownsampleMinMax {
+				picked = minMax(sx, sy, n)
+			} else {
+				picked = lttb(sx, sy, n)
+			}
+			for _, p := range picked {
+				keep[idx[p]] = true
+			}
+		}
+	}
+
+	var result []ch.Row
+	for i, row := range rows {
+		if keep[i] || hasAnomaly(row) {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// downsampleAxes returns the x of every row and the float columns to
+// downsample as y, leaving out anomaly flags.
+func downsampleAxes(rows []ch.Row) ([]float64, []int) {
+	var (
+		xs     = make([]float64, len(rows))
+		first  = rows[0]
+		values []int
+	)
+	for c := range first.Floats {
+		if first.Schema.FloatRole(c).Role == ch.RoleAnomaly {
+			continue
+		}
+		values = append(values, c)
+	}
+	switch {
+	case len(first.DateTimes) > 0 && first.Schema != nil:
+		for i, row := range rows {
+			xs[i] = float64(i)
+			if len(row.DateTimes) > 0 {
+				if t, err := time.Parse(first.Schema.DateFormat, row.DateTimes[0]); err == nil {
+					xs[i] = float64(t.UnixNano())
+				}
+			}
+		}
+	case len(values) >= 2:
+		x := values[0]
+		values = values[1:]
+		for i, row := range rows {
+			xs[i] = math.NaN()
+			if x < len(row.Floats) {
+				xs[i] = row.Floats[x]
+			}
+		}
+	default:
+		for i := range rows {
+			xs[i] = float64(i)
+		}
+	}
+	return xs, values
+}
+
+// hasAnomaly returns whether any of the row's columns is flagged as an
+// outlier by an anomaly column.
+func hasAnomaly(row ch.Row) bool {
+	for i, f := range row.Floats {
+		if row.Schema.FloatRole(i).Role == ch.RoleAnomaly && f == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// lttb returns the indices of n points, out of those with the given sorted
+// xs, picked with the Largest-Triangle-Three-Buckets algorithm: the first and
+// last points, and from each of n-2 buckets in between the point forming the
+// largest triangle with the previously picked point and the average of the
+// next bucket.
+func lttb(xs, ys []float64, n int) []int {
+	if n >= len(xs) || n < 3 {
+		return allIndices(len(xs))
+	}
+	var (
+		size   = float64(len(xs)-2) / float64(n-2)
+		picked = []int{0}
+		a      = 0
+	)
+	for b := 0; b < n-2; b++ {
+		start, end := int(float64(b)*size)+1, int(float64(b+1)*size)+1
+		nextStart, nextEnd := end, min(int(float64(b+2)*size)+1, len(xs))
+		if b == n-3 {
+			nextStart, nextEnd = len(xs)-1, len(xs)
+		}
+		var avgX, avgY, count float64
+		for i := nextStart; i < nextEnd; i++ {
+			if !math.IsNaN(ys[i]) {
+				avgX, avgY, count = avgX+xs[i], avgY+ys[i], count+1
+			}
+		}
+		avgX, avgY = avgX/count, avgY/count
+
+		best, bestArea := start, -1.0
+		for i := start; i < end; i++ {
+			area := math.Abs((xs[a]-avgX)*(ys[i]-ys[a]) - (xs[a]-xs[i])*(avgY-ys[a]))
+			if area > bestArea {
+				best, bestArea = i, area
+			}
+		}
+		picked = append(picked, best)
+		a = best
+	}
+	return append(picked, len(xs)-1)
+}
+
+// minMax returns the indices of the first and last points, and of the
+// lowest and highest points within each of (n-2)/2 equally wide ranges of
+// the given sorted xs, which are at most n points if n is at least 4.
+func minMax(xs, ys []float64, n int) []int {
+	if n >= len(xs) {
+		return allIndices(len(xs))
+	}
+	var (
+		buckets = max(1, (n-2)/2)
+		lo, hi  = xs[0], xs[len(xs)-1]
+		lows    = make([]int, buckets)
+		highs   = make([]int, buckets)
+	)
+	for b := range lows {
+		lows[b], highs[b] = -1, -1
+	}
+	for i, x := range xs {
+		if math.IsNaN(ys[i]) {
+			continue
+		}
+		b := 0
+		if hi > lo {
+			b = min(int((x-lo)/(hi-lo)*float64(buckets)), buckets-1)
+		}
+		if lows[b] < 0 || ys[i] < ys[lows[b]] {
+			lows[b] = i
+		}
+		if highs[b] < 0 || ys[i] > ys[highs[b]] {
+			highs[b] = i
+		}
+	}
+	picked := []int{0, len(xs) - 1}
+	for b := range lows {
+		if lows[b] >= 0 {
+			picked = append(picked, lows[b], highs[b])
+		}
+	}
+	return picked
+}
+
+func allIndices(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
@@ -0,0 +1,135 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestDownsample(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency", "cpu"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: time.RFC3339}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var in []ch.Row
+	for i := 0; i < 1000; i++ {
+		for _, host := range []string{"web", "db"} {
+			latency, cpu := math.Sin(float64(i)/50), 0.0
+			if host == "web" && i == 500 {
+				latency = 100 // spike
+			}
+			if host == "db" && i == 700 {
+				cpu = -100 // dip
+			}
+			ts := start.Add(time.Duration(i) * time.Second).Format(time.RFC3339)
+			in = append(in, ch.Row{Floats: []float64{latency, cpu}, Strings: []string{host}, DateTimes: []string{ts}, Schema: schema})
+		}
+	}
+
+	for _, method := range []string{DownsampleLTTB, DownsampleMinMax} {
+		t.Run(method, func(t *testing.T) {
+			rows := transform(t, "downsample", []string{"--max-points", "200", "--downsample", method}, in...)
+			if len(rows) > 200 || len(rows) < 100 {
+				t.Errorf("got %v rows, want at most 200", len(rows))
+			}
+			seen := make(map[string]bool)
+			var prev time.Time
+			for _, r := range rows {
+				ts, _ := time.Parse(time.RFC3339, r.DateTimes[0])
+				if ts.Before(prev) {
+					t.Fatal("rows should keep their order")
+				}
+				prev = ts
+				seen[fmt.Sprint(r.Strings[0], " ", r.Floats)] = true
+				seen[r.Strings[0]+" "+r.DateTimes[0]] = true
+			}
+			for _, want := range []string{"web [100 0]", "db " + start.Format(time.RFC3339), "web " + start.Add(999*time.Second).Format(time.RFC3339)} {
+				if !seen[want] {
+					t.Errorf("expected %v to be kept", want)
+				}
+			}
+			dip := false
+			for _, r := range rows {
+				dip = dip || r.Floats[1] == -100
+			}
+			if !dip {
+				t.Error("expected the dip in cpu to be kept")
+			}
+		})
+	}
+}
+
+func TestDownsample_ManySeries(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"host"}}
+	tests := []struct {
+		name          string
+		hosts, points int
+	}{
+		{name: "Sharing the points", hosts: 10, points: 100},
+		{name: "Too many to share them", hosts: 50, points: 100},
+		{name: "Unique labels", hosts: 1000, points: 1},
+	}
+	for _, tt := range tests {
+		var in []ch.Row
+		for i := 0; i < tt.points; i++ {
+			for h := 0; h < tt.hosts; h++ {
+				in = append(in, ch.Row{Floats: []float64{math.Sin(float64(i + h))}, Strings: []string{fmt.Sprint("host-", h)}, Schema: schema})
+			}
+		}
+		for _, method := range []string{DownsampleLTTB, DownsampleMinMax} {
+			if got := Downsample(in, 100, method); len(got) > 100 || len(got) < 50 {
+				t.Errorf("%v: %v kept %v of %v rows, want at most 100", tt.name, method, len(got), len(in))
+			}
+		}
+	}
+}
+
+func TestDownsample_Small(t *testing.T) {
+	rows := []ch.Row{{Floats: []float64{1}}, {Floats: []float64{2}}}
+	if got := Downsample(rows, 10, DownsampleLTTB); len(got) != 2 {
+		t.Errorf("got %v, want the rows unchanged", got)
+	}
+}
+
+func TestDownsample_Anomalies(t *testing.T) {
+	// A flagged value that doesn't stand out would be dropped but for its flag
+	schema := &ch.Schema{Floats: []string{"errors", "anomaly(errors)"}, FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}}}
+	var in []ch.Row
+	for i := 0; i < 100; i++ {
+		flag := 0.0
+		if i == 41 {
+			flag = 1
+		}
+		in = append(in, ch.Row{Floats: []float64{float64(i % 2), flag}, Schema: schema})
+	}
+	kept := false
+	for _, r := range Downsample(in, 10, DownsampleLTTB) {
+		kept = kept || r.Floats[1] == 1
+	}
+	if !kept {
+		t.Error("expected the flagged row to be kept")
+	}
+}
+
+func TestLTTB(t *testing.T) {
+	xs, ys := make([]float64, 100), make([]float64, 100)
+	for i := range xs {
+		xs[i], ys[i] = float64(i), float64(i%10)
+	}
+	ys[42] = 1000
+	picked := lttb(xs, ys, 10)
+	if len(picked) != 10 || picked[0] != 0 || picked[9] != 99 {
+		t.Fatalf("got %v, want 10 points from the first to the last", picked)
+	}
+	found := false
+	for i, p := range picked {
+		if i > 0 && p <= picked[i-1] {
+			t.Fatalf("got %v, want increasing indices", picked)
+		}
+		found = found || p == 42
+	}
+	if !found {
+		t.Errorf("got %v, want the peak at 42", picked)
+	}
+}
@@ -0,0 +1,110 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/expr"
+)
+
+func init() {
+	ch.RegisterTransformer(NewFilterTransformer())
+}
+
+// FilterTransformer keeps only the rows for which an expression holds, e.g.
+// `latency > 200 && host != "canary"`. See package expr for its syntax.
+type FilterTransformer struct{}
+
+func NewFilterTransformer() *FilterTransformer {
+	return &FilterTransformer{}
+}
+
+func (t *FilterTransformer) Name() string {
+	return "filter"
+}
+
+type FilterConfig struct {
+	Where string
+}
+
+func (t *FilterTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &FilterConfig{}
+	fs.StringVar(&c.Where, "where", "", `Keeps only rows matching an expression, e.g. 'latency > 200 && host != "canary"', 'host =~ "^web"' or 'ts >= 2024-01-01'.`)
+	return c
+}
+
+func (t *FilterTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*FilterConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for FilterTransformer")
+	}
+	if cfg.Where == "" {
+		return nil, fmt.Errorf("filter: --where is required")
+	}
+	e, err := expr.Parse(cfg.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, err := filterEnv(first.Schema, e); err != nil {
+		return nil, fmt.Errorf("filter: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema  *ch.Schema
+			env     *rowEnv
+			err     error
+			skipped int
+			skipErr error
+		)
+		for row := range rows {
+			if row.Schema != schema || env == nil {
+				schema = row.Schema
+				if env, err = filterEnv(schema, e); err != nil {
+					ch.ReportError(fmt.Errorf("filtering rows: %v", err))
+					return
+				}
+			}
+			env.row = row
+			v, err := e.Eval(env)
+			if err != nil {
+				// e.g. a datetime that doesn't parse; other rows may be fine
+				if skipped++; skipErr == nil {
+					skipErr = err
+				}
+				continue
+			}
+			if v.Bool {
+				out <- row
+			}
+		}
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: dropped %v rows that --where couldn't be evaluated on, e.g. %v\n", skipped, skipErr)
+		}
+	}()
+	return out, nil
+}
+
+// filterEnv resolves the identifiers of the condition to the columns of rows
+// with the given Schema, checking that it is a condition on them.
+func filterEnv(s *ch.Schema, e *expr.Expr) (*rowEnv, error) {
+	env, err := newRowEnv(s, e)
+	if err != nil {
+		return nil, err
+	}
+	k, err := e.Check(env.kinds())
+	if err == nil && k != expr.Bool {
+		err = fmt.Errorf("--where must be a condition, but %v is a %v", e, k)
+	}
+	return env, err
+}
@@ -0,0 +1,64 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestFilter(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04"}
+	in := []ch.Row{
+		{Floats: []float64{100}, Strings: []string{"web-1"}, DateTimes: []string{"2023-12-31 23:59"}, Schema: schema},
+		{Floats: []float64{300}, Strings: []string{"web-2"}, DateTimes: []string{"2024-01-01 00:00"}, Schema: schema},
+		{Floats: []float64{500}, Strings: []string{"canary"}, DateTimes: []string{"2024-01-02 10:00"}, Schema: schema},
+		{Floats: []float64{250}, Strings: []string{"db-1"}, DateTimes: []string{"2024-01-03 10:00"}, Schema: schema},
+	}
+
+	tests := []struct {
+		where string
+		want  []string
+	}{
+		{`latency > 200 && host != "canary"`, []string{"web-2", "db-1"}},
+		{`host =~ "^web-\d"`, []string{"web-1", "web-2"}},
+		{`ts >= 2024-01-01 && ts < 2024-01-03`, []string{"web-2", "canary"}},
+		{`latency > 1000`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			var hosts []string
+			for _, r := range transform(t, "filter", []string{"--where", tt.where}, in...) {
+				hosts = append(hosts, r.Strings[0])
+			}
+			if !reflect.DeepEqual(hosts, tt.want) {
+				t.Errorf("got %v, want %v", hosts, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilter_Errors(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"host"}}
+	row := ch.Row{Floats: []float64{1}, Strings: []string{"a"}, Schema: schema}
+	for _, where := range []string{"cpu > 1", `host > 1`, "latency + 1"} {
+		in := make(chan ch.Row, 1)
+		in <- row
+		close(in)
+		if _, err := NewFilterTransformer().Transform(in, &FilterConfig{Where: where}); err == nil {
+			t.Errorf("Expected --where %q rejected before filtering", where)
+		}
+	}
+}
+
+func TestFilter_SkipsRowsThatFail(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	rows := transform(t, "filter", []string{"--where", "ts >= 2024-01-01"},
+		ch.Row{DateTimes: []string{"2024-01-02"}, Schema: schema},
+		ch.Row{DateTimes: []string{"garbage"}, Schema: schema},
+		ch.Row{DateTimes: []string{"2024-01-03"}, Schema: schema},
+	)
+	if len(rows) != 2 {
+		t.Errorf("Expected the rows after the one that fails, got %v", rows)
+	}
+}
@@ -0,0 +1,305 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+)
+
+func init() {
+	ch.RegisterTransformer(NewForecastTransformer())
+}
+
+// Kinds of the float columns ForecastTransformer adds for each forecasted
+// column, which are named e.g. forecast(requests) and have the matching
+// ch.RoleForecast, ch.RoleForecastLower and ch.RoleForecastUpper roles.
+const (
+	ForecastValue = "forecast"
+	ForecastLower = "forecast_lower"
+	ForecastUpper = "forecast_upper"
+)
+
+// Forecasting methods.
+const (
+	ForecastHoltWinters = "holt-winters"
+	ForecastLinear      = "linear"
+)
+
+// maxForecast keeps a huge --forecast from exhausting memory.
+const maxForecast = 100000
+
+// ForecastTransformer extends time series --forecast periods ahead, spaced
+// like their rows. Each forecasted float column gets three more columns: the
+// forecast and the lower and upper bounds of its confidence interval, which
+// are NaN except on the forecast rows and the last row of each series (whose
+// actual value they repeat, so that charts draw the forecast as a
+// continuation). The bounds are NaN throughout if the series has too few
+// values to estimate them. Series are told apart by their string columns.
+// Rows with a null (empty) datetime, e.g. from left joins, aren't forecasted.
+type ForecastTransformer struct{}
+
+func NewForecastTransformer() *ForecastTransformer {
+	return &ForecastTransformer{}
+}
+
+func (t *ForecastTransformer) Name() string {
+	return "forecast"
+}
+
+type ForecastConfig struct {
+	Periods    int
+	Method     string
+	Season     string
+	Confidence float64
+	Columns    string
+}
+
+func (t *ForecastTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &ForecastConfig{}
+	fs.IntVar(&c.Periods, "forecast", 10, "Number of periods to forecast time series ahead.")
+	fs.StringVar(&c.Method, "forecast-method", ForecastHoltWinters, "Forecasting method: holt-winters (exponential smoothing) or linear (trend).")
+	fs.StringVar(&c.Season, "season", "", "Length of the forecasted series' seasons, as a number of rows or an interval like 1d or 1w. None by default.")
+	fs.Float64Var(&c.Confidence, "confidence", 0.95, "Probability that values lie within the forecasts' confidence bands.")
+	fs.StringVar(&c.Columns, "forecast-columns", "", "Comma-separated float columns to forecast. Defaults to all of them.")
+	return c
+}
+
+func (t *ForecastTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*ForecastConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for ForecastTransformer")
+	}
+	if cfg.Periods < 1 || cfg.Periods > maxForecast {
+		return nil, fmt.Errorf("forecast: --forecast must be between 1 and %v", maxForecast)
+	}
+	if cfg.Method != ForecastHoltWinters && cfg.Method != ForecastLinear {
+		return nil, fmt.Errorf("forecast: unknown method %q; use holt-winters or linear", cfg.Method)
+	}
+	if cfg.Confidence <= 0 || cfg.Confidence >= 1 {
+		return nil, fmt.Errorf("forecast: --confidence must be between 0 and 1")
+	}
+	season, err := parseSeason(cfg.Season)
+	if err != nil {
+		return nil, err
+	}
+	names := splitColumns(cfg.Columns)
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := derivedColumns(first.Schema, "forecast", names); err != nil {
+		return nil, fmt.Errorf("forecast: %v", err)
+	}
+	if _, err := findDateTimeColumn(first.Schema, ""); err != nil {
+		return nil, fmt.Errorf("forecast: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema   *ch.Schema
+			buffered []ch.Row
+		)
+		flush := func() error {
+			if len(buffered) == 0 {
+				return nil
+			}
+			return forecast(buffered, names, season, cfg, out)
+		}
+		for row := range rows {
+			if row.Schema != schema && len(buffered) > 0 {
+				if err := flush(); err != nil {
+					ch.ReportError(fmt.Errorf("forecasting: %v", err))
+					return
+				}
+				buffered = nil
+			}
+			schema = row.Schema
+			buffered = append(buffered, row)
+		}
+		if err := flush(); err != nil {
+			ch.ReportError(fmt.Errorf("forecasting: %v", err))
+		}
+	}()
+	return out, nil
+}
+
+// seasonLength is the length of a forecast's seasons, in rows or as an interval.
+type seasonLength struct {
+	rows int
+	interval
+}
+
+func parseSeason(s string) (seasonLength, error) {
+	if s == "" {
+		return seasonLength{}, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return seasonLength{rows: n}, nil
+	}
+	iv, err := parseInterval(s)
+	if err != nil {
+		return seasonLength{}, fmt.Errorf("forecast: invalid --season %q; use a number of rows or an interval like 1d or 1w", s)
+	}
+	return seasonLength{interval: iv}, nil
+}
+
+// periodOf returns the number of rows spaced by step in a season.
+func (s seasonLength) periodOf(step time.Duration) int {
+	if s.rows > 0 || step <= 0 {
+		return s.rows
+	}
+	d := s.d + time.Duration(s.days)*24*time.Hour + time.Duration(s.months)*30*24*time.Hour
+	return int(math.Round(float64(d) / float64(step)))
+}
+
+// forecast emits the given rows, which share a Schema, with their forecast
+// columns, followed by the forecast rows of each of their series.
+func forecast(rows []ch.Row, names []string, season seasonLength, cfg *ForecastConfig, out chan<- ch.Row) error {
+	schema := rows[0].Schema
+	cols, _, err := derivedColumns(schema, "forecast", names)
+	if err != nil {
+		return err
+	}
+	tsCol, err := findDateTimeColumn(schema, "")
+	if err != nil {
+		return err
+	}
+	floats := append([]string{}, schema.Floats...)
+	for _, c := range cols {
+		for _, kind := range []string{ForecastValue, ForecastLower, ForecastUpper} {
+			floats = append(floats, fmt.Sprintf("%v(%v)", kind, c.Name))
+		}
+	}
+	outSch := newSchema(schema, floats, schema.Strings, schema.DateTimes)
+	outSch.Sorted = false // forecasts follow all of the input, series by series
+	for k, c := range cols {
+		for i, role := range []ch.Role{ch.RoleForecast, ch.RoleForecastLower, ch.RoleForecastUpper} {
+			outSch.SetFloatRole(len(schema.Floats)+3*k+i, ch.ColumnRole{Role: role, Of: c.Name})
+		}
+	}
+
+	var (
+		times  = make([]time.Time, len(rows))
+		series = make(map[string][]int)
+		keys   []string
+		nulls  int
+	)
+	for i, row := range rows {
+		if tsCol.str(row) == "" {
+			nulls++
+			continue
+		}
+		if times[i], err = time.Parse(schema.DateFormat, tsCol.str(row)); err != nil {
+			return fmt.Errorf("invalid datetime %q in column %q", tsCol.str(row), tsCol.Name)
+		}
+		key := strings.Join(row.Strings, "\x00")
+		if _, ok := series[key]; !ok {
+			keys = append(keys, key)
+		}
+		series[key] = append(series[key], i)
+	}
+	if nulls > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: left %v rows with a null %q out of forecasts\n", nulls, tsCol.Name)
+	}
+
+	// Forecast every series' columns, extending their last rows
+	var (
+		z         = stats.NormalQuantile(cfg.Confidence)
+		extended  = make([][]float64, len(rows))
+		forecasts [][]ch.Row
+	)
+	for _, key := range keys {
+		idx := series[key]
+		sort.SliceStable(idx, func(i, j int) bool { return times[idx[i]].Before(times[idx[j]]) })
+		last := rows[idx[len(idx)-1]]
+		step := medianStep(times, idx)
+		if step <= 0 {
+			fmt.Fprintf(os.Stderr, "Warning: can't forecast series %q, as its rows aren't spaced in time\n", strings.ReplaceAll(key, "\x00", ", "))
+			continue
+		}
+		period := season.periodOf(step)
+
+		frows := make([]ch.Row, cfg.Periods)
+		for h := range frows {
+			dts := append([]string{}, last.DateTimes...)
+			dts[tsCol.Index] = times[idx[len(idx)-1]].Add(time.Duration(h+1) * step).Format(schema.DateFormat)
+			fs := make([]float64, len(floats))
+			for i := range fs {
+				fs[i] = math.NaN()
+			}
+			frows[h] = ch.Row{Floats: fs, Strings: last.Strings, DateTimes: dts, Schema: outSch}
+		}
+		ext := make([]float64, 0, 3*len(cols))
+		for k, c := range cols {
+			ys := make([]float64, len(idx))
+			for i, j := range idx {
+				ys[i] = c.float(rows[j])
+			}
+			y := ys[len(ys)-1]
+			ext = append(ext, y, y, y)
+
+			var f stats.Forecast
+			if cfg.Method == ForecastLinear {
+				f, err = stats.LinearTrend(ys, period, cfg.Periods)
+			} else {
+				f, err = stats.HoltWinters(ys, period, cfg.Periods)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: can't forecast %q: %v\n", c.Name, err)
+				continue
+			}
+			for h, v := range f.Values {
+				base := len(schema.Floats) + 3*k
+				frows[h].Floats[base] = v
+				frows[h].Floats[base+1] = v - z*f.StdErrs[h]
+				frows[h].Floats[base+2] = v + z*f.StdErrs[h]
+			}
+		}
+		extended[idx[len(idx)-1]] = ext
+		forecasts = append(forecasts, frows)
+	}
+
+	for i, row := range rows {
+		fs := make([]float64, len(schema.Floats), len(floats))
+		copy(fs, row.Floats)
+		if extended[i] != nil {
+			fs = append(fs, extended[i]...)
+		}
+		for len(fs) < len(floats) {
+			fs = append(fs, math.NaN())
+		}
+		out <- ch.Row{Floats: fs, Strings: row.Strings, DateTimes: row.DateTimes, Schema: outSch}
+	}
+	for _, frows := range forecasts {
+		for _, row := range frows {
+			out <- row
+		}
+	}
+	return nil
+}
+
+// medianStep returns the median time between consecutive rows of a series.
+func medianStep(times []time.Time, idx []int) time.Duration {
+	var steps []float64
+	for i := 1; i < len(idx); i++ {
+		if d := times[idx[i]].Sub(times[idx[i-1]]); d > 0 {
+			steps = append(steps, float64(d))
+		}
+	}
+	if len(steps) == 0 {
+		return 0
+	}
+	return time.Duration(stats.Median(steps))
+}
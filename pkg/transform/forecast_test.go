@@ -0,0 +1,126 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestForecast(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"requests"}, Strings: []string{}, DateTimes: []string{"day"}, DateFormat: "2006-01-02"}
+	var in []ch.Row
+	for i, day := range []string{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05"} {
+		in = append(in, ch.Row{Floats: []float64{float64(100 + 10*i)}, DateTimes: []string{day}, Schema: schema})
+	}
+
+	rows := transform(t, "forecast", []string{"--forecast", "2", "--forecast-method", "linear"}, in...)
+	if len(rows) != 7 {
+		t.Fatalf("Expected 5 rows and 2 forecasts, got %v", rows)
+	}
+	wantFloats := []string{"requests", "forecast(requests)", "forecast_lower(requests)", "forecast_upper(requests)"}
+	if !reflect.DeepEqual(rows[0].Schema.Floats, wantFloats) {
+		t.Errorf("Floats = %v, want %v", rows[0].Schema.Floats, wantFloats)
+	}
+	wantRoles := []ch.ColumnRole{{}, {Role: ch.RoleForecast, Of: "requests"}, {Role: ch.RoleForecastLower, Of: "requests"}, {Role: ch.RoleForecastUpper, Of: "requests"}}
+	if !reflect.DeepEqual(rows[0].Schema.FloatRoles, wantRoles) {
+		t.Errorf("FloatRoles = %v, want %v", rows[0].Schema.FloatRoles, wantRoles)
+	}
+	if f := rows[0].Floats; f[0] != 100 || !math.IsNaN(f[1]) {
+		t.Errorf("First row = %v, want no forecast", f)
+	}
+	if f := rows[4].Floats; !reflect.DeepEqual(f, []float64{140, 140, 140, 140}) {
+		t.Errorf("Last row = %v, want the forecast to start at its value", f)
+	}
+	for i, want := range []struct {
+		day   string
+		value float64
+	}{{"2024-01-06", 150}, {"2024-01-07", 160}} {
+		row := rows[5+i]
+		if row.DateTimes[0] != want.day || !math.IsNaN(row.Floats[0]) || math.Abs(row.Floats[1]-want.value) > 1e-9 {
+			t.Errorf("Forecast row = %v %v, want %v at %v", row.DateTimes, row.Floats, want.value, want.day)
+		}
+	}
+}
+
+func TestForecast_Bands(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"cpu"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04", Sorted: true}
+	in := []ch.Row{
+		{Floats: []float64{10}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01 10:00"}, Schema: schema},
+		{Floats: []float64{50}, Strings: []string{"b"}, DateTimes: []string{"2024-01-01 10:00"}, Schema: schema},
+		{Floats: []float64{14}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01 10:05"}, Schema: schema},
+		{Floats: []float64{51}, Strings: []string{"b"}, DateTimes: []string{"2024-01-01 10:05"}, Schema: schema},
+		{Floats: []float64{11}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01 10:10"}, Schema: schema},
+		{Floats: []float64{49}, Strings: []string{"b"}, DateTimes: []string{"2024-01-01 10:10"}, Schema: schema},
+		{Floats: []float64{15}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01 10:15"}, Schema: schema},
+		{Floats: []float64{52}, Strings: []string{"b"}, DateTimes: []string{"2024-01-01 10:15"}, Schema: schema},
+	}
+
+	rows := transform(t, "forecast", []string{"--forecast", "3"}, in...)
+	if len(rows) != 14 {
+		t.Fatalf("Expected 8 rows and 3 forecasts per host, got %v", len(rows))
+	}
+	for _, row := range rows[8:] {
+		value, lower, upper := row.Floats[1], row.Floats[2], row.Floats[3]
+		if !(lower < value && value < upper) {
+			t.Errorf("Forecast %v of %v isn't within its band", row.Floats, row.Strings)
+		}
+	}
+	if got := []string{rows[8].Strings[0], rows[11].Strings[0], rows[11].DateTimes[0]}; !reflect.DeepEqual(got, []string{"a", "b", "2024-01-01 10:20"}) {
+		t.Errorf("Forecast series = %v", got)
+	}
+	if rows[10].Floats[3]-rows[10].Floats[2] <= rows[8].Floats[3]-rows[8].Floats[2] {
+		t.Error("Expected bands to widen further ahead")
+	}
+	if rows[0].Schema.Sorted {
+		t.Error("Expected the forecasts of each host not to be sorted by time")
+	}
+}
+
+func TestForecast_Season(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"load"}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02 15:04"}
+	var in []ch.Row
+	for i, v := range []float64{1, 5, 1, 5, 1, 5, 1, 5} {
+		ts := []string{"2024-01-01 00:00", "2024-01-01 12:00", "2024-01-02 00:00", "2024-01-02 12:00", "2024-01-03 00:00", "2024-01-03 12:00", "2024-01-04 00:00", "2024-01-04 12:00"}[i]
+		in = append(in, ch.Row{Floats: []float64{v}, DateTimes: []string{ts}, Schema: schema})
+	}
+
+	rows := transform(t, "forecast", []string{"--forecast", "2", "--season", "1d", "--forecast-method", "linear"}, in...)
+	if got := []float64{rows[8].Floats[1], rows[9].Floats[1]}; math.Abs(got[0]-1) > 1e-9 || math.Abs(got[1]-5) > 1e-9 {
+		t.Errorf("Forecast = %v, want the daily season [1 5]", got)
+	}
+}
+
+func TestForecast_NoBandsFromTooFewValues(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{}, DateTimes: []string{"day"}, DateFormat: "2006-01-02"}
+	for _, method := range []string{ForecastLinear, ForecastHoltWinters} {
+		rows := transform(t, "forecast", []string{"--forecast", "1", "--forecast-method", method},
+			ch.Row{Floats: []float64{1}, DateTimes: []string{"2024-01-01"}, Schema: schema},
+			ch.Row{Floats: []float64{3}, DateTimes: []string{"2024-01-02"}, Schema: schema},
+		)
+		if f := rows[2].Floats; f[1] != 5 || !math.IsNaN(f[2]) || !math.IsNaN(f[3]) {
+			t.Errorf("%v forecast = %v, want 5 without a confidence band", method, f)
+		}
+	}
+}
+
+func TestForecast_Errors(t *testing.T) {
+	tr := NewForecastTransformer()
+	for _, cfg := range []*ForecastConfig{
+		{Periods: 0, Method: ForecastLinear, Confidence: 0.9},
+		{Periods: 1, Method: "arima", Confidence: 0.9},
+		{Periods: 1, Method: ForecastLinear, Confidence: 1},
+		{Periods: 1, Method: ForecastLinear, Confidence: 0.9, Season: "often"},
+	} {
+		if _, err := tr.Transform(make(chan ch.Row), cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+
+	// Without a datetime column, nothing can be forecast
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{}, DateTimes: []string{}}
+	if err := transformErr(t, "forecast", nil, ch.Row{Floats: []float64{1}, Schema: schema}); err == nil {
+		t.Error("Expected an error without a datetime column")
+	}
+}
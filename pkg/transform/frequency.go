@@ -0,0 +1,80 @@
+package transform
+
+import (
+	"flag"
+	"sort"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewFrequencyTransformer())
+}
+
+// FrequencyTransformer counts how many times every distinct value of the
+// first string column occurs, producing one row per value with its count,
+// most frequent first.
+type FrequencyTransformer struct{}
+
+func NewFrequencyTransformer() *FrequencyTransformer {
+	return &FrequencyTransformer{}
+}
+
+func (t *FrequencyTransformer) Name() string {
+	return "frequency"
+}
+
+func (t *FrequencyTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	return nil
+}
+
+func (t *FrequencyTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	return CountFrequencies(rows), nil
+}
+
+// CountFrequencies counts how many times every distinct value of the first
+// string column occurs. Rows without strings are ignored. Values with the same
+// count keep the order in which they first appeared.
+func CountFrequencies(rows <-chan ch.Row) <-chan ch.Row {
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			counts = make(map[string]float64)
+			keys   []string
+			schema *ch.Schema
+		)
+		for row := range rows {
+			if len(row.Strings) == 0 {
+				continue
+			}
+			if schema == nil {
+				name := "value"
+				if row.Schema != nil && len(row.Schema.Strings) > 0 {
+					name = row.Schema.Strings[0]
+				}
+				schema = newSchema(row.Schema, []string{"count"}, []string{name}, []string{})
+				schema.Sorted = false // ordered by count
+			}
+			if _, ok := counts[row.Strings[0]]; !ok {
+				keys = append(keys, row.Strings[0])
+			}
+			counts[row.Strings[0]]++
+		}
+
+		// Sort by count descending for better visualization
+		sort.SliceStable(keys, func(i, j int) bool {
+			return counts[keys[i]] > counts[keys[j]]
+		})
+		for _, k := range keys {
+			out <- ch.Row{
+				Floats:    []float64{counts[k]},
+				Strings:   []string{k},
+				DateTimes: []string{},
+				Schema:    schema,
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,39 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestFrequency(t *testing.T) {
+	schema := &ch.Schema{Strings: []string{"fruit"}, DateFormat: "2006-01-02"}
+	rows := transform(t, "frequency", nil,
+		ch.Row{Strings: []string{"banana"}, Schema: schema},
+		ch.Row{Strings: []string{"apple"}, Schema: schema},
+		ch.Row{Strings: []string{"cherry"}, Schema: schema},
+		ch.Row{Strings: []string{"apple"}, Schema: schema},
+		ch.Row{Floats: []float64{1}},
+	)
+
+	var (
+		labels []string
+		counts []float64
+	)
+	for _, r := range rows {
+		labels = append(labels, r.Strings[0])
+		counts = append(counts, r.Floats[0])
+	}
+	if !reflect.DeepEqual(labels, []string{"apple", "banana", "cherry"}) {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	if !reflect.DeepEqual(counts, []float64{2, 1, 1}) {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+
+	got := rows[0].Schema
+	if !reflect.DeepEqual(got.Strings, []string{"fruit"}) || !reflect.DeepEqual(got.Floats, []string{"count"}) || got.DateFormat != "2006-01-02" {
+		t.Errorf("Unexpected schema %v", got)
+	}
+}
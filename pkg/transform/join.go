@@ -0,0 +1,379 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+// Kinds of joins.
+const (
+	// JoinInner only emits the rows of the left input that match a row of
+	// the right input.
+	JoinInner = "inner"
+	// JoinLeft emits every row of the left input, with nulls in the right
+	// input's columns if no row matches: NaN floats, and empty strings and
+	// datetimes, which e.g. BucketTransformer and ForecastTransformer skip.
+	JoinLeft = "left"
+)
+
+// JoinConfig describes how Join matches the rows of two inputs.
+type JoinConfig struct {
+	// On are the key columns whose values must be equal, named as in both
+	// inputs (e.g. `host`) or as `left=right` if their names differ.
+	On []string
+	// AsOf is the datetime column (or `left=right` columns) matched to the
+	// nearest time of a row with the same keys, rather than exactly.
+	AsOf string
+	// Tolerance is the furthest an as-of match may be, if positive.
+	Tolerance time.Duration
+	// Kind is JoinInner or JoinLeft.
+	Kind string
+	// Names of the inputs, which qualify the names of the columns both have,
+	// e.g. requests.$2 and cpu.$2.
+	Names [2]string
+}
+
+// Join combines the rows of the left input with those of the right input
+// that match them, appending the right input's columns other than its keys
+// to the left input's. Rows match if their key columns are equal, and, for
+// as-of joins, the right row's time is the nearest to the left row's (the
+// earlier one on ties). Exact joins emit a row for every match. The right
+// input is read into memory, and the left input is streamed.
+func Join(left, right <-chan ch.Row, cfg JoinConfig) (<-chan ch.Row, error) {
+	if len(cfg.On) == 0 && cfg.AsOf == "" {
+		return nil, fmt.Errorf("join: set the key columns to join on, or a datetime column for an as-of join")
+	}
+	if cfg.Kind != JoinInner && cfg.Kind != JoinLeft {
+		return nil, fmt.Errorf("join: unknown kind %q; use inner or left", cfg.Kind)
+	}
+	if cfg.Tolerance < 0 {
+		return nil, fmt.Errorf("join: the as-of tolerance can't be negative")
+	}
+	if cfg.Tolerance > 0 && cfg.AsOf == "" {
+		return nil, fmt.Errorf("join: a tolerance only applies to as-of joins")
+	}
+	for i, name := range cfg.Names {
+		if name == "" {
+			cfg.Names[i] = [2]string{"left", "right"}[i]
+		}
+	}
+
+	// Check the key columns of both inputs before reading either in full
+	for side, rows := range []*<-chan ch.Row{&left, &right} {
+		first, all, ok := peek(*rows)
+		if ok {
+			if _, err := newJoinSide(first.Schema, cfg, side); err != nil {
+				return nil, fmt.Errorf("join: %v", err)
+			}
+		}
+		*rows = all
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		r, err := indexJoin(right, cfg)
+		if err != nil {
+			ch.ReportError(fmt.Errorf("joining inputs: %v", err))
+			return
+		}
+		var (
+			schema *ch.Schema
+			j      *joiner
+		)
+		for row := range left {
+			if row.Schema != schema || j == nil {
+				schema = row.Schema
+				if j, err = newJoiner(schema, r, cfg); err != nil {
+					ch.ReportError(fmt.Errorf("joining inputs: %v", err))
+					return
+				}
+			}
+			j.join(row, out)
+		}
+	}()
+	return out, nil
+}
+
+// joinSide locates the key columns of one of the inputs.
+type joinSide struct {
+	schema *ch.Schema
+	keys   []column
+	asOf   column
+}
+
+// newJoinSide locates the key columns of the input with the given Schema,
+// the left (0) or right (1) one.
+func newJoinSide(s *ch.Schema, cfg JoinConfig, side int) (joinSide, error) {
+	js := joinSide{schema: s}
+	if s == nil {
+		return js, fmt.Errorf("the %v input's columns are unknown", cfg.Names[side])
+	}
+	for _, spec := range cfg.On {
+		c, err := findColumn(s, joinColumnName(spec, side))
+		if err != nil {
+			return js, fmt.Errorf("%v input: %v", cfg.Names[side], err)
+		}
+		js.keys = append(js.keys, c)
+	}
+	if cfg.AsOf != "" {
+		c, err := findDateTimeColumn(s, joinColumnName(cfg.AsOf, side))
+		if err != nil {
+			return js, fmt.Errorf("%v input: %v", cfg.Names[side], err)
+		}
+		js.asOf = c
+	}
+	return js, nil
+}
+
+// joinColumnName returns the name of a key column in the left (0) or right
+// (1) input, given as `name` or `left=right`.
+func joinColumnName(spec string, side int) string {
+	if l, r, ok := strings.Cut(spec, "="); ok {
+		return strings.TrimSpace([]string{l, r}[side])
+	}
+	return strings.TrimSpace(spec)
+}
+
+// key returns the values of the row's key columns. Datetimes are compared as
+// instants, so that inputs may have different date formats.
+func (js joinSide) key(row ch.Row) string {
+	vals := make([]string, len(js.keys))
+	for i, c := range js.keys {
+		vals[i] = c.str(row)
+		if c.Type == dateTimeColumn {
+			if t, err := time.Parse(js.schema.DateFormat, vals[i]); err == nil {
+				vals[i] = strconv.FormatInt(t.UnixNano(), 10)
+			}
+		}
+	}
+	return strings.Join(vals, "\x00")
+}
+
+// isKey returns whether the column is one of the side's key columns, which
+// aren't repeated in the joined rows.
+func (js joinSide) isKey(c column, cfg JoinConfig) bool {
+	if cfg.AsOf != "" && c == js.asOf {
+		return true
+	}
+	for _, k := range js.keys {
+		if c == k {
+			return true
+		}
+	}
+	return false
+}
+
+// joinIndex holds the rows of the right input by key, in order of time for
+// as-of joins.
+type joinIndex struct {
+	joinSide
+	rows  []ch.Row
+	times []time.Time
+	byKey map[string][]int
+}
+
+func indexJoin(rows <-chan ch.Row, cfg JoinConfig) (*joinIndex, error) {
+	idx := &joinIndex{byKey: make(map[string][]int)}
+	for row := range rows {
+		if idx.rows == nil {
+			js, err := newJoinSide(row.Schema, cfg, 1)
+			if err != nil {
+				return nil, err
+			}
+			idx.joinSide = js
+		} else if row.Schema != idx.schema {
+			return nil, fmt.Errorf("the columns of the %v input changed from %v to %v; joins need them to stay the same", cfg.Names[1], idx.schema, row.Schema)
+		}
+		i := len(idx.rows)
+		idx.rows = append(idx.rows, row)
+		if cfg.AsOf != "" {
+			t, err := time.Parse(idx.schema.DateFormat, idx.asOf.str(row))
+			idx.times = append(idx.times, t)
+			if err != nil {
+				continue
+			}
+		}
+		key := idx.key(row)
+		idx.byKey[key] = append(idx.byKey[key], i)
+	}
+	if cfg.AsOf != "" {
+		for _, is := range idx.byKey {
+			sort.SliceStable(is, func(a, b int) bool { return idx.times[is[a]].Before(idx.times[is[b]]) })
+		}
+	}
+	return idx, nil
+}
+
+// matches returns the rows of the right input that match the left row with
+// the given key and time.
+func (idx *joinIndex) matches(key string, t time.Time, cfg JoinConfig) []ch.Row {
+	is := idx.byKey[key]
+	if cfg.AsOf == "" {
+		ms := make([]ch.Row, len(is))
+		for k, i := range is {
+			ms[k] = idx.rows[i]
+		}
+		return ms
+	}
+	if len(is) == 0 {
+		return nil
+	}
+	// The nearest time is either the first that isn't earlier, or the one before
+	n := sort.Search(len(is), func(k int) bool { return !idx.times[is[k]].Before(t) })
+	best := -1
+	for _, k := range []int{n - 1, n} {
+		if k < 0 || k >= len(is) {
+			continue
+		}
+		if best < 0 || absDuration(idx.times[is[k]].Sub(t)) < absDuration(idx.times[is[best]].Sub(t)) {
+			best = k
+		}
+	}
+	if cfg.Tolerance > 0 && absDuration(idx.times[is[best]].Sub(t)) > cfg.Tolerance {
+		return nil
+	}
+	return []ch.Row{idx.rows[is[best]]}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// joiner joins the rows of a Schema of the left input.
+type joiner struct {
+	cfg    JoinConfig
+	left   joinSide
+	right  *joinIndex
+	schema *ch.Schema
+	// The right input's columns that are appended to the left input's
+	floats, strs, dts []column
+}
+
+func newJoiner(s *ch.Schema, right *joinIndex, cfg JoinConfig) (*joiner, error) {
+	left, err := newJoinSide(s, cfg, 0)
+	if err != nil {
+		return nil, err
+	}
+	j := &joiner{cfg: cfg, left: left, right: right}
+	if right.schema == nil { // the right input is empty
+		j.schema = s
+		return j, nil
+	}
+	for typ, names := range [][]string{floatColumn: right.schema.Floats, stringColumn: right.schema.Strings, dateTimeColumn: right.schema.DateTimes} {
+		for i, name := range names {
+			c := column{Name: name, Type: columnType(typ), Index: i}
+			if right.isKey(c, cfg) {
+				continue
+			}
+			switch c.Type {
+			case floatColumn:
+				j.floats = append(j.floats, c)
+			case stringColumn:
+				j.strs = append(j.strs, c)
+			default:
+				j.dts = append(j.dts, c)
+			}
+		}
+	}
+
+	// Columns both inputs have are qualified by the name of their input
+	taken := make(map[string]bool)
+	for _, names := range [][]string{s.Floats, s.Strings, s.DateTimes} {
+		for _, name := range names {
+			taken[name] = true
+		}
+	}
+	clashes := make(map[string]bool)
+	for _, cs := range [][]column{j.floats, j.strs, j.dts} {
+		for _, c := range cs {
+			clashes[c.Name] = taken[c.Name]
+		}
+	}
+	names := func(own []string, cs []column) []string {
+		var ns []string
+		for _, name := range own {
+			if clashes[name] {
+				name = cfg.Names[0] + "." + name
+			}
+			ns = append(ns, name)
+		}
+		for _, c := range cs {
+			name := c.Name
+			if clashes[name] {
+				name = cfg.Names[1] + "." + name
+			}
+			ns = append(ns, name)
+		}
+		if ns == nil {
+			ns = []string{}
+		}
+		return ns
+	}
+	j.schema = newSchema(s, names(s.Floats, j.floats), names(s.Strings, j.strs), names(s.DateTimes, j.dts))
+	if len(s.DateTimes) == 0 {
+		j.schema.DateFormat = right.schema.DateFormat
+	}
+	return j, nil
+}
+
+// join emits the left row joined with each of its matches.
+func (j *joiner) join(row ch.Row, out chan<- ch.Row) {
+	var (
+		ms  []ch.Row
+		t   time.Time
+		err error
+	)
+	if j.cfg.AsOf != "" {
+		t, err = time.Parse(j.left.schema.DateFormat, j.left.asOf.str(row))
+	}
+	if j.right.schema != nil && err == nil {
+		ms = j.right.matches(j.left.key(row), t, j.cfg)
+	}
+	if len(ms) == 0 {
+		if j.cfg.Kind == JoinInner {
+			return
+		}
+		ms = []ch.Row{{}}
+	}
+	for _, m := range ms {
+		joined := ch.Row{
+			Floats:    append(make([]float64, 0, len(j.schema.Floats)), row.Floats...),
+			Strings:   append(make([]string, 0, len(j.schema.Strings)), row.Strings...),
+			DateTimes: append(make([]string, 0, len(j.schema.DateTimes)), row.DateTimes...),
+			Schema:    j.schema,
+		}
+		for _, c := range j.floats {
+			joined.Floats = append(joined.Floats, c.float(m))
+		}
+		for _, c := range j.strs {
+			joined.Strings = append(joined.Strings, c.str(m))
+		}
+		for _, c := range j.dts {
+			joined.DateTimes = append(joined.DateTimes, j.dateTime(c.str(m)))
+		}
+		out <- joined
+	}
+}
+
+// dateTime reformats a datetime of the right input in the joined rows' date
+// format.
+func (j *joiner) dateTime(s string) string {
+	if s == "" || j.right.schema.DateFormat == j.schema.DateFormat {
+		return s
+	}
+	t, err := time.Parse(j.right.schema.DateFormat, s)
+	if err != nil {
+		return s
+	}
+	return t.Format(j.schema.DateFormat)
+}
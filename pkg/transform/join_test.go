@@ -0,0 +1,153 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+// join runs Join on the given left and right rows.
+func join(t *testing.T, cfg JoinConfig, left, right []ch.Row) []ch.Row {
+	t.Helper()
+	l, r := make(chan ch.Row, len(left)), make(chan ch.Row, len(right))
+	for _, row := range left {
+		l <- row
+	}
+	for _, row := range right {
+		r <- row
+	}
+	close(l)
+	close(r)
+
+	out, err := Join(l, r, cfg)
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	var result []ch.Row
+	for row := range out {
+		result = append(result, row)
+	}
+	return result
+}
+
+func TestJoin(t *testing.T) {
+	hosts := &ch.Schema{Floats: []string{"requests"}, Strings: []string{"host"}, DateTimes: []string{}}
+	regions := &ch.Schema{Floats: []string{"cores"}, Strings: []string{"region", "name"}, DateTimes: []string{}}
+	left := []ch.Row{
+		{Floats: []float64{10}, Strings: []string{"a"}, Schema: hosts},
+		{Floats: []float64{20}, Strings: []string{"b"}, Schema: hosts},
+		{Floats: []float64{30}, Strings: []string{"c"}, Schema: hosts},
+	}
+	right := []ch.Row{
+		{Floats: []float64{4}, Strings: []string{"eu", "a"}, Schema: regions},
+		{Floats: []float64{8}, Strings: []string{"us", "b"}, Schema: regions},
+		{Floats: []float64{2}, Strings: []string{"us", "a"}, Schema: regions},
+	}
+
+	rows := join(t, JoinConfig{On: []string{"host=name"}, Kind: JoinInner}, left, right)
+	if len(rows) != 3 {
+		t.Fatalf("Expected a row per match, got %v", rows)
+	}
+	want := &ch.Schema{Floats: []string{"requests", "cores"}, Strings: []string{"host", "region"}, DateTimes: []string{}}
+	if !reflect.DeepEqual(rows[0].Schema, want) {
+		t.Errorf("Schema = %v, want %v", rows[0].Schema, want)
+	}
+	for i, w := range []ch.Row{
+		{Floats: []float64{10, 4}, Strings: []string{"a", "eu"}},
+		{Floats: []float64{10, 2}, Strings: []string{"a", "us"}},
+		{Floats: []float64{20, 8}, Strings: []string{"b", "us"}},
+	} {
+		if !reflect.DeepEqual(rows[i].Floats, w.Floats) || !reflect.DeepEqual(rows[i].Strings, w.Strings) {
+			t.Errorf("Row %v = %v %v, want %v %v", i, rows[i].Floats, rows[i].Strings, w.Floats, w.Strings)
+		}
+	}
+
+	rows = join(t, JoinConfig{On: []string{"host=name"}, Kind: JoinLeft}, left, right)
+	if len(rows) != 4 {
+		t.Fatalf("Expected every left row, got %v", rows)
+	}
+	if last := rows[3]; last.Floats[0] != 30 || !math.IsNaN(last.Floats[1]) || last.Strings[1] != "" {
+		t.Errorf("Unmatched row = %v %v, want nulls", last.Floats, last.Strings)
+	}
+}
+
+func TestJoin_LeftNullDateTimes(t *testing.T) {
+	// Datetimes of unmatched rows are empty, which downstream transformers skip
+	deploys := &ch.Schema{Floats: []string{"requests"}, Strings: []string{"host"}, DateTimes: []string{}, DateFormat: "2006-01-02"}
+	hosts := &ch.Schema{Floats: []string{}, Strings: []string{"host"}, DateTimes: []string{"deployed"}, DateFormat: "2006-01-02"}
+	left := []ch.Row{
+		{Floats: []float64{10}, Strings: []string{"a"}, Schema: deploys},
+		{Floats: []float64{20}, Strings: []string{"a"}, Schema: deploys},
+		{Floats: []float64{30}, Strings: []string{"b"}, Schema: deploys},
+	}
+	right := []ch.Row{
+		{Strings: []string{"a"}, DateTimes: []string{"2024-01-01"}, Schema: hosts},
+	}
+
+	rows := join(t, JoinConfig{On: []string{"host"}, Kind: JoinLeft}, left, right)
+	if len(rows) != 3 || rows[2].DateTimes[0] != "" {
+		t.Fatalf("Expected the unmatched row without a datetime, got %v", rows)
+	}
+	if got := transform(t, "bucket", []string{"--bucket", "1d"}, rows...); len(got) != 1 || got[0].Floats[0] != 2 {
+		t.Errorf("Expected the matched rows in a bucket, got %v", got)
+	}
+	if got := transform(t, "forecast", []string{"--forecast", "1"}, rows...); len(got) != 3 || got[2].Floats[0] != 30 {
+		t.Errorf("Expected the unmatched row to be kept out of forecasts, got %v", got)
+	}
+}
+
+func TestJoin_AsOf(t *testing.T) {
+	requests := &ch.Schema{Floats: []string{"$2"}, Strings: []string{}, DateTimes: []string{"$1"}, DateFormat: "2006-01-02 15:04:05"}
+	cpu := &ch.Schema{Floats: []string{"$2"}, Strings: []string{}, DateTimes: []string{"$1"}, DateFormat: time.RFC3339}
+	left := []ch.Row{
+		{Floats: []float64{10}, DateTimes: []string{"2024-01-01 10:00:00"}, Schema: requests},
+		{Floats: []float64{12}, DateTimes: []string{"2024-01-01 10:01:00"}, Schema: requests},
+		{Floats: []float64{15}, DateTimes: []string{"2024-01-01 10:05:00"}, Schema: requests},
+	}
+	right := []ch.Row{
+		{Floats: []float64{0.9}, DateTimes: []string{"2024-01-01T10:01:40Z"}, Schema: cpu},
+		{Floats: []float64{0.5}, DateTimes: []string{"2024-01-01T10:00:10Z"}, Schema: cpu},
+	}
+
+	cfg := JoinConfig{AsOf: "$1", Tolerance: time.Minute, Kind: JoinInner, Names: [2]string{"requests", "cpu"}}
+	rows := join(t, cfg, left, right)
+	if len(rows) != 2 {
+		t.Fatalf("Expected the rows within a minute of a cpu sample, got %v", rows)
+	}
+	if want := []string{"requests.$2", "cpu.$2"}; !reflect.DeepEqual(rows[0].Schema.Floats, want) {
+		t.Errorf("Floats = %v, want the clashing names qualified %v", rows[0].Schema.Floats, want)
+	}
+	if !reflect.DeepEqual(rows[0].Floats, []float64{10, 0.5}) || !reflect.DeepEqual(rows[1].Floats, []float64{12, 0.9}) {
+		t.Errorf("Rows = %v %v, want the nearest cpu samples", rows[0].Floats, rows[1].Floats)
+	}
+	if rows[1].DateTimes[0] != "2024-01-01 10:01:00" {
+		t.Errorf("DateTimes = %v, want the left input's", rows[1].DateTimes)
+	}
+}
+
+func TestJoin_Errors(t *testing.T) {
+	for _, cfg := range []JoinConfig{
+		{Kind: JoinInner},
+		{On: []string{"host"}, Kind: "outer"},
+		{On: []string{"host"}, Kind: JoinInner, Tolerance: time.Second},
+		{AsOf: "ts", Kind: JoinInner, Tolerance: -time.Second},
+	} {
+		if _, err := Join(make(chan ch.Row), make(chan ch.Row), cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+
+	// Missing key columns are found before joining
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{}, DateTimes: []string{}}
+	l, r := make(chan ch.Row, 1), make(chan ch.Row, 1)
+	l <- ch.Row{Floats: []float64{1}, Schema: schema}
+	r <- ch.Row{Floats: []float64{2}, Schema: schema}
+	close(l)
+	close(r)
+	if _, err := Join(l, r, JoinConfig{On: []string{"host"}, Kind: JoinLeft}); err == nil {
+		t.Error("Expected an error for a missing key column")
+	}
+}
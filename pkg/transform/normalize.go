@@ -0,0 +1,269 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewNormalizeTransformer())
+}
+
+// Normalizations.
+const (
+	// NormalizeRow replaces values with their percentage of the total of
+	// their row's columns, e.g. each host's share of the requests of a day.
+	NormalizeRow = "row"
+	// NormalizeColumn replaces values with their percentage of the total of
+	// their column, e.g. each category's share of all requests.
+	NormalizeColumn = "column"
+	// NormalizeMinMax scales the values of each series to range from 0 to 1.
+	NormalizeMinMax = "minmax"
+	// NormalizeIndex replaces the values of each series with their ratio to
+	// its first (non-zero) value, times 100.
+	NormalizeIndex = "index"
+)
+
+// normalizedNames are what the columns normalized in each way are renamed to.
+var normalizedNames = map[string]string{
+	NormalizeRow:    "percent",
+	NormalizeColumn: "percent",
+	NormalizeMinMax: "minmax",
+	NormalizeIndex:  "index",
+}
+
+// NormalizeTransformer rescales float columns so that series of wildly
+// different magnitudes can be compared on one chart. Series are told apart
+// by their string columns if the input has a datetime column, and their
+// first value is that of their earliest time; otherwise all rows form one
+// series, in order.
+type NormalizeTransformer struct{}
+
+func NewNormalizeTransformer() *NormalizeTransformer {
+	return &NormalizeTransformer{}
+}
+
+func (t *NormalizeTransformer) Name() string {
+	return "normalize"
+}
+
+type NormalizeConfig struct {
+	Method  string
+	Columns string
+}
+
+func (t *NormalizeTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &NormalizeConfig{}
+	fs.StringVar(&c.Method, "normalize", NormalizeRow, "Normalization of float columns: row (percentage of the row's total), column (percentage of the column's total), minmax (scaled from 0 to 1 within each series) or index (100 at each series' first value).")
+	fs.StringVar(&c.Columns, "normalize-columns", "", "Comma-separated float columns to normalize. Defaults to all of them.")
+	return c
+}
+
+func (t *NormalizeTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*NormalizeConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for NormalizeTransformer")
+	}
+	if _, ok := normalizedNames[cfg.Method]; !ok {
+		return nil, fmt.Errorf("normalize: unknown normalization %q; use row, column, minmax or index", cfg.Method)
+	}
+	names := splitColumns(cfg.Columns)
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := derivedColumns(first.Schema, "normalization", names); err != nil {
+		return nil, fmt.Errorf("normalize: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		// Shares of each row's total need no other rows
+		if cfg.Method == NormalizeRow {
+			var (
+				schema *ch.Schema
+				outSch *ch.Schema
+				cols   []column
+				err    error
+			)
+			for row := range rows {
+				if row.Schema != schema || outSch == nil {
+					schema = row.Schema
+					if cols, outSch, err = normalizedColumns(schema, names, cfg.Method); err != nil {
+						ch.ReportError(fmt.Errorf("normalizing: %v", err))
+						return
+					}
+				}
+				var total float64
+				for _, c := range cols {
+					if x := c.float(row); !math.IsNaN(x) {
+						total += x
+					}
+				}
+				fs := append([]float64(nil), row.Floats...)
+				for _, c := range cols {
+					fs[c.Index] = percentOf(c.float(row), total)
+				}
+				row.Floats, row.Schema = fs, outSch
+				out <- row
+			}
+			return
+		}
+
+		var (
+			schema   *ch.Schema
+			buffered []ch.Row
+		)
+		flush := func() error {
+			if len(buffered) == 0 {
+				return nil
+			}
+			return normalize(buffered, names, cfg.Method, out)
+		}
+		for row := range rows {
+			if row.Schema != schema && len(buffered) > 0 {
+				if err := flush(); err != nil {
+					ch.ReportError(fmt.Errorf("normalizing: %v", err))
+					return
+				}
+				buffered = nil
+			}
+			schema = row.Schema
+			buffered = append(buffered, row)
+		}
+		if err := flush(); err != nil {
+			ch.ReportError(fmt.Errorf("normalizing: %v", err))
+		}
+	}()
+	return out, nil
+}
+
+// normalizedColumns locates the named float columns (all of them if none),
+// and names them in the Schema of the normalized rows.
+func normalizedColumns(s *ch.Schema, names []string, method string) ([]column, *ch.Schema, error) {
+	cols, _, err := derivedColumns(s, "normalization", names)
+	if err != nil {
+		return nil, nil, err
+	}
+	outSch := newSchema(s, append([]string(nil), s.Floats...), s.Strings, s.DateTimes)
+	for _, c := range cols {
+		outSch.Floats[c.Index] = fmt.Sprintf("%v(%v)", normalizedNames[method], c.Name)
+	}
+	return cols, outSch, nil
+}
+
+// normalize emits the given rows, which share a Schema, with the named float
+// columns (all of them if none) normalized as a whole.
+func normalize(rows []ch.Row, names []string, method string, out chan<- ch.Row) error {
+	cols, outSch, err := normalizedColumns(rows[0].Schema, names, method)
+	if err != nil {
+		return err
+	}
+
+	values := make([][]float64, len(rows))
+	for i, row := range rows {
+		values[i] = append([]float64(nil), row.Floats...)
+	}
+	if method == NormalizeColumn {
+		for _, c := range cols {
+			var total float64
+			for _, row := range rows {
+				if x := c.float(row); !math.IsNaN(x) {
+					total += x
+				}
+			}
+			for i, row := range rows {
+				values[i][c.Index] = percentOf(c.float(row), total)
+			}
+		}
+	} else {
+		for _, idx := range normalizedSeries(rows) {
+			for _, c := range cols {
+				normalizeSeries(rows, idx, c, method, values)
+			}
+		}
+	}
+
+	for i, row := range rows {
+		row.Floats, row.Schema = values[i], outSch
+		out <- row
+	}
+	return nil
+}
+
+// normalizedSeries returns the indices of the rows of each series, in order
+// of time.
+func normalizedSeries(rows []ch.Row) [][]int {
+	schema := rows[0].Schema
+	tsCol, err := findDateTimeColumn(schema, "")
+	if err != nil {
+		return [][]int{allIndices(len(rows))}
+	}
+	var (
+		times  = make([]time.Time, len(rows))
+		series = make(map[string][]int)
+		keys   []string
+	)
+	for i, row := range rows {
+		times[i], _ = time.Parse(schema.DateFormat, tsCol.str(row))
+		key := strings.Join(row.Strings, "\x00")
+		if _, ok := series[key]; !ok {
+			keys = append(keys, key)
+		}
+		series[key] = append(series[key], i)
+	}
+	all := make([][]int, len(keys))
+	for k, key := range keys {
+		idx := series[key]
+		sort.SliceStable(idx, func(i, j int) bool { return times[idx[i]].Before(times[idx[j]]) })
+		all[k] = idx
+	}
+	return all
+}
+
+// normalizeSeries sets the values of the column of the given rows, which are
+// a series in order of time, scaled from 0 to 1 or indexed to 100.
+func normalizeSeries(rows []ch.Row, idx []int, c column, method string, values [][]float64) {
+	var (
+		lo, hi = math.Inf(1), math.Inf(-1)
+		base   = math.NaN()
+	)
+	for _, i := range idx {
+		x := c.float(rows[i])
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			continue
+		}
+		lo, hi = min(lo, x), max(hi, x)
+		if math.IsNaN(base) && x != 0 {
+			base = x
+		}
+	}
+	for _, i := range idx {
+		x := c.float(rows[i])
+		switch {
+		case method == NormalizeIndex:
+			values[i][c.Index] = 100 * x / base
+		case hi > lo:
+			values[i][c.Index] = (x - lo) / (hi - lo)
+		case !math.IsNaN(x): // a flat series is all at the bottom
+			values[i][c.Index] = 0
+		}
+	}
+}
+
+// percentOf returns x as a percentage of total, or NaN if total is 0.
+func percentOf(x, total float64) float64 {
+	if total == 0 {
+		return math.NaN()
+	}
+	return 100 * x / total
+}
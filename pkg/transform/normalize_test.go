@@ -0,0 +1,83 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestNormalize_Row(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"web", "db", "$3"}, Strings: []string{}, DateTimes: []string{}}
+	rows := transform(t, "normalize", []string{"--normalize", "row", "--normalize-columns", "web,db"},
+		ch.Row{Floats: []float64{30, 10, 7}, Schema: schema},
+		ch.Row{Floats: []float64{0, 0, 7}, Schema: schema},
+	)
+	if want := []string{"percent(web)", "percent(db)", "$3"}; !reflect.DeepEqual(rows[0].Schema.Floats, want) {
+		t.Errorf("Floats = %v, want %v", rows[0].Schema.Floats, want)
+	}
+	if rows[0].Schema != rows[1].Schema {
+		t.Error("Expected the rows to share a Schema")
+	}
+	if f := rows[0].Floats; !reflect.DeepEqual(f, []float64{75, 25, 7}) {
+		t.Errorf("Row = %v, want [75 25 7]", f)
+	}
+	if f := rows[1].Floats; !math.IsNaN(f[0]) || !math.IsNaN(f[1]) {
+		t.Errorf("Row = %v, want no shares of a zero total", f)
+	}
+}
+
+func TestNormalize_Column(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"count"}, Strings: []string{"browser"}, DateTimes: []string{}}
+	rows := transform(t, "normalize", []string{"--normalize", "column"},
+		ch.Row{Floats: []float64{6}, Strings: []string{"firefox"}, Schema: schema},
+		ch.Row{Floats: []float64{2}, Strings: []string{"safari"}, Schema: schema},
+		ch.Row{Floats: []float64{math.NaN()}, Strings: []string{"lynx"}, Schema: schema},
+	)
+	if rows[0].Floats[0] != 75 || rows[1].Floats[0] != 25 || !math.IsNaN(rows[2].Floats[0]) {
+		t.Errorf("Rows = %v", rows)
+	}
+}
+
+func TestNormalize_Series(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"price"}, Strings: []string{"ticker"}, DateTimes: []string{"day"}, DateFormat: "2006-01-02"}
+	in := []ch.Row{
+		{Floats: []float64{200}, Strings: []string{"b"}, DateTimes: []string{"2024-01-02"}, Schema: schema},
+		{Floats: []float64{5}, Strings: []string{"a"}, DateTimes: []string{"2024-01-02"}, Schema: schema},
+		{Floats: []float64{100}, Strings: []string{"b"}, DateTimes: []string{"2024-01-01"}, Schema: schema},
+		{Floats: []float64{4}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01"}, Schema: schema},
+		{Floats: []float64{6}, Strings: []string{"a"}, DateTimes: []string{"2024-01-03"}, Schema: schema},
+	}
+
+	rows := transform(t, "normalize", []string{"--normalize", "index"}, in...)
+	if rows[0].Schema.Floats[0] != "index(price)" {
+		t.Errorf("Floats = %v", rows[0].Schema.Floats)
+	}
+	var got []float64
+	for _, row := range rows {
+		got = append(got, row.Floats[0])
+	}
+	if want := []float64{200, 125, 100, 100, 150}; !reflect.DeepEqual(got, want) {
+		t.Errorf("index = %v, want %v", got, want)
+	}
+
+	rows = transform(t, "normalize", []string{"--normalize", "minmax"}, in...)
+	got = nil
+	for _, row := range rows {
+		got = append(got, row.Floats[0])
+	}
+	if want := []float64{1, 0.5, 0, 0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("minmax = %v, want %v", got, want)
+	}
+}
+
+func TestNormalize_Errors(t *testing.T) {
+	if _, err := NewNormalizeTransformer().Transform(make(chan ch.Row), &NormalizeConfig{Method: "zscore"}); err == nil {
+		t.Error("Expected an error for an unknown normalization")
+	}
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{"s"}, DateTimes: []string{}}
+	if err := transformErr(t, "normalize", []string{"--normalize-columns", "s"}, ch.Row{Floats: []float64{1}, Strings: []string{"a"}, Schema: schema}); err == nil {
+		t.Error("Expected an error normalizing a string column")
+	}
+}
@@ -0,0 +1,260 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewPivotTransformer())
+	ch.RegisterTransformer(NewUnpivotTransformer())
+}
+
+// PivotTransformer turns long rows, e.g. (time, series, value), into wide
+// ones with a float column per series, e.g. (time, value of a, value of b),
+// so that every series becomes its own dataset in charts. Rows are keyed by
+// their remaining string and datetime columns; series missing from a key are
+// NaN, and the last value wins if a key has many values of the same series.
+// Float columns other than the pivoted one are dropped.
+type PivotTransformer struct{}
+
+func NewPivotTransformer() *PivotTransformer {
+	return &PivotTransformer{}
+}
+
+func (t *PivotTransformer) Name() string {
+	return "pivot"
+}
+
+type PivotConfig struct {
+	Column string
+	Value  string
+}
+
+func (t *PivotTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &PivotConfig{}
+	fs.StringVar(&c.Column, "pivot", "", "String column whose values become float columns. With --transform pivot, the first one.")
+	fs.StringVar(&c.Value, "pivot-value", "", "Float column with the values of the pivoted columns. Defaults to the first one.")
+	return c
+}
+
+func (t *PivotTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*PivotConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for PivotTransformer")
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := pivotColumns(first.Schema, cfg); err != nil {
+		return nil, fmt.Errorf("pivot: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema    *ch.Schema
+			seriesCol column
+			valueCol  column
+			series    map[string]int // index of each series' float column
+			names     []string
+			keys      map[string]*ch.Row
+			wide      []*ch.Row // in order of appearance
+			err       error
+		)
+		// flush emits the wide rows of the current schema
+		flush := func() {
+			if schema == nil {
+				return
+			}
+			ss := []string{}
+			for j, s := range schema.Strings {
+				if j != seriesCol.Index {
+					ss = append(ss, s)
+				}
+			}
+			outSch := newSchema(schema, names, ss, schema.DateTimes)
+			for _, w := range wide {
+				for len(w.Floats) < len(names) {
+					w.Floats = append(w.Floats, math.NaN())
+				}
+				w.Schema = outSch
+				out <- *w
+			}
+		}
+		for row := range rows {
+			if row.Schema != schema || series == nil {
+				flush()
+				schema = row.Schema
+				if seriesCol, valueCol, err = pivotColumns(schema, cfg); err != nil {
+					ch.ReportError(fmt.Errorf("pivoting: %v", err))
+					return
+				}
+				series, names, keys, wide = make(map[string]int), nil, make(map[string]*ch.Row), nil
+			}
+
+			name := seriesCol.str(row)
+			i, ok := series[name]
+			if !ok {
+				i = len(names)
+				series[name] = i
+				names = append(names, name)
+			}
+
+			ss := []string{}
+			for j, s := range row.Strings {
+				if j != seriesCol.Index {
+					ss = append(ss, s)
+				}
+			}
+			key := strings.Join(ss, "\x00") + "\x01" + strings.Join(row.DateTimes, "\x00")
+			w, ok := keys[key]
+			if !ok {
+				w = &ch.Row{Strings: ss, DateTimes: row.DateTimes}
+				keys[key] = w
+				wide = append(wide, w)
+			}
+			for len(w.Floats) <= i {
+				w.Floats = append(w.Floats, math.NaN())
+			}
+			w.Floats[i] = valueCol.float(row)
+		}
+		flush()
+	}()
+	return out, nil
+}
+
+// pivotColumns locates the string column to pivot and the float column with
+// the values, defaulting to the first ones.
+func pivotColumns(s *ch.Schema, cfg *PivotConfig) (column, column, error) {
+	if s == nil {
+		return column{}, column{}, fmt.Errorf("the input's columns are unknown")
+	}
+	seriesName, valueName := cfg.Column, cfg.Value
+	if seriesName == "" && len(s.Strings) > 0 {
+		seriesName = s.Strings[0]
+	}
+	if valueName == "" && len(s.Floats) > 0 {
+		valueName = s.Floats[0]
+	}
+	if seriesName == "" || valueName == "" {
+		return column{}, column{}, fmt.Errorf("pivoting requires a string and a float column, but the input has %v", s)
+	}
+	seriesCol, err := findColumn(s, seriesName)
+	if err != nil {
+		return column{}, column{}, err
+	}
+	if seriesCol.Type != stringColumn {
+		return column{}, column{}, fmt.Errorf("column %q isn't a string column", seriesName)
+	}
+	valueCol, err := findColumn(s, valueName)
+	if err == nil && valueCol.Type != floatColumn {
+		err = fmt.Errorf("column %q isn't a float column", valueName)
+	}
+	return seriesCol, valueCol, err
+}
+
+// UnpivotTransformer turns wide rows with many float columns into long ones,
+// one per column, with its name as the first string column and its value as
+// the first float column, which is how charts tell series apart. NaN values
+// are dropped, so that unpivot undoes pivot.
+type UnpivotTransformer struct{}
+
+func NewUnpivotTransformer() *UnpivotTransformer {
+	return &UnpivotTransformer{}
+}
+
+func (t *UnpivotTransformer) Name() string {
+	return "unpivot"
+}
+
+type UnpivotConfig struct {
+	Columns string
+	Name    string
+	Value   string
+}
+
+func (t *UnpivotTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &UnpivotConfig{}
+	fs.StringVar(&c.Columns, "unpivot", "", "Comma-separated float columns to turn into rows. With --transform unpivot, all of them.")
+	fs.StringVar(&c.Name, "unpivot-name", "series", "Name of the string column with the unpivoted columns' names.")
+	fs.StringVar(&c.Value, "unpivot-value", "value", "Name of the float column with the unpivoted columns' values.")
+	return c
+}
+
+func (t *UnpivotTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*UnpivotConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for UnpivotTransformer")
+	}
+	names := splitColumns(cfg.Columns)
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := derivedColumns(first.Schema, "unpivot", names); err != nil {
+		return nil, fmt.Errorf("unpivot: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema  *ch.Schema
+			outSch  *ch.Schema
+			cols    []column
+			unpivot []bool // whether each float column is unpivoted
+			err     error
+		)
+		for row := range rows {
+			if row.Schema != schema || outSch == nil {
+				schema = row.Schema
+				if cols, _, err = derivedColumns(schema, "unpivot", names); err != nil {
+					ch.ReportError(fmt.Errorf("unpivoting: %v", err))
+					return
+				}
+				unpivot = make([]bool, len(schema.Floats))
+				for _, c := range cols {
+					unpivot[c.Index] = true
+				}
+				floats := []string{cfg.Value}
+				for i, name := range schema.Floats {
+					if !unpivot[i] {
+						floats = append(floats, name)
+					}
+				}
+				outSch = newSchema(schema, floats, append([]string{cfg.Name}, schema.Strings...), schema.DateTimes)
+			}
+
+			var rest []float64
+			for i, f := range row.Floats {
+				if i < len(unpivot) && !unpivot[i] {
+					rest = append(rest, f)
+				}
+			}
+			for _, c := range cols {
+				x := c.float(row)
+				if math.IsNaN(x) {
+					continue
+				}
+				out <- ch.Row{
+					Floats:    append([]float64{x}, rest...),
+					Strings:   append([]string{c.Name}, row.Strings...),
+					DateTimes: row.DateTimes,
+					Schema:    outSch,
+				}
+			}
+		}
+	}()
+	return out, nil
+}
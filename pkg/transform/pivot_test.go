@@ -0,0 +1,73 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestPivot(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{"host"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	in := []ch.Row{
+		{Floats: []float64{10}, Strings: []string{"web"}, DateTimes: []string{"2024-01-01"}, Schema: schema},
+		{Floats: []float64{20}, Strings: []string{"db"}, DateTimes: []string{"2024-01-01"}, Schema: schema},
+		{Floats: []float64{30}, Strings: []string{"web"}, DateTimes: []string{"2024-01-02"}, Schema: schema},
+		{Floats: []float64{40}, Strings: []string{"cache"}, DateTimes: []string{"2024-01-03"}, Schema: schema},
+	}
+
+	rows := transform(t, "pivot", []string{"--pivot", "host"}, in...)
+	if len(rows) != 3 {
+		t.Fatalf("got %v rows, want 3", len(rows))
+	}
+	want := ch.Schema{Floats: []string{"web", "db", "cache"}, DateTimes: []string{"ts"}, DateFormat: "2006-01-02"}
+	if got := *rows[0].Schema; !reflect.DeepEqual(got.Floats, want.Floats) || !reflect.DeepEqual(got.DateTimes, want.DateTimes) || got.Strings == nil || len(got.Strings) != 0 {
+		t.Errorf("Schema = %v, want %v", rows[0].Schema, &want)
+	}
+	if rows[0].Strings == nil {
+		t.Error("Expected empty rather than nil Strings, like those of other rows")
+	}
+	wantFloats := [][]float64{{10, 20, math.NaN()}, {30, math.NaN(), math.NaN()}, {math.NaN(), math.NaN(), 40}}
+	for i, r := range rows {
+		for j, f := range r.Floats {
+			if w := wantFloats[i][j]; f != w && !(math.IsNaN(f) && math.IsNaN(w)) {
+				t.Errorf("row %v: Floats = %v, want %v", i, r.Floats, wantFloats[i])
+				break
+			}
+		}
+	}
+
+	// Unpivoting undoes pivoting, but for the order of rows
+	var back []string
+	for _, r := range transform(t, "unpivot", []string{"--unpivot-name", "host", "--unpivot-value", "latency"}, rows...) {
+		if !reflect.DeepEqual(r.Schema.Floats, schema.Floats) || !reflect.DeepEqual(r.Schema.Strings, schema.Strings) {
+			t.Fatalf("Schema = %v, want %v", r.Schema, schema)
+		}
+		back = append(back, r.DateTimes[0]+" "+r.Strings[0]+" "+r.Schema.Floats[0])
+	}
+	if want := []string{"2024-01-01 web latency", "2024-01-01 db latency", "2024-01-02 web latency", "2024-01-03 cache latency"}; !reflect.DeepEqual(back, want) {
+		t.Errorf("got %v, want %v", back, want)
+	}
+}
+
+func TestUnpivot(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"rx", "tx", "errors"}, Strings: []string{"host"}}
+	rows := transform(t, "unpivot", []string{"--unpivot", "rx,tx"}, ch.Row{Floats: []float64{1, 2, 3}, Strings: []string{"web"}, Schema: schema})
+
+	want := []ch.Row{
+		{Floats: []float64{1, 3}, Strings: []string{"rx", "web"}},
+		{Floats: []float64{2, 3}, Strings: []string{"tx", "web"}},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("got %v rows, want %v", len(rows), len(want))
+	}
+	for i := range rows {
+		if !reflect.DeepEqual(rows[i].Floats, want[i].Floats) || !reflect.DeepEqual(rows[i].Strings, want[i].Strings) {
+			t.Errorf("row %v = %v, want %v", i, rows[i], want[i])
+		}
+	}
+	if got := rows[0].Schema; !reflect.DeepEqual(got.Floats, []string{"value", "errors"}) || !reflect.DeepEqual(got.Strings, []string{"series", "host"}) {
+		t.Errorf("Schema = %v", got)
+	}
+}
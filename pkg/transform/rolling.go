@@ -0,0 +1,252 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/stats"
+)
+
+func init() {
+	ch.RegisterTransformer(NewRollingTransformer())
+}
+
+// RollingTransformer appends smoothed versions of float columns to every
+// row, computed over a trailing window of rows or time, so that raw and
+// smoothed series can be charted together.
+type RollingTransformer struct{}
+
+func NewRollingTransformer() *RollingTransformer {
+	return &RollingTransformer{}
+}
+
+func (t *RollingTransformer) Name() string {
+	return "rolling"
+}
+
+type RollingConfig struct {
+	Windows string
+	EWMA    float64
+}
+
+func (t *RollingTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &RollingConfig{}
+	fs.StringVar(&c.Windows, "rolling", "", "Comma-separated rolling statistics to append, out of avg, median, min, max and sum over a number of rows or a duration, e.g. 'avg(latency, 20),median(latency, 5m)', and ewma(col, alpha).")
+	fs.Float64Var(&c.EWMA, "ewma", 0, "Appends the exponentially weighted moving average of every float column with this smoothing factor in (0, 1], e.g. 0.3.")
+	return c
+}
+
+func (t *RollingTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*RollingConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for RollingTransformer")
+	}
+	var specs []*rollingSpec
+	for _, s := range splitTopLevel(cfg.Windows) {
+		spec, err := parseRollingSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	if cfg.EWMA != 0 && (cfg.EWMA < 0 || cfg.EWMA > 1) {
+		return nil, fmt.Errorf("rolling: --ewma must be in (0, 1]; got %v", cfg.EWMA)
+	}
+	if len(specs) == 0 && cfg.EWMA == 0 {
+		return nil, fmt.Errorf("rolling: either --rolling or --ewma is required")
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if _, _, err := newWindows(first.Schema, specs, cfg.EWMA); err != nil {
+		return nil, fmt.Errorf("rolling: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema  *ch.Schema
+			outSch  *ch.Schema
+			windows []*window
+			tsCol   column
+			err     error
+		)
+		for row := range rows {
+			if row.Schema != schema || outSch == nil {
+				schema = row.Schema
+				if windows, tsCol, err = newWindows(schema, specs, cfg.EWMA); err != nil {
+					ch.ReportError(fmt.Errorf("computing rolling statistics: %v", err))
+					return
+				}
+				outSch = newSchema(schema, append([]string(nil), schema.Floats...), schema.Strings, schema.DateTimes)
+				for _, w := range windows {
+					outSch.Floats = append(outSch.Floats, w.spec.name)
+				}
+			}
+
+			var ts time.Time
+			if tsCol.Name != "" {
+				ts, _ = time.Parse(schema.DateFormat, tsCol.str(row))
+			}
+			fs := make([]float64, len(row.Floats), len(row.Floats)+len(windows))
+			copy(fs, row.Floats)
+			for _, w := range windows {
+				fs = append(fs, w.add(ts, w.col.float(row)))
+			}
+			row.Floats, row.Schema = fs, outSch
+			out <- row
+		}
+	}()
+	return out, nil
+}
+
+// rollingSpec is a rolling statistic of a column, e.g. `avg(latency, 20)`.
+type rollingSpec struct {
+	name   string
+	fn     string
+	column string
+	rows   int           // Window size in rows, if it's not a time window
+	span   time.Duration // Window size in time, if it's not a row window
+	alpha  float64       // Smoothing factor, for ewma
+}
+
+var rollingFuncs = map[string]bool{"avg": true, "mean": true, "median": true, "min": true, "max": true, "sum": true, "ewma": true}
+
+func parseRollingSpec(s string) (*rollingSpec, error) {
+	open := strings.Index(s, "(")
+	if open <= 0 || !strings.HasSuffix(s, ")") {
+		return nil, fmt.Errorf("rolling: invalid rolling statistic %q; expected e.g. `avg(latency, 20)`", s)
+	}
+	args := strings.Split(s[open+1:len(s)-1], ",")
+	if len(args) != 2 {
+		return nil, fmt.Errorf("rolling: %q requires a column and a window, e.g. `avg(latency, 20)`", s)
+	}
+	spec := &rollingSpec{
+		name:   s,
+		fn:     strings.ToLower(strings.TrimSpace(s[:open])),
+		column: strings.TrimSpace(args[0]),
+	}
+	arg := strings.TrimSpace(args[1])
+	if !rollingFuncs[spec.fn] {
+		return nil, fmt.Errorf("rolling: unknown rolling statistic %q", spec.fn)
+	}
+	if spec.fn == "ewma" {
+		alpha, err := strconv.ParseFloat(arg, 64)
+		if err != nil || alpha <= 0 || alpha > 1 {
+			return nil, fmt.Errorf("rolling: ewma's smoothing factor must be in (0, 1]; got %q", arg)
+		}
+		spec.alpha = alpha
+		return spec, nil
+	}
+	if n, err := strconv.Atoi(arg); err == nil && n > 0 {
+		spec.rows = n
+		return spec, nil
+	}
+	iv, err := parseInterval(arg)
+	if err != nil || iv.months > 0 {
+		return nil, fmt.Errorf("rolling: invalid window %q; expected a number of rows or a duration like 5m", arg)
+	}
+	spec.span = iv.d + time.Duration(iv.days)*24*time.Hour
+	return spec, nil
+}
+
+// newWindows binds the rolling statistics to the columns of the given Schema,
+// adding an EWMA of every float column if ewma isn't zero. It also returns
+// the datetime column that time windows slide over.
+func newWindows(s *ch.Schema, specs []*rollingSpec, ewma float64) ([]*window, column, error) {
+	var (
+		windows []*window
+		tsCol   column
+	)
+	if s == nil {
+		return nil, tsCol, fmt.Errorf("the input's columns are unknown")
+	}
+	if ewma != 0 {
+		specs = append([]*rollingSpec(nil), specs...)
+		for _, name := range s.Floats {
+			specs = append(specs, &rollingSpec{name: fmt.Sprintf("ewma(%v, %v)", name, ewma), fn: "ewma", column: name, alpha: ewma})
+		}
+	}
+	for _, spec := range specs {
+		c, err := findColumn(s, spec.column)
+		if err != nil {
+			return nil, tsCol, err
+		}
+		if c.Type != floatColumn {
+			return nil, tsCol, fmt.Errorf("%v requires a numeric column but %q isn't one", spec.fn, spec.column)
+		}
+		if spec.span > 0 && tsCol.Name == "" {
+			if tsCol, err = findDateTimeColumn(s, ""); err != nil {
+				return nil, tsCol, err
+			}
+		}
+		windows = append(windows, &window{spec: spec, col: c, ewma: math.NaN()})
+	}
+	return windows, tsCol, nil
+}
+
+// window holds the trailing values of a column needed for a rolling statistic.
+type window struct {
+	spec   *rollingSpec
+	col    column
+	values []float64
+	times  []time.Time
+	ewma   float64
+}
+
+// add slides the window to include the given value, observed at ts, and
+// returns the statistic over the window. NaN values are skipped.
+func (w *window) add(ts time.Time, x float64) float64 {
+	if w.spec.fn == "ewma" {
+		if !math.IsNaN(x) {
+			if math.IsNaN(w.ewma) {
+				w.ewma = x
+			} else {
+				w.ewma = w.spec.alpha*x + (1-w.spec.alpha)*w.ewma
+			}
+		}
+		return w.ewma
+	}
+
+	if !math.IsNaN(x) {
+		w.values = append(w.values, x)
+		w.times = append(w.times, ts)
+	}
+	drop := 0
+	if w.spec.rows > 0 && len(w.values) > w.spec.rows {
+		drop = len(w.values) - w.spec.rows
+	}
+	for w.spec.span > 0 && drop < len(w.times) && !w.times[drop].After(ts.Add(-w.spec.span)) {
+		drop++
+	}
+	w.values, w.times = w.values[drop:], w.times[drop:]
+
+	switch w.spec.fn {
+	case "median":
+		return stats.Median(w.values)
+	case "min", "max":
+		if len(w.values) == 0 {
+			return math.NaN()
+		}
+		m := w.values[0]
+		for _, v := range w.values[1:] {
+			if (w.spec.fn == "min" && v < m) || (w.spec.fn == "max" && v > m) {
+				m = v
+			}
+		}
+		return m
+	case "sum":
+		return stats.Sum(w.values)
+	default:
+		return stats.Mean(w.values)
+	}
+}
@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestRolling(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"latency"}, Strings: []string{}, DateTimes: []string{"ts"}, DateFormat: "15:04"}
+	in := []ch.Row{
+		{Floats: []float64{10}, DateTimes: []string{"10:00"}, Schema: schema},
+		{Floats: []float64{20}, DateTimes: []string{"10:01"}, Schema: schema},
+		{Floats: []float64{60}, DateTimes: []string{"10:02"}, Schema: schema},
+		{Floats: []float64{math.NaN()}, DateTimes: []string{"10:03"}, Schema: schema},
+		{Floats: []float64{30}, DateTimes: []string{"10:05"}, Schema: schema},
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		appended [][]float64
+		names    []string
+	}{
+		{
+			name:     "Moving average over rows",
+			args:     []string{"--rolling", "avg(latency, 2)"},
+			appended: [][]float64{{10}, {15}, {40}, {40}, {45}},
+			names:    []string{"latency", "avg(latency, 2)"},
+		},
+		{
+			name:     "Moving median, min and max",
+			args:     []string{"--rolling", "median(latency, 3),min(latency, 3),max(latency,3)"},
+			appended: [][]float64{{10, 10, 10}, {15, 10, 20}, {20, 10, 60}, {20, 10, 60}, {30, 20, 60}},
+		},
+		{
+			name:     "Time window",
+			args:     []string{"--rolling", "sum(latency, 2m)"},
+			appended: [][]float64{{10}, {30}, {80}, {60}, {30}},
+		},
+		{
+			name:     "EWMA of every float column",
+			args:     []string{"--ewma", "0.5"},
+			appended: [][]float64{{10}, {15}, {37.5}, {37.5}, {33.75}},
+			names:    []string{"latency", "ewma(latency, 0.5)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := transform(t, "rolling", tt.args, in...)
+			if len(rows) != len(in) {
+				t.Fatalf("Expected %v rows, got %v", len(in), len(rows))
+			}
+			var appended [][]float64
+			for i, r := range rows {
+				if r.Floats[0] != in[i].Floats[0] && !math.IsNaN(in[i].Floats[0]) {
+					t.Errorf("Original value changed in row %v", r)
+				}
+				appended = append(appended, r.Floats[1:])
+			}
+			if !reflect.DeepEqual(appended, tt.appended) {
+				t.Errorf("Appended floats = %v, want %v", appended, tt.appended)
+			}
+			if tt.names != nil && !reflect.DeepEqual(rows[0].Schema.Floats, tt.names) {
+				t.Errorf("Float columns = %v, want %v", rows[0].Schema.Floats, tt.names)
+			}
+		})
+	}
+
+	for _, spec := range []string{"avg(latency)", "avg(latency, 0)", "foo(latency, 2)", "avg(latency, 1mo)", "ewma(latency, 2)"} {
+		if _, err := parseRollingSpec(spec); err == nil {
+			t.Errorf("parseRollingSpec(%q) expected error", spec)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewSampleTransformer())
+}
+
+// SampleTransformer keeps a random sample of the rows, so that huge inputs
+// can be charted without holding all of their rows in memory. It either
+// keeps each row with a given probability, streaming, or keeps a uniform
+// sample of at most N rows (reservoir sampling), holding only those; or both,
+// in that order. Sampled rows keep their order, and the same seed always
+// samples the same rows of the same input.
+type SampleTransformer struct{}
+
+func NewSampleTransformer() *SampleTransformer {
+	return &SampleTransformer{}
+}
+
+func (t *SampleTransformer) Name() string {
+	return "sample"
+}
+
+type SampleConfig struct {
+	N    int
+	Rate float64
+	Seed uint64
+}
+
+func (t *SampleTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &SampleConfig{}
+	fs.IntVar(&c.N, "sample", 0, "Keeps a uniform random sample of at most N rows, holding only those in memory. If 0, there's no limit.")
+	fs.Float64Var(&c.Rate, "sample-rate", 1, "Keeps each row with this probability (e.g. 0.01), without holding any in memory.")
+	fs.Uint64Var(&c.Seed, "seed", 1, "Seed of the random sampling; the same seed samples the same rows of the same input.")
+	return c
+}
+
+func (t *SampleTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*SampleConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for SampleTransformer")
+	}
+	if cfg.N < 0 {
+		return nil, fmt.Errorf("sample: --sample can't be negative")
+	}
+	if cfg.Rate <= 0 || cfg.Rate > 1 {
+		return nil, fmt.Errorf("sample: --sample-rate must be in (0, 1]")
+	}
+	rng := rand.New(rand.NewPCG(cfg.Seed, cfg.Seed))
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			reservoir []ch.Row
+			positions []int // of the rows in the reservoir among the rows seen
+			seen      int
+		)
+		for row := range rows {
+			if cfg.Rate < 1 && rng.Float64() >= cfg.Rate {
+				continue
+			}
+			if cfg.N == 0 {
+				out <- row
+				continue
+			}
+			// Every row seen so far is in the reservoir with probability N/seen
+			seen++
+			if len(reservoir) < cfg.N {
+				reservoir = append(reservoir, row)
+				positions = append(positions, seen)
+			} else if i := rng.IntN(seen); i < cfg.N {
+				reservoir[i], positions[i] = row, seen
+			}
+		}
+
+		order := allIndices(len(reservoir))
+		sort.Slice(order, func(i, j int) bool { return positions[order[i]] < positions[order[j]] })
+		for _, i := range order {
+			out <- reservoir[i]
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,81 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func sampleInput(n int) []ch.Row {
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{}, DateTimes: []string{}}
+	rows := make([]ch.Row, n)
+	for i := range rows {
+		rows[i] = ch.Row{Floats: []float64{float64(i)}, Schema: schema}
+	}
+	return rows
+}
+
+func sampledValues(rows []ch.Row) []float64 {
+	xs := make([]float64, len(rows))
+	for i, row := range rows {
+		xs[i] = row.Floats[0]
+	}
+	return xs
+}
+
+func TestSample_Reservoir(t *testing.T) {
+	in := sampleInput(10000)
+	xs := sampledValues(transform(t, "sample", []string{"--sample", "100"}, in...))
+	if len(xs) != 100 {
+		t.Fatalf("Expected 100 rows, got %v", len(xs))
+	}
+	if !sort.Float64sAreSorted(xs) {
+		t.Errorf("Expected the rows in their original order, got %v", xs)
+	}
+	// A uniform sample's mean is near the input's (4999.5), give or take
+	// about 3 standard errors (2887/√100 each)
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	if mean := sum / 100; math.Abs(mean-4999.5) > 900 {
+		t.Errorf("Mean = %v, want a uniform sample", mean)
+	}
+
+	if again := sampledValues(transform(t, "sample", []string{"--sample", "100"}, in...)); !reflect.DeepEqual(again, xs) {
+		t.Error("Expected the same seed to sample the same rows")
+	}
+	if other := sampledValues(transform(t, "sample", []string{"--sample", "100", "--seed", "2"}, in...)); reflect.DeepEqual(other, xs) {
+		t.Error("Expected another seed to sample other rows")
+	}
+
+	if rows := transform(t, "sample", []string{"--sample", "100"}, in[:10]...); len(rows) != 10 {
+		t.Errorf("Expected all of fewer rows than the sample, got %v", len(rows))
+	}
+}
+
+func TestSample_Rate(t *testing.T) {
+	in := sampleInput(10000)
+	xs := sampledValues(transform(t, "sample", []string{"--sample-rate", "0.1"}, in...))
+	if len(xs) < 900 || len(xs) > 1100 {
+		t.Errorf("Expected about 1000 rows, got %v", len(xs))
+	}
+	if !sort.Float64sAreSorted(xs) {
+		t.Error("Expected the rows in their original order")
+	}
+	if rows := transform(t, "sample", []string{"--sample-rate", "0.1", "--sample", "50"}, in...); len(rows) != 50 {
+		t.Errorf("Expected the rate's sample to be capped at 50 rows, got %v", len(rows))
+	}
+}
+
+func TestSample_Errors(t *testing.T) {
+	tr := NewSampleTransformer()
+	for _, cfg := range []*SampleConfig{{N: -1, Rate: 1}, {Rate: 0}, {Rate: 1.5}} {
+		if _, err := tr.Transform(make(chan ch.Row), cfg); err == nil {
+			t.Errorf("Expected an error for %+v", cfg)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewSortTransformer())
+}
+
+// SortTransformer puts the rows in the order of the given columns, which
+// outputs keep rather than imposing their own (e.g. bars by descending count,
+// or lines along their x), so that the same input always charts the same.
+// Rows that are equal in those columns are ordered by the rest of their
+// columns, and then keep their order. Like the chartjs output, it counts the
+// frequencies of inputs that have strings but no floats.
+type SortTransformer struct{}
+
+func NewSortTransformer() *SortTransformer {
+	return &SortTransformer{}
+}
+
+func (t *SortTransformer) Name() string {
+	return "sort"
+}
+
+type SortConfig struct {
+	By string
+}
+
+func (t *SortTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &SortConfig{}
+	fs.StringVar(&c.By, "sort", "value desc", "Comma-separated columns to sort rows by, each optionally followed by asc, desc and natural (numbers within strings compared as numbers, e.g. host2 before host10). value is the first float column and label the first string column; natural alone is 'label natural'.")
+	return c
+}
+
+// sortKey is a column rows are sorted by, as named in --sort.
+type sortKey struct {
+	name    string
+	desc    bool
+	natural bool
+}
+
+func parseSortKeys(spec string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, s := range strings.Split(spec, ",") {
+		words := strings.Fields(s)
+		if len(words) == 0 {
+			continue
+		}
+		k := sortKey{name: words[0]}
+		if len(words) == 1 && k.name == "natural" {
+			k = sortKey{name: "label", natural: true}
+		}
+		for _, w := range words[1:] {
+			switch strings.ToLower(w) {
+			case "asc":
+				k.desc = false
+			case "desc":
+				k.desc = true
+			case "natural":
+				k.natural = true
+			default:
+				return nil, fmt.Errorf("unknown order %q of %q; use asc, desc or natural", w, k.name)
+			}
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no columns to sort by")
+	}
+	return keys, nil
+}
+
+func (t *SortTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*SortConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for SortTransformer")
+	}
+	keys, err := parseSortKeys(cfg.By)
+	if err != nil {
+		return nil, fmt.Errorf("sort: %v", err)
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if len(first.Floats) == 0 && len(first.Strings) > 0 {
+		if first, rows, ok = peek(CountFrequencies(rows)); !ok {
+			return rows, nil
+		}
+	}
+	if _, err := sortColumns(first.Schema, keys); err != nil {
+		return nil, fmt.Errorf("sort: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			schema   *ch.Schema
+			buffered []ch.Row
+		)
+		flush := func() error {
+			if len(buffered) == 0 {
+				return nil
+			}
+			return sortRows(buffered, keys, out)
+		}
+		for row := range rows {
+			if row.Schema != schema && len(buffered) > 0 {
+				if err := flush(); err != nil {
+					ch.ReportError(fmt.Errorf("sorting: %v", err))
+					return
+				}
+				buffered = nil
+			}
+			schema = row.Schema
+			buffered = append(buffered, row)
+		}
+		if err := flush(); err != nil {
+			ch.ReportError(fmt.Errorf("sorting: %v", err))
+		}
+	}()
+	return out, nil
+}
+
+// sortColumn finds the column a sort key names.
+func sortColumn(s *ch.Schema, name string) (column, error) {
+	c, err := findColumn(s, name)
+	if err == nil {
+		return c, nil
+	}
+	switch {
+	case name == "value":
+		return findFloatColumn(s, "")
+	case name == "label" && s != nil && len(s.Strings) > 0:
+		return column{Name: s.Strings[0], Type: stringColumn}, nil
+	case name == "label":
+		return findDateTimeColumn(s, "")
+	}
+	return c, err
+}
+
+// sortColumns finds the columns of the sort keys.
+func sortColumns(s *ch.Schema, keys []sortKey) ([]column, error) {
+	cols := make([]column, len(keys))
+	for i, k := range keys {
+		c, err := sortColumn(s, k.name)
+		if err != nil {
+			return nil, err
+		}
+		cols[i] = c
+	}
+	return cols, nil
+}
+
+// sortRows emits the given rows, which share a Schema, in order.
+func sortRows(rows []ch.Row, keys []sortKey, out chan<- ch.Row) error {
+	schema := rows[0].Schema
+	cols, err := sortColumns(schema, keys)
+	if err != nil {
+		return err
+	}
+
+	// Datetimes are compared as instants, so parse them once
+	times := make([][]time.Time, len(rows))
+	for i, row := range rows {
+		times[i] = make([]time.Time, len(cols))
+		for k, c := range cols {
+			if c.Type == dateTimeColumn {
+				times[i][k], _ = time.Parse(schema.DateFormat, c.str(row))
+			}
+		}
+	}
+
+	order := allIndices(len(rows))
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		for k, c := range cols {
+			var cmp int
+			switch c.Type {
+			case floatColumn:
+				x, y := c.float(rows[i]), c.float(rows[j])
+				if math.IsNaN(x) || math.IsNaN(y) { // nulls go last either way
+					if cmp = compareBool(math.IsNaN(x), math.IsNaN(y)); cmp != 0 {
+						return cmp < 0
+					}
+					continue
+				}
+				cmp = compareFloat(x, y)
+			case dateTimeColumn:
+				cmp = times[i][k].Compare(times[j][k])
+			default:
+				if keys[k].natural {
+					cmp = compareNatural(c.str(rows[i]), c.str(rows[j]))
+				} else {
+					cmp = strings.Compare(c.str(rows[i]), c.str(rows[j]))
+				}
+			}
+			if keys[k].desc {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return compareRows(rows[i], rows[j]) < 0
+	})
+
+	sorted := *schema
+	sorted.Sorted = true
+	for _, i := range order {
+		row := rows[i]
+		row.Schema = &sorted
+		out <- row
+	}
+	return nil
+}
+
+// compareRows orders rows by all of their columns, so that ties are broken
+// the same way whatever the order of the input.
+func compareRows(a, b ch.Row) int {
+	for i := 0; i < len(a.Strings) && i < len(b.Strings); i++ {
+		if cmp := strings.Compare(a.Strings[i], b.Strings[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	for i := 0; i < len(a.DateTimes) && i < len(b.DateTimes); i++ {
+		if cmp := strings.Compare(a.DateTimes[i], b.DateTimes[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	for i := 0; i < len(a.Floats) && i < len(b.Floats); i++ {
+		if cmp := compareBool(math.IsNaN(a.Floats[i]), math.IsNaN(b.Floats[i])); cmp != 0 {
+			return cmp
+		}
+		if cmp := compareFloat(a.Floats[i], b.Floats[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// compareBool orders false before true.
+func compareBool(x, y bool) int {
+	switch {
+	case !x && y:
+		return -1
+	case x && !y:
+		return 1
+	}
+	return 0
+}
+
+// compareNatural compares strings with the numbers within them compared as
+// numbers, e.g. host2 before host10.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		da, db := isDigit(a[0]), isDigit(b[0])
+		if !da || !db {
+			if a[0] != b[0] {
+				return compareFloat(float64(a[0]), float64(b[0]))
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+		na, nb := digits(a), digits(b)
+		// Numbers without leading zeros are larger if they're longer
+		ta, tb := strings.TrimLeft(a[:na], "0"), strings.TrimLeft(b[:nb], "0")
+		if len(ta) != len(tb) {
+			return compareFloat(float64(len(ta)), float64(len(tb)))
+		}
+		if cmp := strings.Compare(ta, tb); cmp != 0 {
+			return cmp
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return compareFloat(float64(len(a)), float64(len(b)))
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digits returns the length of the number at the start of s.
+func digits(s string) int {
+	n := 0
+	for n < len(s) && isDigit(s[n]) {
+		n++
+	}
+	return n
+}
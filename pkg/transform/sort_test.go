@@ -0,0 +1,118 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func sortedLabels(rows []ch.Row) []string {
+	var labels []string
+	for _, row := range rows {
+		labels = append(labels, row.Strings[0])
+	}
+	return labels
+}
+
+func TestSort(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"requests"}, Strings: []string{"host"}, DateTimes: []string{}}
+	in := []ch.Row{
+		{Floats: []float64{5}, Strings: []string{"host10"}, Schema: schema},
+		{Floats: []float64{math.NaN()}, Strings: []string{"host3"}, Schema: schema},
+		{Floats: []float64{9}, Strings: []string{"host2"}, Schema: schema},
+		{Floats: []float64{5}, Strings: []string{"host1"}, Schema: schema},
+	}
+
+	for _, tc := range []struct {
+		by   string
+		want []string
+	}{
+		{"value desc", []string{"host2", "host1", "host10", "host3"}}, // ties by label, nulls last
+		{"value", []string{"host1", "host10", "host2", "host3"}},
+		{"requests asc, host desc", []string{"host10", "host1", "host2", "host3"}},
+		{"label", []string{"host1", "host10", "host2", "host3"}},
+		{"natural", []string{"host1", "host2", "host3", "host10"}},
+		{"label natural desc", []string{"host10", "host3", "host2", "host1"}},
+	} {
+		rows := transform(t, "sort", []string{"--sort", tc.by}, in...)
+		if got := sortedLabels(rows); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("--sort %q = %v, want %v", tc.by, got, tc.want)
+		}
+		if !rows[0].Schema.Sorted || schema.Sorted {
+			t.Errorf("--sort %q: expected the output's Schema to be marked as sorted", tc.by)
+		}
+	}
+}
+
+func TestSort_DateTimes(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"x"}, Strings: []string{}, DateTimes: []string{"day"}, DateFormat: "02/01/2006"}
+	in := []ch.Row{
+		{Floats: []float64{1}, DateTimes: []string{"01/02/2024"}, Schema: schema},
+		{Floats: []float64{2}, DateTimes: []string{"15/01/2024"}, Schema: schema},
+	}
+	rows := transform(t, "sort", []string{"--sort", "label"}, in...)
+	if rows[0].Floats[0] != 2 {
+		t.Errorf("Expected datetimes compared in time, got %v", rows)
+	}
+}
+
+func TestSort_Frequencies(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{}, Strings: []string{"name"}, DateTimes: []string{}}
+	var in []ch.Row
+	for _, s := range []string{"b", "a", "c", "a", "c"} {
+		in = append(in, ch.Row{Floats: []float64{}, Strings: []string{s}, Schema: schema})
+	}
+	rows := transform(t, "sort", nil, in...)
+	if got, want := sortedLabels(rows), []string{"a", "c", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected counts by descending value, ties by label: got %v, want %v", got, want)
+	}
+}
+
+func TestSort_ThenTransformed(t *testing.T) {
+	schema := &ch.Schema{Floats: []string{"count"}, Strings: []string{"browser"}, DateTimes: []string{}}
+	sorted := transform(t, "sort", []string{"--sort", "value"},
+		ch.Row{Floats: []float64{6}, Strings: []string{"firefox"}, Schema: schema},
+		ch.Row{Floats: []float64{2}, Strings: []string{"safari"}, Schema: schema},
+	)
+
+	// Transformers keeping the order of the rows keep them marked as sorted
+	rows := transform(t, "normalize", []string{"--normalize", "column"}, sorted...)
+	if got, want := sortedLabels(rows), []string{"safari", "firefox"}; !reflect.DeepEqual(got, want) || !rows[0].Schema.Sorted {
+		t.Errorf("Expected normalize to keep the sort, got %v sorted %v", got, rows[0].Schema.Sorted)
+	}
+
+	// Those ordering them their own way don't
+	rows = transform(t, "bin", []string{"--bins", "2"}, sorted...)
+	if rows[0].Schema.Sorted {
+		t.Error("Expected bins not to be marked as sorted")
+	}
+}
+
+func TestSort_Errors(t *testing.T) {
+	tr := NewSortTransformer()
+	for _, by := range []string{"", "value sideways"} {
+		if _, err := tr.Transform(make(chan ch.Row), &SortConfig{By: by}); err == nil {
+			t.Errorf("Expected an error for --sort %q", by)
+		}
+	}
+}
+
+func TestCompareNatural(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"a2", "a10", -1},
+		{"a010", "a9", 1},
+		{"v1.10", "v1.9", 1},
+		{"x", "x1", -1},
+		{"b", "a9", 1},
+		{"007", "7", 0},
+	} {
+		if got := compareNatural(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareNatural(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
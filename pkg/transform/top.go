@@ -0,0 +1,150 @@
+package transform
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func init() {
+	ch.RegisterTransformer(NewTopTransformer())
+}
+
+// TopTransformer keeps the rows of the N categories (values of the first
+// string column) with the largest total value, folding the rows of every
+// other category into a single "Other" category, so that charts with
+// hundreds of categories stay readable. Like the chartjs output, it counts
+// the frequencies of inputs that have strings but no floats.
+type TopTransformer struct{}
+
+func NewTopTransformer() *TopTransformer {
+	return &TopTransformer{}
+}
+
+func (t *TopTransformer) Name() string {
+	return "top"
+}
+
+type TopConfig struct {
+	N     int
+	By    string
+	Other string
+}
+
+func (t *TopTransformer) RegisterFlags(fs *flag.FlagSet) any {
+	c := &TopConfig{}
+	fs.IntVar(&c.N, "top", 10, "Keeps the N categories with the largest values, folding the rest into one.")
+	fs.StringVar(&c.By, "top-by", "", "Float column to rank categories by. Defaults to the first one.")
+	fs.StringVar(&c.Other, "top-other", "Other", "Label of the category the rest are folded into. If empty, they're dropped.")
+	return c
+}
+
+func (t *TopTransformer) Transform(rows <-chan ch.Row, config any) (<-chan ch.Row, error) {
+	cfg, ok := config.(*TopConfig)
+	if !ok {
+		return nil, fmt.Errorf("invalid config type for TopTransformer")
+	}
+	if cfg.N <= 0 {
+		return nil, fmt.Errorf("top: --top must be positive")
+	}
+
+	first, rows, ok := peek(rows)
+	if !ok {
+		return rows, nil
+	}
+	if cfg.By == "" && len(first.Floats) == 0 && len(first.Strings) > 0 {
+		if first, rows, ok = peek(CountFrequencies(rows)); !ok {
+			return rows, nil
+		}
+	}
+	if _, err := findFloatColumn(first.Schema, cfg.By); err != nil {
+		return nil, fmt.Errorf("top: %v", err)
+	}
+
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+
+		var (
+			buffer     []ch.Row
+			totals     = make(map[string]float64)
+			categories []string
+			schema     *ch.Schema
+			by         column
+			err        error
+		)
+		for row := range rows {
+			if row.Schema != schema || by.Name == "" {
+				schema = row.Schema
+				if by, err = findFloatColumn(schema, cfg.By); err != nil {
+					ch.ReportError(fmt.Errorf("keeping top categories: %v", err))
+					return
+				}
+			}
+			if len(row.Strings) == 0 {
+				continue
+			}
+			category := row.Strings[0]
+			if _, ok := totals[category]; !ok {
+				categories = append(categories, category)
+				totals[category] = 0
+			}
+			if x := by.float(row); !math.IsNaN(x) {
+				totals[category] += x
+			}
+			buffer = append(buffer, row)
+		}
+
+		// Rank categories by total, keeping their order of appearance on ties
+		ranked := append([]string(nil), categories...)
+		sort.SliceStable(ranked, func(i, j int) bool { return totals[ranked[i]] > totals[ranked[j]] })
+		top := make(map[string]bool)
+		for i := 0; i < cfg.N && i < len(ranked); i++ {
+			top[ranked[i]] = true
+		}
+
+		// Fold the rest into rows that only differ in their category, each
+		// emitted where the first row it folds was, so that e.g. time series
+		// stay in order. Their values are summed, but columns with roles
+		// (e.g. anomaly flags or forecasts) don't add up, so they're NaN
+		var (
+			others = make(map[string]*ch.Row)
+			at     = make(map[int]*ch.Row)
+		)
+		for i, row := range buffer {
+			if top[row.Strings[0]] || cfg.Other == "" {
+				continue
+			}
+			key := strings.Join(row.Strings[1:], "\x00") + "\x01" + strings.Join(row.DateTimes, "\x00")
+			other, ok := others[key]
+			if !ok {
+				ss := append([]string{cfg.Other}, row.Strings[1:]...)
+				other = &ch.Row{Floats: make([]float64, len(row.Floats)), Strings: ss, DateTimes: row.DateTimes, Schema: row.Schema}
+				for j := range other.Floats {
+					if row.Schema.FloatRole(j).Role != ch.RoleValue {
+						other.Floats[j] = math.NaN()
+					}
+				}
+				others[key] = other
+				at[i] = other
+			}
+			for j, f := range row.Floats {
+				if j < len(other.Floats) && !math.IsNaN(f) && !math.IsNaN(other.Floats[j]) {
+					other.Floats[j] += f
+				}
+			}
+		}
+		for i, row := range buffer {
+			if top[row.Strings[0]] {
+				out <- row
+			} else if other, ok := at[i]; ok {
+				out <- *other
+			}
+		}
+	}()
+	return out, nil
+}
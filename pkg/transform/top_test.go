@@ -0,0 +1,113 @@
+package transform
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+func TestTop(t *testing.T) {
+	counts := &ch.Schema{Floats: []string{"count"}, Strings: []string{"browser"}}
+	strs := &ch.Schema{Strings: []string{"browser"}}
+	series := &ch.Schema{Floats: []string{"requests"}, Strings: []string{"host"}, DateTimes: []string{"day"}, DateFormat: "2006-01-02"}
+
+	tests := []struct {
+		name string
+		args []string
+		in   []ch.Row
+		want []ch.Row
+	}{
+		{
+			name: "Folds the smallest categories into Other",
+			args: []string{"--top", "2"},
+			in: []ch.Row{
+				{Floats: []float64{10}, Strings: []string{"chrome"}, Schema: counts},
+				{Floats: []float64{2}, Strings: []string{"opera"}, Schema: counts},
+				{Floats: []float64{5}, Strings: []string{"firefox"}, Schema: counts},
+				{Floats: []float64{1}, Strings: []string{"lynx"}, Schema: counts},
+			},
+			want: []ch.Row{
+				{Floats: []float64{10}, Strings: []string{"chrome"}, Schema: counts},
+				{Floats: []float64{3}, Strings: []string{"Other"}, Schema: counts},
+				{Floats: []float64{5}, Strings: []string{"firefox"}, Schema: counts},
+			},
+		},
+		{
+			name: "Counts frequencies of strings",
+			args: []string{"--top", "1"},
+			in: []ch.Row{
+				{Strings: []string{"opera"}, Schema: strs},
+				{Strings: []string{"chrome"}, Schema: strs},
+				{Strings: []string{"chrome"}, Schema: strs},
+				{Strings: []string{"lynx"}, Schema: strs},
+			},
+			want: []ch.Row{
+				{Floats: []float64{2}, Strings: []string{"chrome"}, DateTimes: []string{}},
+				{Floats: []float64{2}, Strings: []string{"Other"}, DateTimes: []string{}},
+			},
+		},
+		{
+			name: "Drops the rest without an Other label",
+			args: []string{"--top", "1", "--top-other", ""},
+			in: []ch.Row{
+				{Floats: []float64{2}, Strings: []string{"opera"}, Schema: counts},
+				{Floats: []float64{10}, Strings: []string{"chrome"}, Schema: counts},
+			},
+			want: []ch.Row{
+				{Floats: []float64{10}, Strings: []string{"chrome"}, Schema: counts},
+			},
+		},
+		{
+			name: "Ranks series by their total, folding the rest per timestamp in order",
+			args: []string{"--top", "1"},
+			in: []ch.Row{
+				{Floats: []float64{1}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01"}, Schema: series},
+				{Floats: []float64{4}, Strings: []string{"b"}, DateTimes: []string{"2024-01-01"}, Schema: series},
+				{Floats: []float64{2}, Strings: []string{"c"}, DateTimes: []string{"2024-01-01"}, Schema: series},
+				{Floats: []float64{9}, Strings: []string{"a"}, DateTimes: []string{"2024-01-02"}, Schema: series},
+				{Floats: []float64{1}, Strings: []string{"b"}, DateTimes: []string{"2024-01-02"}, Schema: series},
+			},
+			want: []ch.Row{
+				{Floats: []float64{1}, Strings: []string{"a"}, DateTimes: []string{"2024-01-01"}, Schema: series},
+				{Floats: []float64{6}, Strings: []string{"Other"}, DateTimes: []string{"2024-01-01"}, Schema: series},
+				{Floats: []float64{9}, Strings: []string{"a"}, DateTimes: []string{"2024-01-02"}, Schema: series},
+				{Floats: []float64{1}, Strings: []string{"Other"}, DateTimes: []string{"2024-01-02"}, Schema: series},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := transform(t, "top", tt.args, tt.in...)
+			for i := range got {
+				if tt.want[i].Schema == nil {
+					got[i].Schema = nil
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTop_Roles(t *testing.T) {
+	schema := &ch.Schema{
+		Floats:     []string{"errors", "anomaly(errors)", "forecast(errors)"},
+		Strings:    []string{"host"},
+		FloatRoles: []ch.ColumnRole{{}, {Role: ch.RoleAnomaly, Of: "errors"}, {Role: ch.RoleForecast, Of: "errors"}},
+	}
+	rows := transform(t, "top", []string{"--top", "1"},
+		ch.Row{Floats: []float64{10, 0, 9}, Strings: []string{"a"}, Schema: schema},
+		ch.Row{Floats: []float64{2, 1, 3}, Strings: []string{"b"}, Schema: schema},
+		ch.Row{Floats: []float64{3, 1, 4}, Strings: []string{"c"}, Schema: schema},
+	)
+	if len(rows) != 2 {
+		t.Fatalf("Expected a and Other, got %v", rows)
+	}
+	if f := rows[1].Floats; f[0] != 5 || !math.IsNaN(f[1]) || !math.IsNaN(f[2]) {
+		t.Errorf("Other = %v, want errors summed and no anomaly flag or forecast", f)
+	}
+}
@@ -0,0 +1,188 @@
+// Package transform contains the transformers that reshape the stream of
+// rows between the parser and the output. Every transformer registers itself
+// with ch.RegisterTransformer on init.
+package transform
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marianogappa/ch/pkg/ch"
+	"github.com/marianogappa/ch/pkg/expr"
+)
+
+// newSchema returns a Schema with the given column names for the rows a
+// transformer produces, keeping the date format and order of its input rows
+// and the roles of the float columns it keeps. Transformers that order rows
+// their own way must clear Sorted.
+func newSchema(in *ch.Schema, floats, strings, dateTimes []string) *ch.Schema {
+	s := &ch.Schema{Floats: floats, Strings: strings, DateTimes: dateTimes}
+	if in != nil {
+		s.DateFormat, s.Sorted = in.DateFormat, in.Sorted
+		for i, name := range floats {
+			for j, n := range in.Floats {
+				if r := in.FloatRole(j); n == name && r.Role != ch.RoleValue {
+					s.SetFloatRole(i, r)
+					break
+				}
+			}
+		}
+	}
+	return s
+}
+
+type columnType int
+
+const (
+	floatColumn columnType = iota
+	stringColumn
+	dateTimeColumn
+)
+
+// column locates a named column within a Row.
+type column struct {
+	Name  string
+	Type  columnType
+	Index int
+}
+
+// findColumn looks up a column by name (e.g. `latency`, or `$3` if the input
+// has no header) in the given Schema.
+func findColumn(s *ch.Schema, name string) (column, error) {
+	name = strings.TrimSpace(name)
+	if s == nil {
+		return column{}, fmt.Errorf("column %q not found: the input's columns are unknown", name)
+	}
+	for typ, names := range [][]string{floatColumn: s.Floats, stringColumn: s.Strings, dateTimeColumn: s.DateTimes} {
+		for i, n := range names {
+			if n == name {
+				return column{Name: name, Type: columnType(typ), Index: i}, nil
+			}
+		}
+	}
+	return column{}, fmt.Errorf("column %q not found in %v", name, s)
+}
+
+// findFloatColumn looks up the named float column, or the first one if name
+// is empty.
+func findFloatColumn(s *ch.Schema, name string) (column, error) {
+	if name == "" {
+		if s == nil || len(s.Floats) == 0 {
+			return column{}, fmt.Errorf("the input has no float column")
+		}
+		name = s.Floats[0]
+	}
+	c, err := findColumn(s, name)
+	if err == nil && c.Type != floatColumn {
+		err = fmt.Errorf("column %q isn't a float column", name)
+	}
+	return c, err
+}
+
+// float returns the value of the column in the given row, or NaN if it isn't
+// a float column.
+func (c column) float(r ch.Row) float64 {
+	if c.Type != floatColumn || c.Index >= len(r.Floats) {
+		return math.NaN()
+	}
+	return r.Floats[c.Index]
+}
+
+// str returns the value of the column in the given row as a string.
+func (c column) str(r ch.Row) string {
+	switch {
+	case c.Type == floatColumn && c.Index < len(r.Floats):
+		return strconv.FormatFloat(r.Floats[c.Index], 'g', -1, 64)
+	case c.Type == stringColumn && c.Index < len(r.Strings):
+		return r.Strings[c.Index]
+	case c.Type == dateTimeColumn && c.Index < len(r.DateTimes):
+		return r.DateTimes[c.Index]
+	}
+	return ""
+}
+
+// unread returns a channel that yields the given row followed by the rest of
+// the rows, so that transformers can peek at the first row.
+func unread(row ch.Row, rows <-chan ch.Row) <-chan ch.Row {
+	out := make(chan ch.Row)
+	go func() {
+		defer close(out)
+		out <- row
+		for row := range rows {
+			out <- row
+		}
+	}()
+	return out
+}
+
+// peek returns the first row, and a channel that yields it followed by the
+// rest of the rows, so that transformers can check their columns against the
+// input before returning. ok is false if there are no rows.
+func peek(rows <-chan ch.Row) (first ch.Row, all <-chan ch.Row, ok bool) {
+	if first, ok = <-rows; !ok {
+		return first, rows, false
+	}
+	return first, unread(first, rows), true
+}
+
+// rowEnv resolves the identifiers of an expression to the columns of a row.
+type rowEnv struct {
+	cols       map[string]column
+	dateFormat string
+	row        ch.Row
+}
+
+// newRowEnv locates the columns the expression refers to in the given Schema.
+func newRowEnv(s *ch.Schema, e *expr.Expr) (*rowEnv, error) {
+	env := &rowEnv{cols: make(map[string]column)}
+	for _, name := range e.Identifiers() {
+		c, err := findColumn(s, name)
+		if err != nil {
+			return nil, err
+		}
+		env.cols[name] = c
+	}
+	if s != nil {
+		env.dateFormat = s.DateFormat
+	}
+	return env, nil
+}
+
+// kinds returns the kinds of the values of the columns the expression refers
+// to, to check it before evaluating it.
+func (e *rowEnv) kinds() map[string]expr.Kind {
+	kinds := make(map[string]expr.Kind, len(e.cols))
+	for name, c := range e.cols {
+		switch c.Type {
+		case floatColumn:
+			kinds[name] = expr.Number
+		case dateTimeColumn:
+			kinds[name] = expr.Time
+		default:
+			kinds[name] = expr.String
+		}
+	}
+	return kinds
+}
+
+func (e *rowEnv) Lookup(name string) (expr.Value, error) {
+	c, ok := e.cols[name]
+	if !ok {
+		return expr.Value{}, fmt.Errorf("column %q not found", name)
+	}
+	switch c.Type {
+	case floatColumn:
+		return expr.NumberValue(c.float(e.row)), nil
+	case dateTimeColumn:
+		t, err := time.Parse(e.dateFormat, c.str(e.row))
+		if err != nil {
+			return expr.Value{}, err
+		}
+		return expr.TimeValue(t), nil
+	default:
+		return expr.StringValue(c.str(e.row)), nil
+	}
+}
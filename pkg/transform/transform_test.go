@@ -0,0 +1,78 @@
+package transform
+
+import (
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/marianogappa/ch/pkg/ch"
+)
+
+// transform runs the given rows through a registered transformer configured
+// with the given command line flags, and returns the resulting rows.
+func transform(t *testing.T, name string, args []string, rows ...ch.Row) []ch.Row {
+	t.Helper()
+	result, err := runTransform(t, name, args, rows...)
+	if err != nil {
+		t.Fatalf("Transform() error = %v", err)
+	}
+	return result
+}
+
+// transformErr returns the error of a transformer expected to fail, either
+// from Transform or reported while streaming.
+func transformErr(t *testing.T, name string, args []string, rows ...ch.Row) error {
+	t.Helper()
+	_, err := runTransform(t, name, args, rows...)
+	return err
+}
+
+func runTransform(t *testing.T, name string, args []string, rows ...ch.Row) ([]ch.Row, error) {
+	t.Helper()
+	tr, err := ch.GetTransformer(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	config := tr.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%v) error = %v", args, err)
+	}
+
+	in := make(chan ch.Row, len(rows))
+	for _, r := range rows {
+		in <- r
+	}
+	close(in)
+
+	ch.StreamError()
+	out, err := tr.Transform(in, config)
+	if err != nil {
+		return nil, err
+	}
+	var result []ch.Row
+	for r := range out {
+		result = append(result, r)
+	}
+	return result, ch.StreamError()
+}
+
+func TestRegistry(t *testing.T) {
+	for _, name := range []string{"frequency", "aggregate", "bucket", "rolling", "cumsum", "diff", "rate", "top", "filter", "compute", "pivot", "unpivot", "bin", "downsample", "forecast", "anomaly", "sample", "sort", "normalize", "distinct"} {
+		if _, err := ch.GetTransformer(name); err != nil {
+			t.Errorf("Transformer %q not registered: %v", name, err)
+		}
+	}
+}
+
+func TestTransform_SchemaChangeErrors(t *testing.T) {
+	hosts := &ch.Schema{Floats: []string{"x"}, Strings: []string{"host"}, DateTimes: []string{}}
+	other := &ch.Schema{Floats: []string{"x"}, Strings: []string{"name"}, DateTimes: []string{}}
+	err := transformErr(t, "aggregate", []string{"--group-by", "host"},
+		ch.Row{Floats: []float64{1}, Strings: []string{"a"}, Schema: hosts},
+		ch.Row{Floats: []float64{2}, Strings: []string{"b"}, Schema: other},
+	)
+	if err == nil || !strings.Contains(err.Error(), `"host" not found`) {
+		t.Errorf("Expected the missing column reported after the schema changed, got %v", err)
+	}
+}